@@ -0,0 +1,210 @@
+package furl
+
+import (
+	"errors"
+	"net/http"
+	"path"
+	"strconv"
+)
+
+const (
+	adminSnapshot = "/snapshot"
+	adminLinks    = "/links"
+	adminRollback = "/rollback"
+	adminDelete   = "/delete"
+	adminRestore  = "/restore"
+	adminPurge    = "/purge"
+	adminRules    = "/rules"
+)
+
+type admin struct {
+	*Furl
+}
+
+// The Admin method returns an http.Handler that provides the following
+// administrative endpoints for the Furl instance:
+//
+// GET /snapshot - Responds with a point-in-time snapshot of the Store, as
+//
+//	written by the Snapshot method. Will respond with 501 Not
+//	Implemented if the Store does not implement Snapshotter.
+//
+// GET /links -    Responds with a list of the links in the Store, and their
+//
+//	Meta, without Password hashes, using the JSONLines Format.
+//	The list can be filtered by tag with one or more tag query
+//	params, in which case only links with all of the given tags
+//	will be listed. Will respond with 501 Not Implemented if the
+//	Store does not implement Ranger.
+//
+// POST /rollback - Rolls a key back to a previous revision, as per the
+//
+//	Rollback method. The key and revision number are given by
+//	the key and revision form values. Will respond with 204 No
+//	Content on success, 404 Not Found if the key or revision
+//	does not exist, 410 Gone if the key has been deleted, and
+//	501 Not Implemented if the Store does not implement
+//	HistoryStore.
+//
+// POST /delete -  Deletes the key given by the key form value, leaving a
+//
+//	tombstone, as per the Delete method. Will respond with 204
+//	No Content on success, 404 Not Found if the key does not
+//	exist, and 501 Not Implemented if the Store does not support
+//	tombstones.
+//
+// POST /restore - Restores the deleted key given by the key form value, as per
+//
+//	the Restore method. Will respond with 204 No Content on
+//	success, 404 Not Found if the key does not exist, and 409
+//	Conflict if the key has not been deleted.
+//
+// POST /purge -   Removes the deleted key given by the key form value, along
+//
+//	with its tombstone, as per the Purge method. Will respond as
+//	with /restore, and with 501 Not Implemented if the Store does
+//	not support removing keys.
+//
+// GET /rules -    Responds with the targeting rules of the key given by the key
+//
+//	query param, as a JSON array or as XML, as negotiated using
+//	the Accept header, defaulting to JSON. Will respond with 404
+//	Not Found if the key does not exist.
+//
+// POST /rules -   Replaces the targeting rules of the key given by the key
+//
+//	query param, as per the SetRules method, with the rules in
+//	the body, either as a JSON array or as XML in the form
+//	<rules><rule>...</rule></rules>. Will respond with 204 No
+//	Content on success, 400 Bad Request for invalid rules, and
+//	404 Not Found if the key does not exist.
+//
+// NB: The handler does not perform any authentication, and so should either be
+// served on a private address or be wrapped by a handler that does.
+func (f *Furl) Admin() http.Handler {
+	return admin{f}
+}
+
+func (a admin) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch path.Clean("/" + r.URL.Path) {
+	case adminSnapshot:
+		a.snapshot(w, r)
+	case adminLinks:
+		a.links(w, r)
+	case adminRollback:
+		a.rollback(w, r)
+	case adminDelete:
+		a.keyAction(w, r, a.tombstone)
+	case adminRestore:
+		a.keyAction(w, r, a.restore)
+	case adminPurge:
+		a.keyAction(w, r, a.purge)
+	case adminRules:
+		a.rules(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func allowGetHead(w http.ResponseWriter, r *http.Request) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+
+		return false
+	}
+
+	return true
+}
+
+func (a admin) snapshot(w http.ResponseWriter, r *http.Request) {
+	if !allowGetHead(w, r) {
+		return
+	}
+
+	if _, ok := a.store.(Snapshotter); !ok {
+		http.Error(w, ErrSnapshotUnsupported.Error(), http.StatusNotImplemented)
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/jsonl")
+
+	if r.Method == http.MethodGet {
+		a.Snapshot(w)
+	}
+}
+
+func (a admin) links(w http.ResponseWriter, r *http.Request) {
+	if !allowGetHead(w, r) {
+		return
+	}
+
+	ranger, ok := a.store.(Ranger)
+	if !ok {
+		http.Error(w, ErrListUnsupported.Error(), http.StatusNotImplemented)
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/jsonl")
+
+	if r.Method == http.MethodGet {
+		Export(w, Tagged(ranger, r.URL.Query()["tag"]...), JSONLines)
+	}
+}
+
+func allowPost(w http.ResponseWriter, r *http.Request) bool {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+
+		return false
+	}
+
+	return true
+}
+
+func (a admin) rollback(w http.ResponseWriter, r *http.Request) {
+	if !allowPost(w, r) {
+		return
+	}
+
+	revision, err := strconv.Atoi(r.FormValue("revision"))
+	if err != nil {
+		http.Error(w, unknownRevision, http.StatusBadRequest)
+
+		return
+	}
+
+	switch err := a.Furl.rollback(actor{SourceRollback, r}, r.FormValue("key"), revision); {
+	case err == nil:
+		w.WriteHeader(http.StatusNoContent)
+	case errors.Is(err, ErrHistoryUnsupported):
+		http.Error(w, err.Error(), http.StatusNotImplemented)
+	case errors.Is(err, ErrDeleted):
+		http.Error(w, err.Error(), http.StatusGone)
+	default:
+		http.Error(w, err.Error(), http.StatusNotFound)
+	}
+}
+
+func (a admin) keyAction(w http.ResponseWriter, r *http.Request, fn func(actor, string) error) {
+	if !allowPost(w, r) {
+		return
+	}
+
+	switch err := fn(actor{SourceAdmin, r}, r.FormValue("key")); {
+	case err == nil:
+		w.WriteHeader(http.StatusNoContent)
+	case errors.Is(err, ErrDeleteUnsupported):
+		http.Error(w, err.Error(), http.StatusNotImplemented)
+	case errors.Is(err, ErrNotDeleted):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, err.Error(), http.StatusNotFound)
+	}
+}
+
+// Errors.
+var ErrListUnsupported = errors.New("store does not support listing")
@@ -0,0 +1,180 @@
+package furl
+
+import (
+	"net/http"
+	"time"
+)
+
+// The AuditAction type represents the kind of change recorded in an
+// AuditRecord.
+type AuditAction string
+
+// The actions that can be recorded in an AuditRecord.
+const (
+	AuditCreate  AuditAction = "create"
+	AuditUpdate  AuditAction = "update"
+	AuditDelete  AuditAction = "delete"
+	AuditRestore AuditAction = "restore"
+	AuditPurge   AuditAction = "purge"
+)
+
+// The sources of changes recorded in an AuditRecord.
+const (
+	SourceHTTP     = "http"
+	SourceImport   = "import"
+	SourceRollback = "rollback"
+	SourceAdmin    = "admin"
+)
+
+// The AuditRecord type describes a single change made to a link.
+//
+// The RemoteAddr and User are only set for changes made in response to an HTTP
+// request; the User is determined by the function set with the AuditUser
+// Option.
+//
+// The Meta never contains the Password hash of a link.
+type AuditRecord struct {
+	Time       time.Time   `json:"time"`
+	Action     AuditAction `json:"action"`
+	Key        string      `json:"key"`
+	URL        string      `json:"url,omitempty"`
+	Meta       *Meta       `json:"meta,omitempty"`
+	Source     string      `json:"source"`
+	RemoteAddr string      `json:"remoteAddr,omitempty"`
+	User       string      `json:"user,omitempty"`
+}
+
+// The AuditSink interface is used to receive an AuditRecord for each change
+// made to the Store by Furl.
+//
+// The Audit method is called after the Tx that made the change has completed,
+// and may be called concurrently.
+type AuditSink interface {
+	Audit(record AuditRecord)
+}
+
+// The AuditFunc type is an AuditSink that calls itself with each AuditRecord.
+type AuditFunc func(record AuditRecord)
+
+// The Audit method satisfies the AuditSink interface.
+func (a AuditFunc) Audit(record AuditRecord) {
+	a(record)
+}
+
+// The BasicAuthUser function returns the username from the Authorization
+// header of the request, if it uses Basic authentication. It is the default
+// function used to determine the User of an AuditRecord.
+//
+// NB: The password is not checked.
+func BasicAuthUser(r *http.Request) string {
+	user, _, _ := r.BasicAuth()
+
+	return user
+}
+
+type actor struct {
+	source string
+	r      *http.Request
+}
+
+type auditTx struct {
+	tx      Tx
+	records *[]AuditRecord
+}
+
+func (a auditTx) Has(key string) bool {
+	return a.tx.Has(key)
+}
+
+func (a auditTx) Set(key, url string) {
+	action := AuditCreate
+
+	if meta, _ := getMeta(a.tx, key); a.tx.Has(key) && meta.Deleted == nil {
+		action = AuditUpdate
+	}
+
+	a.tx.Set(key, url)
+
+	*a.records = append(*a.records, AuditRecord{Action: action, Key: key, URL: url})
+}
+
+func (a auditTx) Create(key, url string) bool {
+	if !create(a.tx, key, url) {
+		return false
+	}
+
+	*a.records = append(*a.records, AuditRecord{Action: AuditCreate, Key: key, URL: url})
+
+	return true
+}
+
+func (a auditTx) GetMeta(key string) (Meta, bool) {
+	return getMeta(a.tx, key)
+}
+
+func (a auditTx) SetMeta(key string, meta Meta) {
+	old, _ := getMeta(a.tx, key)
+
+	setMeta(a.tx, key, &meta)
+	hidePassword(&meta)
+
+	if l := len(*a.records); l > 0 && (*a.records)[l-1].Key == key && (*a.records)[l-1].Action != AuditPurge {
+		(*a.records)[l-1].Meta = &meta
+	} else {
+		action := AuditUpdate
+
+		if old.Deleted == nil && meta.Deleted != nil {
+			action = AuditDelete
+		} else if old.Deleted != nil && meta.Deleted == nil {
+			action = AuditRestore
+		}
+
+		*a.records = append(*a.records, AuditRecord{Action: action, Key: key, Meta: &meta})
+	}
+}
+
+func (a auditTx) Delete(key string) {
+	if deleteKey(a.tx, key) {
+		*a.records = append(*a.records, AuditRecord{Action: AuditPurge, Key: key})
+	}
+}
+
+func (f *Furl) audited(a actor, fn func(tx Tx)) (func(tx Tx), func()) {
+	if f.audit == nil {
+		return fn, func() {}
+	}
+
+	var records []AuditRecord
+
+	return func(tx Tx) {
+			fn(auditTx{tx: tx, records: &records})
+		}, func() {
+			now := f.now().UTC()
+
+			for _, record := range records {
+				record.Time = now
+				record.Source = a.source
+
+				if a.r != nil {
+					record.RemoteAddr = a.r.RemoteAddr
+					record.User = f.auditUser(a.r)
+				}
+
+				f.audit.Audit(record)
+			}
+		}
+}
+
+func (f *Furl) keyTx(a actor, key string, fn func(tx Tx)) {
+	fn, done := f.audited(a, fn)
+
+	keyTx(f.store, key, fn)
+	done()
+}
+
+func (f *Furl) tx(a actor, fn func(tx Tx)) {
+	fn, done := f.audited(a, fn)
+
+	f.store.Tx(fn)
+	done()
+}
@@ -0,0 +1,53 @@
+//go:build go1.21
+
+package furl
+
+import (
+	"context"
+	"log/slog"
+)
+
+type slogSink struct {
+	handler slog.Handler
+}
+
+// The AuditSlog function returns an AuditSink that logs each AuditRecord to the
+// given slog.Handler, at the Info level, with the time of the record.
+func AuditSlog(h slog.Handler) AuditSink {
+	return slogSink{handler: h}
+}
+
+// The Audit method satisfies the AuditSink interface.
+func (s slogSink) Audit(record AuditRecord) {
+	ctx := context.Background()
+
+	if !s.handler.Enabled(ctx, slog.LevelInfo) {
+		return
+	}
+
+	r := slog.NewRecord(record.Time, slog.LevelInfo, "audit", 0)
+	attrs := []slog.Attr{
+		slog.String("action", string(record.Action)),
+		slog.String("key", record.Key),
+		slog.String("source", record.Source),
+	}
+
+	if record.URL != "" {
+		attrs = append(attrs, slog.String("url", record.URL))
+	}
+
+	if record.Meta != nil {
+		attrs = append(attrs, slog.Any("meta", *record.Meta))
+	}
+
+	if record.RemoteAddr != "" {
+		attrs = append(attrs, slog.String("remoteAddr", record.RemoteAddr))
+	}
+
+	if record.User != "" {
+		attrs = append(attrs, slog.String("user", record.User))
+	}
+
+	r.AddAttrs(attrs...)
+	s.handler.Handle(ctx, r)
+}
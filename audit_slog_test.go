@@ -0,0 +1,20 @@
+//go:build go1.21
+
+package furl
+
+import (
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestAuditSlog(t *testing.T) {
+	var sb strings.Builder
+	f := New(Clock(testClock), Audit(AuditSlog(slog.NewTextHandler(&sb, nil))))
+	if code := post(f, "AAA", "http://www.example.com/"); code != 200 {
+		t.Fatalf("expecting response code 200, got %d", code)
+	}
+	if log := sb.String(); !strings.HasPrefix(log, "time=2020-01-02T03:04:05.000Z level=INFO msg=audit action=create key=AAA source=http url=http://www.example.com/") {
+		t.Errorf("unexpected log: %q", log)
+	}
+}
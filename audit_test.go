@@ -0,0 +1,148 @@
+package furl
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestAudit(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		records []AuditRecord
+		created = testClock()
+	)
+	f := New(Clock(testClock), Audit(AuditFunc(func(record AuditRecord) {
+		mu.Lock()
+		records = append(records, record)
+		mu.Unlock()
+	})))
+	r := httptest.NewRequest(http.MethodPost, "/AAA", strings.NewReader("http://www.example.com/1"))
+	r.Header.Set("Content-Type", "text/plain")
+	r.SetBasicAuth("alice", "password")
+	r.RemoteAddr = "192.0.2.1:1234"
+	f.ServeHTTP(httptest.NewRecorder(), r)
+	if _, err := f.Import(strings.NewReader(`{"key":"AAA","url":"http://www.example.com/2"}`), JSONLines, ConflictOverwrite); err != nil {
+		t.Fatalf("unexpected error importing: %s", err)
+	}
+	if err := f.Rollback("AAA", 0); err != nil {
+		t.Fatalf("unexpected error rolling back: %s", err)
+	}
+	for n, expected := range [...]AuditRecord{
+		{ // 1
+			Time:       created,
+			Action:     AuditCreate,
+			Key:        "AAA",
+			URL:        "http://www.example.com/1",
+			Meta:       &Meta{Created: created},
+			Source:     SourceHTTP,
+			RemoteAddr: "192.0.2.1:1234",
+			User:       "alice",
+		},
+		{ // 2
+			Time:   created,
+			Action: AuditUpdate,
+			Key:    "AAA",
+			URL:    "http://www.example.com/2",
+			Meta:   &Meta{Created: created, Updated: &created},
+			Source: SourceImport,
+		},
+		{ // 3
+			Time:   created,
+			Action: AuditUpdate,
+			Key:    "AAA",
+			URL:    "http://www.example.com/1",
+			Meta:   &Meta{Created: created, Updated: &created},
+			Source: SourceRollback,
+		},
+	} {
+		if n >= len(records) {
+			t.Errorf("test %d: missing record", n+1)
+		} else if !reflect.DeepEqual(records[n], expected) {
+			t.Errorf("test %d: expecting record %v, got %v", n+1, expected, records[n])
+		}
+	}
+	if len(records) != 3 {
+		t.Errorf("expecting 3 records, got %d", len(records))
+	}
+	records = records[:0]
+	f.Delete("AAA")
+	f.Restore("AAA")
+	f.Delete("AAA")
+	f.Purge("AAA")
+	var actions []AuditAction
+	for _, record := range records {
+		actions = append(actions, record.Action)
+	}
+	if expected := []AuditAction{AuditDelete, AuditRestore, AuditDelete, AuditPurge}; !reflect.DeepEqual(actions, expected) {
+		t.Errorf("expecting actions %v, got %v", expected, actions)
+	}
+	records = records[:0]
+	r = httptest.NewRequest(http.MethodPost, "/BBB", strings.NewReader(`{"url":"http://www.example.com/","password":"secret"}`))
+	r.Header.Set("Content-Type", "application/json")
+	f.ServeHTTP(httptest.NewRecorder(), r)
+	if len(records) != 1 || records[0].Meta == nil || records[0].Meta.Password != "" {
+		t.Errorf("expecting a single record without a password, got %v", records)
+	} else if meta, _ := getMeta(f.store, "BBB"); !validPasswordHash(meta.Password) {
+		t.Errorf("expecting password hash to be stored, got %q", meta.Password)
+	}
+}
+
+func TestAuditFile(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "audit.log")
+	a, err := OpenAuditFile(filename, AuditMaxSize(400), AuditMaxBackups(3))
+	if err != nil {
+		t.Fatalf("unexpected error opening audit file: %s", err)
+	}
+	record := AuditRecord{Time: time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC), Action: AuditCreate, Key: "AAA", URL: "http://www.example.com/", Source: SourceHTTP}
+	for i := 0; i < 3; i++ {
+		a.Audit(record)
+	}
+	a.Close()
+	if _, err := os.Stat(filename + ".1"); err != nil {
+		t.Fatalf("expecting rotated file: %s", err)
+	}
+	a, err = OpenAuditFile(filename, AuditMaxSize(400), AuditMaxBackups(3))
+	if err != nil {
+		t.Fatalf("unexpected error reopening audit file: %s", err)
+	}
+	a.Audit(record)
+	a.Close()
+	var (
+		prev  string
+		total int
+	)
+	for _, name := range [...]string{filename + ".3", filename + ".2", filename + ".1", filename} {
+		f, err := os.Open(name)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		} else if err != nil {
+			t.Fatalf("unexpected error opening %s: %s", name, err)
+		}
+		var count int
+		prev, count, err = VerifyAuditLog(f, prev)
+		f.Close()
+		if err != nil {
+			t.Fatalf("unexpected error verifying %s: %s", name, err)
+		}
+		total += count
+	}
+	if total != 4 {
+		t.Errorf("expecting 4 verified records, got %d", total)
+	}
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatalf("unexpected error reading audit file: %s", err)
+	}
+	tampered := strings.Replace(string(data), `"key":"AAA"`, `"key":"BBB"`, 1)
+	if _, _, err := VerifyAuditLog(strings.NewReader(tampered), ""); !errors.Is(err, ErrAuditChain) {
+		t.Errorf("expecting error %v, got %v", ErrAuditChain, err)
+	}
+}
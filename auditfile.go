@@ -0,0 +1,301 @@
+package furl
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+)
+
+const (
+	defaultAuditMaxSize    = 100 << 20
+	defaultAuditMaxBackups = 10
+)
+
+// The AuditFile type is an AuditSink that appends each AuditRecord to a file,
+// as a JSON object per line, rotating the file when it reaches a maximum size.
+//
+// Each line is of the following form:
+//
+//	{"record":{...},"prev":"HASH","hash":"HASH"}
+//
+// The hash is the hex encoded SHA-256 hash of the prev hash followed by the
+// exact bytes of the record, and the prev hash is the hash of the previous
+// line, or an empty string for the first line ever written. The chain of
+// hashes continues across rotated files, so that any modification, insertion,
+// or removal of a line can be detected with the VerifyAuditLog function.
+//
+// Rotated files are renamed with a numeric suffix, with .1 being the most
+// recent.
+type AuditFile struct {
+	filename     string
+	maxSize      int64
+	maxBackups   int
+	errorHandler func(error)
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+	last string
+}
+
+type auditLine struct {
+	Record json.RawMessage `json:"record"`
+	Prev   string          `json:"prev"`
+	Hash   string          `json:"hash"`
+}
+
+// The AuditFileOption type is used to specify optional params to the
+// OpenAuditFile function call.
+type AuditFileOption func(*AuditFile)
+
+// The AuditMaxSize AuditFileOption sets the size, in bytes, at which the audit
+// file will be rotated. The default is 100MB; a size of zero disables
+// rotation.
+func AuditMaxSize(size int64) AuditFileOption {
+	return func(a *AuditFile) {
+		a.maxSize = size
+	}
+}
+
+// The AuditMaxBackups AuditFileOption sets the number of rotated files that
+// will be kept, with older files being removed. The default is 10.
+func AuditMaxBackups(n int) AuditFileOption {
+	return func(a *AuditFile) {
+		a.maxBackups = n
+	}
+}
+
+// The AuditErrorHandler AuditFileOption sets a function that will be called
+// with any error that occurs while writing the audit file.
+//
+// By default, the error handler will panic.
+func AuditErrorHandler(fn func(error)) AuditFileOption {
+	return func(a *AuditFile) {
+		a.errorHandler = fn
+	}
+}
+
+// OpenAuditFile opens, or creates, the audit file with the given filename,
+// continuing the hash chain from the last line of the file, or of the most
+// recently rotated file.
+func OpenAuditFile(filename string, opts ...AuditFileOption) (*AuditFile, error) {
+	a := &AuditFile{
+		filename:     filename,
+		maxSize:      defaultAuditMaxSize,
+		maxBackups:   defaultAuditMaxBackups,
+		errorHandler: panicOnError,
+	}
+
+	for _, o := range opts {
+		o(a)
+	}
+
+	last, err := lastAuditHash(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		last, err = lastAuditHash(filename + ".1")
+	}
+
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	a.last = last
+
+	if err := a.open(); err != nil {
+		return nil, err
+	}
+
+	return a, nil
+}
+
+func lastAuditHash(filename string) (string, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return "", err
+	}
+
+	defer f.Close()
+
+	var (
+		last string
+		s    = bufio.NewScanner(f)
+	)
+
+	s.Buffer(nil, 1<<20)
+
+	for s.Scan() {
+		var line auditLine
+
+		if len(bytes.TrimSpace(s.Bytes())) == 0 {
+			continue
+		} else if err := json.Unmarshal(s.Bytes(), &line); err != nil {
+			return "", fmt.Errorf("error reading audit file (%s): %w", filename, err)
+		}
+
+		last = line.Hash
+	}
+
+	return last, s.Err()
+}
+
+func (a *AuditFile) open() error {
+	f, err := os.OpenFile(a.filename, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return err
+	}
+
+	stat, err := f.Stat()
+	if err != nil {
+		f.Close()
+
+		return err
+	}
+
+	a.file = f
+	a.size = stat.Size()
+
+	return nil
+}
+
+// The Audit method satisfies the AuditSink interface.
+func (a *AuditFile) Audit(record AuditRecord) {
+	if err := a.write(record); err != nil {
+		a.errorHandler(fmt.Errorf("error writing audit record: %w", err))
+	}
+}
+
+func (a *AuditFile) write(record AuditRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.file == nil {
+		return os.ErrClosed
+	}
+
+	line, err := json.Marshal(auditLine{
+		Record: data,
+		Prev:   a.last,
+		Hash:   auditHash(a.last, data),
+	})
+	if err != nil {
+		return err
+	}
+
+	line = append(line, '\n')
+
+	if a.maxSize > 0 && a.size > 0 && a.size+int64(len(line)) > a.maxSize {
+		if err := a.rotate(); err != nil {
+			return err
+		}
+	}
+
+	if _, err := a.file.Write(line); err != nil {
+		return err
+	} else if err := a.file.Sync(); err != nil {
+		return err
+	}
+
+	a.size += int64(len(line))
+	a.last = auditHash(a.last, data)
+
+	return nil
+}
+
+func auditHash(prev string, record []byte) string {
+	h := sha256.New()
+
+	io.WriteString(h, prev)
+	h.Write(record)
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func (a *AuditFile) rotate() error {
+	if err := a.file.Close(); err != nil {
+		return err
+	}
+
+	a.file = nil
+
+	if a.maxBackups > 0 {
+		os.Remove(a.filename + "." + strconv.Itoa(a.maxBackups))
+
+		for n := a.maxBackups - 1; n > 0; n-- {
+			if err := os.Rename(a.filename+"."+strconv.Itoa(n), a.filename+"."+strconv.Itoa(n+1)); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return err
+			}
+		}
+
+		if err := os.Rename(a.filename, a.filename+".1"); err != nil {
+			return err
+		}
+	} else if err := os.Remove(a.filename); err != nil {
+		return err
+	}
+
+	return a.open()
+}
+
+// The Close method closes the audit file.
+func (a *AuditFile) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.file == nil {
+		return nil
+	}
+
+	err := a.file.Close()
+	a.file = nil
+
+	return err
+}
+
+// The VerifyAuditLog function checks the hash chain of an audit file, as
+// written by an AuditFile, starting from the given prev hash, which should be
+// the last hash of the previous file, or an empty string for the first file.
+//
+// Returns the last hash in the file, which can be used to verify the next
+// file, and the number of records verified. If the chain is broken, the
+// returned error will wrap ErrAuditChain.
+func VerifyAuditLog(r io.Reader, prev string) (string, int, error) {
+	var (
+		count int
+		s     = bufio.NewScanner(r)
+	)
+
+	s.Buffer(nil, 1<<20)
+
+	for s.Scan() {
+		var line auditLine
+
+		if len(bytes.TrimSpace(s.Bytes())) == 0 {
+			continue
+		} else if err := json.Unmarshal(s.Bytes(), &line); err != nil {
+			return prev, count, fmt.Errorf("record %d: %w", count+1, err)
+		} else if line.Prev != prev || line.Hash != auditHash(prev, line.Record) {
+			return prev, count, fmt.Errorf("record %d: %w", count+1, ErrAuditChain)
+		}
+
+		prev = line.Hash
+		count++
+	}
+
+	return prev, count, s.Err()
+}
+
+// Errors.
+var ErrAuditChain = errors.New("audit hash chain broken")
@@ -0,0 +1,984 @@
+package furl
+
+import (
+	"container/list"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	btreePageSize         = 16384
+	btreeNodeHeader       = 7
+	btreeMaxEntry         = (btreePageSize - btreeNodeHeader) / 3
+	defaultBTreeCacheSize = 1024
+
+	btreeLeaf     = 1
+	btreeInternal = 2
+	btreeOverflow = 3
+
+	btreeOverflowRef  = 0xffff
+	btreeOverflowData = btreePageSize - 1
+
+	btreeMagic   = "FURLBT01"
+	journalMagic = "FURLJL01"
+)
+
+// The BTreeStore type is a disk-resident implementation of the Store
+// interface, which stores keys and URLs in a page based B-tree in a single
+// file. Only the pages needed to find a key are read, and a bounded number of
+// pages are cached in memory, so the store can hold more links than would fit
+// in memory.
+//
+// Each Tx is written to disk when it completes, using a rollback journal so
+// that the file can be restored to its previous state if the write is
+// interrupted.
+//
+// The BTreeStore implements the MetaStore and MetaRanger interfaces, iterating
+// over the keys in order, and its Tx implements the MetaTx and DeleteTx
+// interfaces. Any Meta is stored alongside the URL, separated by a NUL byte.
+// An entry too large to fit in a page is stored in its own overflow pages.
+//
+// If an error occurs during a Tx, none of its changes will be written.
+//
+// NB: Pages emptied by deleting keys, or by replacing entries stored in
+// overflow pages, are not reclaimed.
+type BTreeStore struct {
+	mu           sync.RWMutex
+	file         *os.File
+	journal      string
+	errorHandler func(error)
+
+	root, pages uint32
+	count       uint64
+
+	origRoot, origPages uint32
+	origCount           uint64
+	dirty               map[uint32]*btreeNode
+	overflow            map[uint32]string
+
+	cacheMu   sync.Mutex
+	cacheSize int
+	cache     map[uint32]*list.Element
+	lru       *list.List
+
+	crash bool // for testing interrupted writes
+}
+
+type btreeNode struct {
+	id       uint32
+	leaf     bool
+	next     uint32
+	keys     []string
+	values   []string
+	overflow []uint32
+	children []uint32
+}
+
+// The BTreeOption type is used to specify optional params to the
+// OpenBTreeStore function call.
+type BTreeOption func(*BTreeStore)
+
+// The BTreeCacheSize BTreeOption sets the maximum number of pages that will be
+// kept in memory. The default is 1024 pages, each of which is 16KB.
+func BTreeCacheSize(pages int) BTreeOption {
+	return func(b *BTreeStore) {
+		b.cacheSize = pages
+	}
+}
+
+// The BTreeErrorHandler BTreeOption sets a function that will be called with
+// any error that occurs while reading or writing the file.
+//
+// As the Store interface does not allow for errors to be returned, when an
+// error occurs a Get will report that the key does not exist, a Has will
+// report that it does, and a Set will be lost.
+//
+// By default, the error handler will panic.
+func BTreeErrorHandler(fn func(error)) BTreeOption {
+	return func(b *BTreeStore) {
+		b.errorHandler = fn
+	}
+}
+
+// OpenBTreeStore opens, or creates, the B-tree file with the given filename.
+//
+// If a previous write to the file was interrupted, the file will be restored
+// from its journal, which is stored alongside the file with a -journal suffix.
+func OpenBTreeStore(filename string, opts ...BTreeOption) (*BTreeStore, error) {
+	b := &BTreeStore{
+		journal:      filename + "-journal",
+		errorHandler: panicOnError,
+		cacheSize:    defaultBTreeCacheSize,
+		dirty:        make(map[uint32]*btreeNode),
+		overflow:     make(map[uint32]string),
+		cache:        make(map[uint32]*list.Element),
+		lru:          list.New(),
+	}
+
+	for _, o := range opts {
+		o(b)
+	}
+
+	f, err := os.OpenFile(filename, os.O_RDWR|os.O_CREATE, 0o666)
+	if err != nil {
+		return nil, err
+	}
+
+	b.file = f
+
+	if err := b.init(); err != nil {
+		f.Close()
+
+		return nil, err
+	}
+
+	return b, nil
+}
+
+func (b *BTreeStore) init() error {
+	if err := b.recover(); err != nil {
+		return fmt.Errorf("error recovering journal: %w", err)
+	}
+
+	stat, err := b.file.Stat()
+	if err != nil {
+		return err
+	}
+
+	if stat.Size() == 0 {
+		b.pages = 1
+		b.root = b.newNode(true).id
+
+		return b.commit()
+	}
+
+	var header [btreeNodeHeader + 21]byte
+
+	if _, err := b.file.ReadAt(header[:], 0); err != nil {
+		return err
+	} else if string(header[:8]) != btreeMagic || binary.LittleEndian.Uint32(header[8:]) != btreePageSize {
+		return ErrInvalidBTree
+	}
+
+	b.root = binary.LittleEndian.Uint32(header[12:])
+	b.pages = binary.LittleEndian.Uint32(header[16:])
+	b.count = binary.LittleEndian.Uint64(header[20:])
+	b.origRoot = b.root
+	b.origPages = b.pages
+	b.origCount = b.count
+
+	return nil
+}
+
+// The Close method closes the underlying file.
+func (b *BTreeStore) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.file.Close()
+}
+
+// The Len method returns the number of keys in the store.
+func (b *BTreeStore) Len() int {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	return int(b.count)
+}
+
+// The Get method satisfies the Store interface.
+func (b *BTreeStore) Get(key string) (string, bool) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	value, ok, err := b.get(key)
+	if err != nil {
+		b.errorHandler(err)
+	}
+
+	url, _ := splitValue(value)
+
+	return url, ok
+}
+
+// The GetMeta method satisfies the MetaStore interface.
+func (b *BTreeStore) GetMeta(key string) (Meta, bool) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	value, _, err := b.get(key)
+	if err != nil {
+		b.errorHandler(err)
+	}
+
+	_, meta := splitValue(value)
+
+	return decodeMeta(meta)
+}
+
+func splitValue(value string) (string, string) {
+	if pos := strings.IndexByte(value, 0); pos >= 0 {
+		return value[:pos], value[pos+1:]
+	}
+
+	return value, ""
+}
+
+func decodeMeta(data string) (Meta, bool) {
+	var meta Meta
+
+	if data == "" || json.Unmarshal([]byte(data), &meta) != nil {
+		return Meta{}, false
+	}
+
+	return meta, true
+}
+
+func (b *BTreeStore) get(key string) (string, bool, error) {
+	n, err := b.findLeaf(key)
+	if err != nil {
+		return "", false, err
+	}
+
+	if i := sort.SearchStrings(n.keys, key); i < len(n.keys) && n.keys[i] == key {
+		return n.values[i], true, nil
+	}
+
+	return "", false, nil
+}
+
+func (b *BTreeStore) findLeaf(key string) (*btreeNode, error) {
+	n, err := b.node(b.root)
+
+	for err == nil && !n.leaf {
+		n, err = b.node(n.children[childIndex(n.keys, key)])
+	}
+
+	return n, err
+}
+
+func childIndex(keys []string, key string) int {
+	return sort.Search(len(keys), func(i int) bool {
+		return keys[i] > key
+	})
+}
+
+// The Tx method satisfies the Store interface. All changes made during the Tx
+// are written to disk when the passed function returns, unless an error
+// occurred during the Tx, in which case all of its changes are discarded.
+func (b *BTreeStore) Tx(fn func(tx Tx)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	tx := &btreeTx{BTreeStore: b}
+
+	defer tx.rollback()
+
+	fn(tx)
+
+	if tx.err != nil {
+		return
+	} else if err := b.commit(); err != nil {
+		tx.fail(err)
+
+		return
+	}
+
+	tx.committed = true
+}
+
+// The Range method satisfies the Ranger interface, calling the function with
+// each key:url pair in key order.
+func (b *BTreeStore) Range(fn func(key, url string) bool) {
+	b.RangeFrom("", fn)
+}
+
+// The RangeMeta method satisfies the MetaRanger interface, calling the
+// function with each key:url pair, and its Meta, in key order.
+func (b *BTreeStore) RangeMeta(fn func(key, url string, meta Meta) bool) {
+	b.rangeFrom("", func(key, value string) bool {
+		url, data := splitValue(value)
+		meta, _ := decodeMeta(data)
+
+		return fn(key, url, meta)
+	})
+}
+
+// The RangeFrom method calls the function with each key:url pair, in key
+// order, starting with the first key that is equal to or greater than start.
+func (b *BTreeStore) RangeFrom(start string, fn func(key, url string) bool) {
+	b.rangeFrom(start, func(key, value string) bool {
+		url, _ := splitValue(value)
+
+		return fn(key, url)
+	})
+}
+
+func (b *BTreeStore) rangeFrom(start string, fn func(key, value string) bool) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	n, err := b.findLeaf(start)
+	if err != nil {
+		b.errorHandler(err)
+
+		return
+	}
+
+	for i := sort.SearchStrings(n.keys, start); err == nil; i = 0 {
+		for ; i < len(n.keys); i++ {
+			if !fn(n.keys[i], n.values[i]) {
+				return
+			}
+		}
+
+		if n.next == 0 {
+			return
+		}
+
+		n, err = b.node(n.next)
+	}
+
+	b.errorHandler(err)
+}
+
+type btreeTx struct {
+	*BTreeStore
+	err       error
+	committed bool
+}
+
+// fail records that the Tx has failed, so that its changes will be discarded,
+// before passing the error to the error handler.
+func (b *btreeTx) fail(err error) {
+	b.err = err
+
+	b.errorHandler(err)
+}
+
+// rollback discards the changes of a Tx that has not been committed, removing
+// any changed pages from the cache and restoring any pages that were
+// partially written.
+func (b *btreeTx) rollback() {
+	if b.committed {
+		return
+	}
+
+	b.cacheMu.Lock()
+
+	for id := range b.dirty {
+		if e, ok := b.cache[id]; ok {
+			b.lru.Remove(e)
+
+			delete(b.cache, id)
+		}
+	}
+
+	b.cacheMu.Unlock()
+
+	b.dirty = make(map[uint32]*btreeNode)
+	b.overflow = make(map[uint32]string)
+	b.root = b.origRoot
+	b.pages = b.origPages
+	b.count = b.origCount
+
+	if err := b.recover(); err != nil {
+		b.errorHandler(fmt.Errorf("error recovering journal: %w", err))
+	}
+}
+
+func (b *btreeTx) Has(key string) bool {
+	_, ok, err := b.get(key)
+	if err != nil {
+		b.fail(err)
+
+		return true
+	}
+
+	return ok
+}
+
+func (b *btreeTx) Set(key, url string) {
+	b.put(key, url)
+}
+
+func (b *btreeTx) GetMeta(key string) (Meta, bool) {
+	value, _, err := b.get(key)
+	if err != nil {
+		b.fail(err)
+	}
+
+	_, meta := splitValue(value)
+
+	return decodeMeta(meta)
+}
+
+func (b *btreeTx) Delete(key string) {
+	n, err := b.findLeaf(key)
+	if err != nil {
+		b.fail(err)
+
+		return
+	}
+
+	if i := sort.SearchStrings(n.keys, key); i < len(n.keys) && n.keys[i] == key {
+		n.keys = append(n.keys[:i], n.keys[i+1:]...)
+		n.values = append(n.values[:i], n.values[i+1:]...)
+		n.overflow = append(n.overflow[:i], n.overflow[i+1:]...)
+		b.dirty[n.id] = n
+		b.count--
+	}
+}
+
+func (b *btreeTx) SetMeta(key string, meta Meta) {
+	value, ok, err := b.get(key)
+	if err != nil {
+		b.fail(err)
+
+		return
+	} else if !ok {
+		return
+	}
+
+	data, err := json.Marshal(meta)
+	if err != nil {
+		b.fail(err)
+
+		return
+	}
+
+	url, _ := splitValue(value)
+
+	b.put(key, url+"\x00"+string(data))
+}
+
+func (b *btreeTx) put(key, value string) {
+	if b.err != nil {
+		return
+	} else if len(key)+12 > btreeMaxEntry {
+		b.fail(fmt.Errorf("key %s: %w", key, ErrEntryTooLarge))
+
+		return
+	}
+
+	var ref uint32
+
+	if len(key)+len(value)+4 > btreeMaxEntry {
+		ref = b.pages
+
+		for pos := 0; pos < len(value); pos += btreeOverflowData {
+			end := pos + btreeOverflowData
+			if end > len(value) {
+				end = len(value)
+			}
+
+			b.overflow[b.pages] = value[pos:end]
+			b.pages++
+		}
+	}
+
+	sepKey, splitID, split, err := b.insert(b.root, key, value, ref)
+	if err != nil {
+		b.fail(err)
+
+		return
+	}
+
+	if split {
+		root := b.newNode(false)
+		root.keys = []string{sepKey}
+		root.children = []uint32{b.root, splitID}
+		b.root = root.id
+	}
+}
+
+func (b *BTreeStore) insert(id uint32, key, url string, ref uint32) (string, uint32, bool, error) {
+	n, err := b.node(id)
+	if err != nil {
+		return "", 0, false, err
+	}
+
+	if n.leaf {
+		i := sort.SearchStrings(n.keys, key)
+
+		if i < len(n.keys) && n.keys[i] == key {
+			n.values[i] = url
+			n.overflow[i] = ref
+		} else {
+			n.keys = append(n.keys[:i], append([]string{key}, n.keys[i:]...)...)
+			n.values = append(n.values[:i], append([]string{url}, n.values[i:]...)...)
+			n.overflow = append(n.overflow[:i], append([]uint32{ref}, n.overflow[i:]...)...)
+			b.count++
+		}
+	} else {
+		i := childIndex(n.keys, key)
+
+		sepKey, splitID, split, err := b.insert(n.children[i], key, url, ref)
+		if err != nil || !split {
+			return "", 0, false, err
+		}
+
+		n.keys = append(n.keys[:i], append([]string{sepKey}, n.keys[i:]...)...)
+		n.children = append(n.children[:i+1], append([]uint32{splitID}, n.children[i+1:]...)...)
+	}
+
+	b.dirty[n.id] = n
+
+	if n.size() <= btreePageSize {
+		return "", 0, false, nil
+	}
+
+	sepKey, right := b.split(n)
+
+	return sepKey, right.id, true, nil
+}
+
+func (b *BTreeStore) split(n *btreeNode) (string, *btreeNode) {
+	right := b.newNode(n.leaf)
+	half := n.size() / 2
+	size := btreeNodeHeader
+	mid := 1
+
+	for ; mid < len(n.keys)-1; mid++ {
+		if size += n.entrySize(mid - 1); size >= half {
+			break
+		}
+	}
+
+	if n.leaf {
+		right.keys = append(right.keys, n.keys[mid:]...)
+		right.values = append(right.values, n.values[mid:]...)
+		right.overflow = append(right.overflow, n.overflow[mid:]...)
+		right.next = n.next
+		n.keys = n.keys[:mid:mid]
+		n.values = n.values[:mid:mid]
+		n.overflow = n.overflow[:mid:mid]
+		n.next = right.id
+
+		return right.keys[0], right
+	}
+
+	sepKey := n.keys[mid]
+	right.keys = append(right.keys, n.keys[mid+1:]...)
+	right.children = append(right.children, n.children[mid+1:]...)
+	n.keys = n.keys[:mid:mid]
+	n.children = n.children[: mid+1 : mid+1]
+
+	return sepKey, right
+}
+
+func (b *BTreeStore) newNode(leaf bool) *btreeNode {
+	n := &btreeNode{
+		id:   b.pages,
+		leaf: leaf,
+	}
+
+	b.pages++
+	b.dirty[n.id] = n
+
+	return n
+}
+
+func (n *btreeNode) entrySize(i int) int {
+	if n.leaf && n.overflow[i] != 0 {
+		return 12 + len(n.keys[i])
+	} else if n.leaf {
+		return 4 + len(n.keys[i]) + len(n.values[i])
+	}
+
+	return 6 + len(n.keys[i])
+}
+
+func (n *btreeNode) size() int {
+	size := btreeNodeHeader
+
+	for i := range n.keys {
+		size += n.entrySize(i)
+	}
+
+	return size
+}
+
+func (b *BTreeStore) node(id uint32) (*btreeNode, error) {
+	if n, ok := b.dirty[id]; ok {
+		return n, nil
+	}
+
+	b.cacheMu.Lock()
+	defer b.cacheMu.Unlock()
+
+	if e, ok := b.cache[id]; ok {
+		b.lru.MoveToFront(e)
+
+		return e.Value.(*btreeNode), nil
+	}
+
+	var page [btreePageSize]byte
+
+	if _, err := b.file.ReadAt(page[:], int64(id)*btreePageSize); err != nil {
+		return nil, fmt.Errorf("error reading page %d: %w", id, err)
+	}
+
+	n, err := decodeNode(id, page[:])
+	if err != nil {
+		return nil, err
+	}
+
+	for i, ref := range n.overflow {
+		if ref == 0 {
+			continue
+		} else if n.values[i], err = b.readOverflow(ref, int(binary.LittleEndian.Uint32([]byte(n.values[i])))); err != nil {
+			return nil, err
+		}
+	}
+
+	b.cacheNode(n)
+
+	return n, nil
+}
+
+// readOverflow reads an entry of the given length from the consecutive
+// overflow pages starting at the given page.
+func (b *BTreeStore) readOverflow(id uint32, l int) (string, error) {
+	pages := (l + btreeOverflowData - 1) / btreeOverflowData
+	data := make([]byte, pages*btreePageSize)
+
+	if _, err := b.file.ReadAt(data, int64(id)*btreePageSize); err != nil {
+		return "", fmt.Errorf("error reading overflow page %d: %w", id, err)
+	}
+
+	var sb strings.Builder
+
+	for page := data; len(page) > 0; page = page[btreePageSize:] {
+		if page[0] != btreeOverflow {
+			return "", fmt.Errorf("page %d: %w", id, ErrInvalidBTree)
+		}
+
+		n := l - sb.Len()
+		if n > btreeOverflowData {
+			n = btreeOverflowData
+		}
+
+		sb.Write(page[1 : 1+n])
+	}
+
+	return sb.String(), nil
+}
+
+func (b *BTreeStore) cacheNode(n *btreeNode) {
+	if e, ok := b.cache[n.id]; ok {
+		e.Value = n
+
+		b.lru.MoveToFront(e)
+
+		return
+	}
+
+	b.cache[n.id] = b.lru.PushFront(n)
+
+	for b.lru.Len() > b.cacheSize && b.lru.Len() > 0 {
+		delete(b.cache, b.lru.Remove(b.lru.Back()).(*btreeNode).id)
+	}
+}
+
+func decodeNode(id uint32, page []byte) (*btreeNode, error) {
+	n := &btreeNode{
+		id:   id,
+		leaf: page[0] == btreeLeaf,
+	}
+
+	if page[0] != btreeLeaf && page[0] != btreeInternal {
+		return nil, fmt.Errorf("page %d: %w", id, ErrInvalidBTree)
+	}
+
+	count := int(binary.LittleEndian.Uint16(page[1:]))
+	pos := btreeNodeHeader
+
+	if n.leaf {
+		n.next = binary.LittleEndian.Uint32(page[3:])
+	} else {
+		n.children = append(n.children, binary.LittleEndian.Uint32(page[3:]))
+	}
+
+	readString := func() (string, bool) {
+		if pos+2 > len(page) {
+			return "", false
+		}
+
+		l := int(binary.LittleEndian.Uint16(page[pos:]))
+		pos += 2
+
+		if pos+l > len(page) {
+			return "", false
+		}
+
+		s := string(page[pos : pos+l])
+		pos += l
+
+		return s, true
+	}
+
+	for i := 0; i < count; i++ {
+		key, ok := readString()
+		if !ok {
+			return nil, fmt.Errorf("page %d: %w", id, ErrInvalidBTree)
+		}
+
+		n.keys = append(n.keys, key)
+
+		if n.leaf && pos+2 <= len(page) && binary.LittleEndian.Uint16(page[pos:]) == btreeOverflowRef {
+			if pos+10 > len(page) {
+				return nil, fmt.Errorf("page %d: %w", id, ErrInvalidBTree)
+			}
+
+			n.overflow = append(n.overflow, binary.LittleEndian.Uint32(page[pos+2:]))
+			n.values = append(n.values, string(page[pos+6:pos+10])) // length, until read
+			pos += 10
+		} else if n.leaf {
+			url, ok := readString()
+			if !ok {
+				return nil, fmt.Errorf("page %d: %w", id, ErrInvalidBTree)
+			}
+
+			n.overflow = append(n.overflow, 0)
+			n.values = append(n.values, url)
+		} else if pos+4 > len(page) {
+			return nil, fmt.Errorf("page %d: %w", id, ErrInvalidBTree)
+		} else {
+			n.children = append(n.children, binary.LittleEndian.Uint32(page[pos:]))
+			pos += 4
+		}
+	}
+
+	return n, nil
+}
+
+func (n *btreeNode) encode(page []byte) {
+	binary.LittleEndian.PutUint16(page[1:], uint16(len(n.keys)))
+
+	if n.leaf {
+		page[0] = btreeLeaf
+
+		binary.LittleEndian.PutUint32(page[3:], n.next)
+	} else {
+		page[0] = btreeInternal
+
+		binary.LittleEndian.PutUint32(page[3:], n.children[0])
+	}
+
+	pos := btreeNodeHeader
+
+	writeString := func(s string) {
+		binary.LittleEndian.PutUint16(page[pos:], uint16(len(s)))
+		pos += 2 + copy(page[pos+2:], s)
+	}
+
+	for i, key := range n.keys {
+		writeString(key)
+
+		if n.leaf && n.overflow[i] != 0 {
+			binary.LittleEndian.PutUint16(page[pos:], btreeOverflowRef)
+			binary.LittleEndian.PutUint32(page[pos+2:], n.overflow[i])
+			binary.LittleEndian.PutUint32(page[pos+6:], uint32(len(n.values[i])))
+			pos += 10
+		} else if n.leaf {
+			writeString(n.values[i])
+		} else {
+			binary.LittleEndian.PutUint32(page[pos:], n.children[i+1])
+			pos += 4
+		}
+	}
+}
+
+func (b *BTreeStore) header(page []byte) {
+	copy(page, btreeMagic)
+	binary.LittleEndian.PutUint32(page[8:], btreePageSize)
+	binary.LittleEndian.PutUint32(page[12:], b.root)
+	binary.LittleEndian.PutUint32(page[16:], b.pages)
+	binary.LittleEndian.PutUint64(page[20:], b.count)
+}
+
+/*
+	The journal contains the original contents of each page that is about to be
+	overwritten, in the following format:
+
+	struct {
+		Magic     [8]byte
+		PageCount uint32
+		Pages     uint32
+		Page      [Pages]struct {
+			ID   uint32
+			Data [16384]byte
+		}
+		CRC32     uint32
+	}
+
+	The uint32s are stored in LittleEndian format. The PageCount is the number of
+	pages in the file before the write, which the file will be truncated to
+	when recovering.
+*/
+
+func (b *BTreeStore) commit() error {
+	if len(b.dirty) == 0 {
+		return nil
+	}
+
+	ids := make([]uint32, 0, len(b.dirty)+1)
+
+	if b.origPages > 0 {
+		ids = append(ids, 0)
+	}
+
+	for id := range b.dirty {
+		if id < b.origPages {
+			ids = append(ids, id)
+		}
+	}
+
+	if err := b.writeJournal(ids); err != nil {
+		return fmt.Errorf("error writing journal: %w", err)
+	}
+
+	var page [btreePageSize]byte
+
+	b.header(page[:])
+
+	if _, err := b.file.WriteAt(page[:], 0); err != nil {
+		return err
+	}
+
+	b.cacheMu.Lock()
+	defer b.cacheMu.Unlock()
+
+	for id, n := range b.dirty {
+		page = [btreePageSize]byte{}
+
+		n.encode(page[:])
+
+		if _, err := b.file.WriteAt(page[:], int64(id)*btreePageSize); err != nil {
+			return err
+		}
+
+		b.cacheNode(n)
+	}
+
+	for id, data := range b.overflow {
+		page = [btreePageSize]byte{btreeOverflow}
+
+		copy(page[1:], data)
+
+		if _, err := b.file.WriteAt(page[:], int64(id)*btreePageSize); err != nil {
+			return err
+		}
+	}
+
+	if b.crash {
+		return nil
+	}
+
+	if err := b.file.Sync(); err != nil {
+		return err
+	}
+
+	b.dirty = make(map[uint32]*btreeNode)
+	b.overflow = make(map[uint32]string)
+	b.origRoot = b.root
+	b.origPages = b.pages
+	b.origCount = b.count
+
+	return os.Remove(b.journal)
+}
+
+func (b *BTreeStore) writeJournal(ids []uint32) error {
+	j, err := os.Create(b.journal)
+	if err != nil {
+		return err
+	}
+
+	defer j.Close()
+
+	crc := crc32.NewIEEE()
+	w := io.MultiWriter(j, crc)
+
+	var (
+		header [16]byte
+		page   [btreePageSize + 4]byte
+	)
+
+	copy(header[:], journalMagic)
+	binary.LittleEndian.PutUint32(header[8:], b.origPages)
+	binary.LittleEndian.PutUint32(header[12:], uint32(len(ids)))
+
+	if _, err := w.Write(header[:]); err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		binary.LittleEndian.PutUint32(page[:], id)
+
+		if _, err := b.file.ReadAt(page[4:], int64(id)*btreePageSize); err != nil {
+			return err
+		} else if _, err := w.Write(page[:]); err != nil {
+			return err
+		}
+	}
+
+	binary.LittleEndian.PutUint32(header[:], crc.Sum32())
+
+	if _, err := j.Write(header[:4]); err != nil {
+		return err
+	}
+
+	return j.Sync()
+}
+
+func (b *BTreeStore) recover() error {
+	data, err := os.ReadFile(b.journal)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	const entrySize = btreePageSize + 4
+
+	if len(data) < 20 || string(data[:8]) != journalMagic {
+		return os.Remove(b.journal) // incomplete journal; file unchanged
+	}
+
+	pages := int(binary.LittleEndian.Uint32(data[12:]))
+
+	if len(data) != 20+pages*entrySize || crc32.ChecksumIEEE(data[:len(data)-4]) != binary.LittleEndian.Uint32(data[len(data)-4:]) {
+		return os.Remove(b.journal) // incomplete journal; file unchanged
+	}
+
+	for i := 0; i < pages; i++ {
+		entry := data[16+i*entrySize : 16+(i+1)*entrySize]
+
+		if _, err := b.file.WriteAt(entry[4:], int64(binary.LittleEndian.Uint32(entry))*btreePageSize); err != nil {
+			return err
+		}
+	}
+
+	if err := b.file.Truncate(int64(binary.LittleEndian.Uint32(data[8:])) * btreePageSize); err != nil {
+		return err
+	} else if err := b.file.Sync(); err != nil {
+		return err
+	}
+
+	return os.Remove(b.journal)
+}
+
+// Errors.
+var (
+	ErrInvalidBTree  = errors.New("invalid btree file")
+	ErrEntryTooLarge = errors.New("key too large")
+)
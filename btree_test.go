@@ -0,0 +1,211 @@
+package furl
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestBTreeStore(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "furl.btree")
+	b, err := OpenBTreeStore(filename, BTreeCacheSize(4))
+	if err != nil {
+		t.Fatalf("unexpected error opening: %s", err)
+	}
+	data := make(map[string]string)
+	keys := make([]string, 0, 5000)
+	r := rand.New(rand.NewSource(0))
+	for _, n := range r.Perm(5000) {
+		key := fmt.Sprintf("%05d", n)
+		url := fmt.Sprintf("http://www.example.com/%d/%s", n, strings.Repeat("a", n%200))
+		data[key] = url
+		keys = append(keys, key)
+		b.Tx(func(tx Tx) {
+			if tx.Has(key) {
+				t.Fatalf("key %s should not exist", key)
+			}
+			tx.Set(key, url)
+		})
+	}
+	sort.Strings(keys)
+	check := func(b *BTreeStore) {
+		t.Helper()
+		if l := b.Len(); l != len(data) {
+			t.Errorf("expecting %d keys, got %d", len(data), l)
+		}
+		for key, url := range data {
+			if got, ok := b.Get(key); !ok || got != url {
+				t.Fatalf("key %s: expecting url %q, got %q (%v)", key, url, got, ok)
+			}
+		}
+		if _, ok := b.Get("missing"); ok {
+			t.Error("expecting missing key not to exist")
+		}
+		var got []string
+		b.Range(func(key, url string) bool {
+			got = append(got, key)
+			return true
+		})
+		if !sort.StringsAreSorted(got) || len(got) != len(keys) {
+			t.Errorf("expecting %d ordered keys, got %d", len(keys), len(got))
+		}
+	}
+	check(b) // 1
+	var from []string
+	b.RangeFrom("02500", func(key, url string) bool {
+		from = append(from, key)
+		return len(from) < 3
+	})
+	if strings.Join(from, ",") != "02500,02501,02502" {
+		t.Errorf("expecting keys from 02500, got %v", from)
+	}
+	b.Tx(func(tx Tx) {
+		tx.Set("00001", "http://www.example.com/changed")
+	})
+	data["00001"] = "http://www.example.com/changed"
+	check(b) // 2
+	if err := b.Close(); err != nil {
+		t.Fatalf("unexpected error closing: %s", err)
+	}
+	if b, err = OpenBTreeStore(filename); err != nil {
+		t.Fatalf("unexpected error reopening: %s", err)
+	}
+	check(b) // 3
+	b.crash = true
+	b.Tx(func(tx Tx) {
+		for i := 0; i < 1000; i++ {
+			tx.Set(fmt.Sprintf("X%05d", i), "http://www.example.com/lost")
+		}
+		tx.Set("00002", "http://www.example.com/lost")
+	})
+	b.Close()
+	if _, err := os.Stat(filename + "-journal"); err != nil {
+		t.Fatalf("expecting journal to exist: %s", err)
+	}
+	if b, err = OpenBTreeStore(filename); err != nil {
+		t.Fatalf("unexpected error recovering: %s", err)
+	}
+	check(b) // 4
+	if _, err := os.Stat(filename + "-journal"); !os.IsNotExist(err) {
+		t.Errorf("expecting journal to be removed, got %v", err)
+	}
+	b.Close()
+}
+
+func TestBTreeStoreOverflow(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "furl.btree")
+	b, err := OpenBTreeStore(filename, BTreeCacheSize(4))
+	if err != nil {
+		t.Fatalf("unexpected error opening: %s", err)
+	}
+	meta := Meta{Description: strings.Repeat("a", maxDescriptionLength), Password: "hash", Destinations: make([]Destination, maxDestinations)}
+	for n := range meta.Destinations {
+		meta.Destinations[n].URL = "http://www.example.com/" + strings.Repeat("b", 1000)
+	}
+	for n := 0; n < 20; n++ {
+		key := fmt.Sprintf("%02d", n)
+		b.Tx(func(tx Tx) {
+			tx.Set(key, "http://www.example.com/"+key)
+			tx.(MetaTx).SetMeta(key, meta)
+		})
+	}
+	b.Tx(func(tx Tx) {
+		tx.(DeleteTx).Delete("05")
+		tx.Set("06", "http://www.example.com/changed")
+	})
+	check := func(b *BTreeStore) {
+		t.Helper()
+		for n := 0; n < 20; n++ {
+			key := fmt.Sprintf("%02d", n)
+			url, ok := b.Get(key)
+			m, hasMeta := b.GetMeta(key)
+			switch n {
+			case 5:
+				if ok {
+					t.Errorf("key %s: expecting key to be deleted", key)
+				}
+			case 6:
+				if url != "http://www.example.com/changed" || hasMeta {
+					t.Errorf("key %s: expecting changed url without meta, got %q, %v", key, url, hasMeta)
+				}
+			default:
+				if url != "http://www.example.com/"+key || !hasMeta || m.Password != "hash" || len(m.Destinations) != maxDestinations || m.Destinations[0].URL != meta.Destinations[0].URL {
+					t.Errorf("key %s: expecting url and meta to be stored, got %q, %v", key, url, hasMeta)
+				}
+			}
+		}
+	}
+	check(b) // 1
+	b.Close()
+	if b, err = OpenBTreeStore(filename, BTreeCacheSize(4)); err != nil {
+		t.Fatalf("unexpected error reopening: %s", err)
+	}
+	check(b) // 2
+	b.Close()
+}
+
+func TestBTreeStoreRollback(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "furl.btree")
+	var errs []error
+	b, err := OpenBTreeStore(filename, BTreeErrorHandler(func(err error) {
+		errs = append(errs, err)
+	}))
+	if err != nil {
+		t.Fatalf("unexpected error opening: %s", err)
+	}
+	b.Tx(func(tx Tx) {
+		tx.Set("AAA", "http://www.example.com/")
+	})
+	b.Tx(func(tx Tx) {
+		tx.Set("BBB", "http://www.example.com/lost")
+		tx.Set("AAA", "http://www.example.com/lost")
+		tx.Set(strings.Repeat("C", btreeMaxEntry), "http://www.example.com/")
+		tx.Set("DDD", "http://www.example.com/lost")
+	})
+	if len(errs) != 1 || !errors.Is(errs[0], ErrEntryTooLarge) {
+		t.Errorf("expecting ErrEntryTooLarge, got %v", errs)
+	}
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("expecting panic")
+			}
+		}()
+		b.errorHandler = panicOnError
+		b.Tx(func(tx Tx) {
+			tx.Set("EEE", "http://www.example.com/lost")
+			tx.Set(strings.Repeat("C", btreeMaxEntry), "http://www.example.com/")
+		})
+	}()
+	b.Tx(func(tx Tx) {
+		tx.Set("FFF", "http://www.example.com/f")
+	})
+	check := func(b *BTreeStore) {
+		t.Helper()
+		if url, _ := b.Get("AAA"); url != "http://www.example.com/" {
+			t.Errorf("expecting url to be unchanged, got %q", url)
+		}
+		for _, key := range [...]string{"BBB", "DDD", "EEE"} {
+			if _, ok := b.Get(key); ok {
+				t.Errorf("key %s: expecting key not to be set", key)
+			}
+		}
+		if url, _ := b.Get("FFF"); url != "http://www.example.com/f" {
+			t.Errorf("expecting url to be set, got %q", url)
+		} else if l := b.Len(); l != 2 {
+			t.Errorf("expecting 2 keys, got %d", l)
+		}
+	}
+	check(b) // 1
+	b.Close()
+	if b, err = OpenBTreeStore(filename); err != nil {
+		t.Fatalf("unexpected error reopening: %s", err)
+	}
+	check(b) // 2
+	b.Close()
+}
@@ -0,0 +1,62 @@
+package furl
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+func sameKey(key string) string {
+	return key
+}
+
+// The FoldCase function is a key canonicalisation function, for use with the
+// Canonicalise Option, that makes keys case-insensitive.
+func FoldCase(key string) string {
+	return strings.ToLower(key)
+}
+
+// The FoldUnicode function is a key canonicalisation function, for use with
+// the Canonicalise Option, that makes Unicode keys case-insensitive.
+//
+// Keys are Unicode case folded and converted to Normal Form KC, so that, for
+// example, full width letters are treated the same as their usual forms.
+func FoldUnicode(key string) string {
+	return norm.NFKC.String(cases.Fold().String(key))
+}
+
+// The FoldLookalikes function is a key canonicalisation function, for use with
+// the Canonicalise Option, that makes keys case-insensitive and also treats
+// characters that are easily confused for one another as the same character:
+//
+//	0, O, and o
+//	1, I, i, L, and l
+func FoldLookalikes(key string) string {
+	return strings.Map(func(r rune) rune {
+		switch r = unicode.ToLower(r); r {
+		case '0':
+			return 'o'
+		case '1', 'i':
+			return 'l'
+		}
+
+		return r
+	}, key)
+}
+
+// canonical returns the canonical form of the key, used to store and look up
+// the key, along with the Meta to be stored with it, which records the key as
+// given when it differs from its canonical form.
+func (f *Furl) canonical(key string, meta *Meta) (string, *Meta) {
+	canonical := f.canonicalise(key)
+	if canonical == key || meta == nil {
+		return canonical, meta
+	}
+
+	m := *meta
+	m.Display = key
+
+	return canonical, &m
+}
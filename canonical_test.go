@@ -0,0 +1,94 @@
+package furl
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCanonicalise(t *testing.T) {
+	for n, test := range [...]struct {
+		Fn             func(string) string
+		Key, Canonical string
+	}{
+		{ // 1
+			Fn:        FoldCase,
+			Key:       "AbC10",
+			Canonical: "abc10",
+		},
+		{ // 2
+			Fn:        FoldLookalikes,
+			Key:       "AbC10",
+			Canonical: "abclo",
+		},
+		{ // 3
+			Fn:        FoldLookalikes,
+			Key:       "OIlLi0",
+			Canonical: "ollllo",
+		},
+		{ // 4
+			Fn:        FoldCase,
+			Key:       "Ａｂｃ",
+			Canonical: "ａｂｃ",
+		},
+		{ // 5
+			Fn:        FoldUnicode,
+			Key:       "Ａｂｃ",
+			Canonical: "abc",
+		},
+		{ // 6
+			Fn:        FoldUnicode,
+			Key:       "Straße",
+			Canonical: "strasse",
+		},
+	} {
+		if canonical := test.Fn(test.Key); canonical != test.Canonical {
+			t.Errorf("test %d: expecting canonical key %q, got %q", n+1, test.Canonical, canonical)
+		}
+	}
+	s := NewStore()
+	f := New(SetStore(s), Canonicalise(FoldLookalikes))
+	if code := post(f, "AbC10", "http://www.example.com/"); code != http.StatusOK {
+		t.Fatalf("expecting response code 200, got %d", code)
+	} else if code := post(f, "ABCLO", "http://www.example.com/other"); code != http.StatusMethodNotAllowed {
+		t.Errorf("expecting response code 405, got %d", code)
+	} else if meta, _ := s.(MetaStore).GetMeta("abclo"); meta.Display != "AbC10" {
+		t.Errorf("expecting display key %q, got %q", "AbC10", meta.Display)
+	}
+	for n, test := range [...]struct {
+		Method, Path string
+		Code         int
+	}{
+		{ // 1
+			Method: http.MethodGet,
+			Path:   "/abcio",
+			Code:   http.StatusMovedPermanently,
+		},
+		{ // 2
+			Method: http.MethodGet,
+			Path:   "/ABC1O/history",
+			Code:   http.StatusOK,
+		},
+		{ // 3
+			Method: http.MethodOptions,
+			Path:   "/aBcLo",
+			Code:   http.StatusNoContent,
+		},
+		{ // 4
+			Method: http.MethodGet,
+			Path:   "/abcd",
+			Code:   http.StatusNotFound,
+		},
+	} {
+		w := httptest.NewRecorder()
+		f.ServeHTTP(w, httptest.NewRequest(test.Method, test.Path, nil))
+		if w.Code != test.Code {
+			t.Errorf("test %d: expecting response code %d, got %d", n+1, test.Code, w.Code)
+		} else if test.Method == http.MethodOptions && w.Header().Get("Allow") != optionsGetHead {
+			t.Errorf("test %d: expecting Allow header %q, got %q", n+1, optionsGetHead, w.Header().Get("Allow"))
+		}
+	}
+	if err := f.Delete("ABC10"); err != nil {
+		t.Errorf("unexpected error deleting: %s", err)
+	}
+}
@@ -1,15 +1,15 @@
 package main
 
 import (
-	"bufio"
 	"context"
 	_ "embed"
+	"errors"
 	"flag"
 	"fmt"
 	"html/template"
-	"io"
 	"net"
 	"net/http"
+	"net/netip"
 	"os"
 	"os/signal"
 	"path"
@@ -21,6 +21,8 @@ import (
 //go:embed index.tmpl
 var index string
 
+const expandPath = "expand"
+
 func main() {
 	if err := run(); err != nil {
 		fmt.Fprintln(os.Stderr, err)
@@ -38,18 +40,83 @@ func keyValidator(key string) bool {
 }
 
 type tmplVars struct {
-	Success, URL, URLError, Key, KeyError string
-	NotFound                              bool
+	Success, URL, URLError, Key, KeyError, Preview, PasswordError, NotBefore, Leaving string
+	NotFound, Gone, Password                                                          bool
+}
+
+func loadReserved(file string) (*furl.ReservedKeys, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, fmt.Errorf("error opening reserved keys file (%s): %w", file, err)
+	}
+	defer f.Close()
+	r, err := furl.LoadReservedKeys(f)
+	if err != nil {
+		return nil, fmt.Errorf("error loading reserved keys file (%s): %w", file, err)
+	}
+	return r, nil
+}
+
+func parseProxies(list string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, proxy := range strings.Split(list, ",") {
+		if proxy = strings.TrimSpace(proxy); proxy == "" {
+			continue
+		} else if prefix, err := netip.ParsePrefix(proxy); err == nil {
+			prefixes = append(prefixes, prefix.Masked())
+		} else if addr, err := netip.ParseAddr(proxy); err == nil {
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+		} else {
+			return nil, fmt.Errorf("invalid trusted proxy address (%s)", proxy)
+		}
+	}
+	return prefixes, nil
 }
 
 func run() error {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "export":
+			return exportData(os.Args[2:])
+		case "import":
+			return importData(os.Args[2:])
+		case "migrate":
+			return migrate(os.Args[2:])
+		case "snapshot":
+			return snapshot(os.Args[2:])
+		}
+	}
+	return serve(os.Args[1:])
+}
+
+func serve(args []string) error {
 	tmpl := template.Must(template.New("").Parse(index))
-	file := flag.String("f", "", "filename to store key:url map data")
-	port := flag.Int("p", 8080, "port for server to listen on")
-	serverURL := flag.String("s", "", "base server url. e.g. http://furl.com/")
-	flag.Parse()
+	flags := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	file := flags.String("f", "", "filename to store key:url map data")
+	backend := flags.String("b", "", "backend to store key:url map data in, instead of a file. e.g. redis://localhost:6379/0?prefix=furl:")
+	port := flags.Int("p", 8080, "port for server to listen on")
+	serverURL := flags.String("s", "", "base server url. e.g. http://furl.com/")
+	adminAddr := flags.String("a", "", "address for the admin server to listen on. e.g. 127.0.0.1:8081")
+	restore := flags.String("r", "", "filename of a snapshot to start the server from")
+	replicationAddr := flags.String("ra", "", "address for the replication change stream to listen on. e.g. :8082")
+	primaryURL := flags.String("replica", "", "url of the replication change stream of a primary to follow. e.g. http://primary:8082/")
+	forward := flags.String("forward", "", "url of the primary server to forward POST requests to when running as a replica")
+	token := flags.String("rt", "", "token used to authenticate the replication change stream; required with -ra")
+	auditFile := flags.String("audit", "", "filename to write the audit log of all changes to")
+	auditSize := flags.Int64("audit-size", 100<<20, "size, in bytes, at which the audit log will be rotated")
+	unicodeKeys := flags.Bool("unicode", false, "allow keys containing letters from any script, and emoji")
+	canonical := flags.String("canonical", "", "how keys are matched, ignoring differences in: case, or lookalikes (case and characters such as 0/O and 1/l/I)")
+	reserved := flags.String("reserved", "", "filename of a list of reserved keys that cannot be used")
+	interstitial := flags.Bool("interstitial", false, "show a confirmation page before leaving for another site, instead of redirecting")
+	trusted := flags.String("trusted", "", "comma separated list of domains that are redirected to without the interstitial confirmation page")
+	sticky := flags.Duration("sticky", 0, "how long a visitor is sent to the same destination of a link with multiple destinations; zero chooses for each visit")
+	geoip := flags.String("geoip", "", "filename of a GeoIP database, in MaxMind DB format, used to match the country rules of links")
+	proxies := flags.String("proxies", "", "comma separated list of addresses, or CIDR ranges, of trusted proxies whose X-Forwarded-For header is used to find the client address")
+	quarantine := flags.Duration("quarantine", 0, "how long a deleted key is kept out of use before it can be reused; zero keeps it until purged")
+	flags.Parse(args)
 
 	furlParams := []furl.Option{
+		furl.Quarantine(*quarantine),
 		furl.URLValidator(furl.HTTPURL),
 		furl.KeyValidator(keyValidator),
 		furl.Index(func(w http.ResponseWriter, r *http.Request, code int, data string) {
@@ -60,10 +127,26 @@ func run() error {
 					return
 				}
 				var tv tmplVars
-				if code == http.StatusNotFound && !isRoot {
+				if code == http.StatusOK {
+					tv.Key = strings.TrimSuffix(path.Base("/"+r.URL.Path), "+")
+					tv.Preview = data
+				} else if code == http.StatusNotFound && !isRoot {
 					w.WriteHeader(code)
 					tv.NotFound = true
 					tv.Key = path.Base("/" + r.URL.Path)
+				} else if code == http.StatusGone {
+					w.WriteHeader(code)
+					tv.Gone = true
+				} else if code == http.StatusForbidden {
+					w.WriteHeader(code)
+					tv.NotBefore = data
+				} else if code == http.StatusUnauthorized || code == http.StatusTooManyRequests {
+					w.WriteHeader(code)
+					tv.Password = true
+					tv.Key = path.Base("/" + r.URL.Path)
+					if code == http.StatusTooManyRequests {
+						tv.PasswordError = "Too Many Attempts"
+					}
 				}
 				tmpl.Execute(w, tv)
 			} else if r.Method == http.MethodPost {
@@ -78,99 +161,201 @@ func run() error {
 					tv.URLError = "Invalid URL"
 				case http.StatusUnprocessableEntity:
 					tv.KeyError = "Invalid Alias"
+				case http.StatusForbidden:
+					tv.KeyError = "Reserved Alias"
 				case http.StatusMethodNotAllowed:
 					tv.KeyError = "Alias Exists"
+				case http.StatusNotImplemented:
+					tv.URLError = "Restrictions Not Supported"
+				case http.StatusUnauthorized:
+					tv.Password = true
+					tv.Key = path.Base("/" + r.URL.Path)
+					tv.PasswordError = "Incorrect Password"
+				case http.StatusTooManyRequests:
+					tv.Password = true
+					tv.Key = path.Base("/" + r.URL.Path)
+					tv.PasswordError = "Too Many Attempts"
 				}
 				tmpl.Execute(w, tv)
 			}
 		}),
 	}
 
-	if *file != "" { // if we're loading a file-back store
-		f, err := os.OpenFile(*file, os.O_RDWR|os.O_CREATE, 0o666)
-		if err != nil {
-			return fmt.Errorf("error opening database file (%s): %w", *file, err)
+	if *unicodeKeys {
+		furlParams = append(furlParams, furl.KeyValidator(furl.UnicodeKey))
+	}
+	switch *canonical {
+	case "":
+		if *unicodeKeys {
+			furlParams = append(furlParams, furl.Canonicalise(furl.NFC))
 		}
-		defer f.Close()
-		data := make(map[string]string)
-		b := bufio.NewReader(f)
-		var length [2]byte
-
-		/*
-			Each key:url pair is stored sequentially and according to the following format:
-
-			struct {
-				KeyLength uint16
-				Key       [KeyLength]byte
-				URLLength uint16
-				URL       [URLLength]byte
+	case "case":
+		if *unicodeKeys {
+			furlParams = append(furlParams, furl.Canonicalise(furl.FoldUnicode))
+		} else {
+			furlParams = append(furlParams, furl.Canonicalise(furl.FoldCase))
+		}
+	case "lookalikes":
+		furlParams = append(furlParams, furl.Canonicalise(furl.FoldLookalikes))
+	default:
+		return fmt.Errorf("unknown canonical key mode: %s", *canonical)
+	}
+	reservedKeys, err := furl.NewReservedKeys()
+	if err != nil {
+		return err
+	}
+	if *reserved != "" {
+		if reservedKeys, err = loadReserved(*reserved); err != nil {
+			return err
+		}
+	}
+	if err := reservedKeys.Add(expandPath); err != nil {
+		return err
+	}
+	furlParams = append(furlParams, furl.Reserved(reservedKeys))
+	if *serverURL != "" {
+		furlParams = append(furlParams, furl.BaseURL(*serverURL))
+	}
+	if *interstitial {
+		var domains []string
+		for _, domain := range strings.Split(*trusted, ",") {
+			if domain = strings.TrimSpace(domain); domain != "" {
+				domains = append(domains, domain)
 			}
+		}
+		furlParams = append(furlParams, furl.Interstitial(domains...))
+	}
+	furlParams = append(furlParams, furl.InterstitialPage(func(w http.ResponseWriter, r *http.Request, url string) {
+		tmpl.Execute(w, tmplVars{Preview: url, Leaving: r.Host})
+	}))
+	if *sticky > 0 {
+		furlParams = append(furlParams, furl.StickyDestinations("furl", *sticky))
+	}
+	if *geoip != "" {
+		db, err := furl.OpenMMDB(*geoip)
+		if err != nil {
+			return fmt.Errorf("error loading geoip database (%s): %w", *geoip, err)
+		}
+		furlParams = append(furlParams, furl.GeoIP(db))
+	}
+	if *proxies != "" {
+		prefixes, err := parseProxies(*proxies)
+		if err != nil {
+			return err
+		}
+		furlParams = append(furlParams, furl.TrustedProxies(prefixes...))
+	}
 
-			The uint16s are store in LittleEndian format.
-		*/
-
-		for {
-			if _, err := io.ReadFull(b, length[:]); err != nil && err != io.EOF {
-				return fmt.Errorf("error reading key length: %w", err)
-			}
-			keyLength := int(length[0]) | (int(length[1]) << 8)
-			if keyLength == 0 {
-				break
-			}
-			key := make([]byte, keyLength)
-			if _, err = io.ReadFull(b, key); err != nil {
-				return fmt.Errorf("error reading key: %w", err)
-			}
-			if _, err := io.ReadFull(b, length[:]); err != nil && err != io.EOF {
-				return fmt.Errorf("error reading url length: %w", err)
-			}
-			if urlLength := int(length[0]) | (int(length[1]) << 8); urlLength > 0 {
-				url := make([]byte, urlLength)
-				if _, err = io.ReadFull(b, url); err != nil {
-					return fmt.Errorf("error reading url: %w", err)
-				}
-				data[string(key)] = string(url)
-			}
-			length[0] = 0
-			length[1] = 0
-		}
-		w := bufio.NewWriter(f)
-		furlParams = append(furlParams, furl.SetStore(furl.NewStore(furl.Data(data), furl.Save(func(key, url string) {
-			length[0] = byte(len(key))
-			length[1] = byte(len(key) >> 8)
-			if _, err := w.Write(length[:]); err != nil {
-				panic(fmt.Errorf("error while writing key length: %w", err))
-			}
-			if _, err := w.WriteString(key); err != nil {
-				panic(fmt.Errorf("error while writing key: %w", err))
-			}
-			length[0] = byte(len(url))
-			length[1] = byte(len(url) >> 8)
-			if _, err := w.Write(length[:]); err != nil {
-				panic(fmt.Errorf("error while writing url length: %w", err))
-			}
-			if _, err := w.WriteString(url); err != nil {
-				panic(fmt.Errorf("error while writing url: %w", err))
-			}
-			if err := w.Flush(); err != nil {
-				panic(fmt.Errorf("error while flushing buffers: %w", err))
-			}
-			if err := f.Sync(); err != nil {
-				panic(fmt.Errorf("error while syncing file: %w", err))
-			}
-		}))))
+	var store furl.Store
+	if *backend != "" {
+		s, c, err := openBackend(*backend)
+		if err != nil {
+			return err
+		}
+		defer c.Close()
+		store = s
+	} else if *file != "" { // if we're loading a file-back store
+		s, f, err := openStore(*file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		store = s
+	}
+	if *restore != "" {
+		s, err := restoreSnapshot(*restore, store)
+		if err != nil {
+			return err
+		}
+		store = s
+	}
+	if store == nil {
+		store = furl.NewStore()
+	}
+	var primary *furl.Primary
+	if *replicationAddr != "" {
+		if *token == "" {
+			return errors.New("a replication token (-rt) is required to serve the change stream")
+		}
+		p, err := furl.NewPrimary(store, *token)
+		if err != nil {
+			return err
+		}
+		primary = p
+		store = primary
+	}
+	var replica *furl.Replica
+	if *primaryURL != "" {
+		r, err := newReplica(store, *primaryURL, *token, *forward, *file)
+		if err != nil {
+			return err
+		}
+		replica = r
+		store = r
+	}
+	furlParams = append(furlParams, furl.SetStore(store))
+	if *auditFile != "" {
+		a, err := furl.OpenAuditFile(*auditFile, furl.AuditMaxSize(*auditSize), furl.AuditErrorHandler(func(err error) {
+			fmt.Fprintln(os.Stderr, err)
+		}))
+		if err != nil {
+			return fmt.Errorf("error opening audit log: %w", err)
+		}
+		defer a.Close()
+		furlParams = append(furlParams, furl.Audit(a))
 	}
 	l, err := net.ListenTCP("tcp", &net.TCPAddr{Port: *port})
 	if err != nil {
 		return fmt.Errorf("error listening on port %d: %w", *port, err)
 	}
 
+	f := furl.New(furlParams...)
+	var handler http.Handler = f
+	if replica != nil {
+		handler = replica.Handler(f)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go func() {
+			if err := replica.Run(ctx); !errors.Is(err, context.Canceled) {
+				fmt.Fprintln(os.Stderr, "error following primary:", err)
+			}
+		}()
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/", handler)
+	mux.Handle("/"+expandPath, f.Expand())
 	server := &http.Server{
-		Handler: furl.New(furlParams...),
+		Handler: mux,
 	}
 
 	go server.Serve(l)
 
+	if primary != nil {
+		rl, err := net.Listen("tcp", *replicationAddr)
+		if err != nil {
+			server.Close()
+			return fmt.Errorf("error listening on replication address %s: %w", *replicationAddr, err)
+		}
+		replicationServer := &http.Server{
+			Handler: primary,
+		}
+		go replicationServer.Serve(rl)
+		defer replicationServer.Close()
+	}
+
+	if *adminAddr != "" {
+		al, err := net.Listen("tcp", *adminAddr)
+		if err != nil {
+			server.Close()
+			return fmt.Errorf("error listening on admin address %s: %w", *adminAddr, err)
+		}
+		adminServer := &http.Server{
+			Handler: f.Admin(),
+		}
+		go adminServer.Serve(al)
+		defer adminServer.Shutdown(context.Background())
+	}
+
 	// wait for SIGINT
 
 	sc := make(chan os.Signal, 1)
@@ -179,5 +364,7 @@ func run() error {
 	signal.Stop(sc)
 	close(sc)
 
-	return server.Shutdown(context.Background())
+	err = server.Shutdown(context.Background())
+	f.FlushServed()
+	return err
 }
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"vimagination.zapto.org/furl"
+)
+
+type source struct {
+	furl.Ranger
+	io.Closer
+	follow func(fn func(key, url string), metaFn func(key string, meta furl.Meta)) error
+}
+
+func openBackend(spec string) (furl.Store, io.Closer, error) {
+	scheme, path := parseBackend(spec)
+	switch scheme {
+	case "file":
+		return openStore(path)
+	case "redis":
+		return openRedis(spec)
+	case "btree":
+		b, err := furl.OpenBTreeStore(path)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error opening btree file (%s): %w", path, err)
+		}
+		return b, b, nil
+	}
+	return nil, nil, fmt.Errorf("unknown backend: %s", scheme)
+}
+
+func parseBackend(spec string) (string, string) {
+	if pos := strings.Index(spec, ":"); pos > 0 {
+		return spec[:pos], spec[pos+1:]
+	}
+	return "file", spec
+}
+
+func openSource(spec string) (*source, error) {
+	scheme, path := parseBackend(spec)
+	if scheme != "file" {
+		store, closer, err := openBackend(spec)
+		if err != nil {
+			return nil, err
+		}
+		r, ok := store.(furl.Ranger)
+		if !ok {
+			closer.Close()
+			return nil, fmt.Errorf("backend cannot be iterated: %s", scheme)
+		}
+		return &source{Ranger: r, Closer: closer}, nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening database file (%s): %w", path, err)
+	}
+	data := make(map[string]string)
+	meta := make(map[string]furl.Meta)
+	offset, err := readRecords(bufio.NewReader(f), func(key, url string) {
+		if url == "" {
+			delete(data, key)
+		} else {
+			data[key] = url
+		}
+		delete(meta, key)
+	}, func(key string, m furl.Meta) {
+		meta[key] = m
+	})
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &source{
+		Ranger: furl.NewStore(furl.Data(data), furl.MetaData(meta)).(furl.Ranger),
+		Closer: f,
+		follow: func(fn func(key, url string), metaFn func(key string, meta furl.Meta)) error {
+			if _, err := f.Seek(offset, io.SeekStart); err != nil {
+				return fmt.Errorf("error seeking in database file: %w", err)
+			}
+			n, err := readRecords(bufio.NewReader(f), fn, metaFn)
+			offset += n
+			if errors.Is(err, io.ErrUnexpectedEOF) { // partially written record
+				return nil
+			}
+			return err
+		},
+	}, nil
+}
+
+func countKeys(r furl.Ranger) int {
+	var count int
+	r.Range(func(_, _ string) bool {
+		count++
+		return true
+	})
+	return count
+}
+
+func migrate(args []string) error {
+	flags := flag.NewFlagSet(os.Args[0]+" migrate", flag.ExitOnError)
+	from := flags.String("from", "", "backend to migrate from. e.g. file:/path/to/data")
+	to := flags.String("to", "", "backend to migrate to. e.g. file:/path/to/data")
+	follow := flags.Bool("follow", false, "after migrating, continue to copy new writes to the source until interrupted")
+	interval := flags.Duration("interval", time.Second, "how often to check the source for new writes when following")
+	flags.Parse(args)
+
+	if *from == "" || *to == "" {
+		return errors.New("both -from and -to backends must be specified")
+	}
+	src, err := openSource(*from)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, closer, err := openBackend(*to)
+	if err != nil {
+		return err
+	}
+	defer closer.Close()
+	n, err := furl.Migrate(dst, src)
+	if err != nil {
+		return fmt.Errorf("error migrating data: %w", err)
+	}
+	fmt.Printf("migrated %d keys\n", n)
+	verified, err := furl.Verify(dst, src)
+	if err != nil {
+		return fmt.Errorf("error verifying data: %w", err)
+	}
+	fmt.Printf("verified %d keys", verified)
+	if r, ok := dst.(furl.Ranger); ok {
+		count, expected := countKeys(r), countKeys(src)
+		fmt.Printf("; destination contains %d keys\n", count)
+		if count != expected {
+			return fmt.Errorf("error verifying data: destination contains %d keys, source contains %d", count, expected)
+		}
+	} else {
+		fmt.Println()
+	}
+	if !*follow {
+		return nil
+	} else if src.follow == nil {
+		return errors.New("source backend does not support following")
+	}
+	sc := make(chan os.Signal, 1)
+	signal.Notify(sc, os.Interrupt)
+	defer signal.Stop(sc)
+	t := time.NewTicker(*interval)
+	defer t.Stop()
+	for {
+		if err := src.follow(func(key, url string) {
+			if url == "" {
+				dst.Tx(func(tx furl.Tx) {
+					if dt, ok := tx.(furl.DeleteTx); ok {
+						dt.Delete(key)
+					}
+				})
+				fmt.Printf("removed %s\n", key)
+				return
+			}
+			dst.Tx(func(tx furl.Tx) {
+				tx.Set(key, url) // NB: also removes any meta, as in the source
+			})
+			fmt.Printf("migrated %s\n", key)
+		}, func(key string, meta furl.Meta) {
+			dst.Tx(func(tx furl.Tx) {
+				if mt, ok := tx.(furl.MetaTx); ok {
+					mt.SetMeta(key, meta)
+				}
+			})
+		}); err != nil {
+			return fmt.Errorf("error following source: %w", err)
+		}
+		select {
+		case <-sc:
+			return nil
+		case <-t.C:
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"vimagination.zapto.org/furl"
+)
+
+// openRedis parses a backend of the form:
+// redis://[:password@]host:port[/db][?prefix=PREFIX&ttl=DURATION]
+func openRedis(spec string) (furl.Store, io.Closer, error) {
+	u, err := url.Parse(spec)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error parsing redis url: %w", err)
+	}
+	var opts []furl.RedisOption
+	if password, ok := u.User.Password(); ok {
+		opts = append(opts, furl.RedisAuth(password))
+	}
+	if db := strings.Trim(u.Path, "/"); db != "" {
+		n, err := strconv.Atoi(db)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error parsing redis database number: %w", err)
+		}
+		opts = append(opts, furl.RedisDB(n))
+	}
+	q := u.Query()
+	if prefix := q.Get("prefix"); prefix != "" {
+		opts = append(opts, furl.RedisPrefix(prefix))
+	}
+	if ttl := q.Get("ttl"); ttl != "" {
+		d, err := time.ParseDuration(ttl)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error parsing redis ttl: %w", err)
+		}
+		opts = append(opts, furl.RedisTTL(d))
+	}
+	host := u.Host
+	if u.Port() == "" {
+		host += ":6379"
+	}
+	r := furl.NewRedisStore(host, opts...)
+	return r, r, nil
+}
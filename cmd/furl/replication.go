@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+
+	"vimagination.zapto.org/furl"
+)
+
+func newReplica(store furl.Store, primaryURL, token, forward, file string) (*furl.Replica, error) {
+	var opts []furl.ReplicaOption
+	if forward != "" {
+		u, err := url.Parse(forward)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing forward url: %w", err)
+		}
+		opts = append(opts, furl.Forward(u))
+	}
+	if file != "" { // store the replication position alongside the data file
+		posFile := file + ".pos"
+		if data, err := os.ReadFile(posFile); err == nil {
+			var (
+				epoch string
+				seq   uint64
+			)
+			if _, err := fmt.Sscan(string(data), &epoch, &seq); err != nil {
+				return nil, fmt.Errorf("error reading replication position (%s): %w", posFile, err)
+			}
+			opts = append(opts, furl.Position(epoch, seq))
+		} else if !os.IsNotExist(err) {
+			return nil, fmt.Errorf("error reading replication position (%s): %w", posFile, err)
+		}
+		opts = append(opts, furl.SavePosition(func(epoch string, seq uint64) {
+			if err := os.WriteFile(posFile, []byte(fmt.Sprintln(epoch, seq)), 0o666); err != nil {
+				panic(fmt.Errorf("error while writing replication position: %w", err))
+			}
+		}))
+	}
+	return furl.NewReplica(store, primaryURL, token, opts...), nil
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"vimagination.zapto.org/furl"
+)
+
+func snapshot(args []string) error {
+	flags := flag.NewFlagSet(os.Args[0]+" snapshot", flag.ExitOnError)
+	adminURL := flags.String("a", "", "url of the admin server of a running instance. e.g. http://127.0.0.1:8081/")
+	file := flags.String("f", "", "filename of key:url map data to snapshot, when not using a running instance")
+	output := flags.String("o", "-", "filename to write the snapshot to; - for stdout")
+	flags.Parse(args)
+
+	if (*adminURL == "") == (*file == "") {
+		return errors.New("exactly one of -a and -f must be specified")
+	}
+	write := func(w io.Writer) error {
+		return snapshotFile(w, *file)
+	}
+	if *adminURL != "" {
+		write = func(w io.Writer) error {
+			return snapshotAdmin(w, *adminURL)
+		}
+	}
+	if *output == "-" {
+		return write(os.Stdout)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(*output), filepath.Base(*output)+".*")
+	if err != nil {
+		return fmt.Errorf("error creating snapshot file: %w", err)
+	}
+	if err = write(tmp); err == nil {
+		err = tmp.Sync()
+	}
+	if errr := tmp.Close(); err == nil {
+		err = errr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), *output)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+func snapshotAdmin(w io.Writer, adminURL string) error {
+	resp, err := http.Get(strings.TrimSuffix(adminURL, "/") + "/snapshot")
+	if err != nil {
+		return fmt.Errorf("error requesting snapshot: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("error requesting snapshot: %s", resp.Status)
+	}
+	if _, err := io.Copy(w, resp.Body); err != nil {
+		return fmt.Errorf("error reading snapshot: %w", err)
+	}
+	return nil
+}
+
+func snapshotFile(w io.Writer, file string) error {
+	store, f, err := openStore(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := furl.New(furl.SetStore(store)).Snapshot(w); err != nil {
+		return fmt.Errorf("error writing snapshot: %w", err)
+	}
+	return nil
+}
+
+func restoreSnapshot(filename string, store furl.Store) (furl.Store, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("error opening snapshot file (%s): %w", filename, err)
+	}
+	defer f.Close()
+	data, meta, err := furl.ReadSnapshot(f)
+	if err != nil {
+		return nil, fmt.Errorf("error reading snapshot file (%s): %w", filename, err)
+	}
+	if store == nil {
+		return furl.NewStore(furl.Data(data), furl.MetaData(meta)), nil
+	}
+	var exists bool
+	if r, ok := store.(furl.Ranger); ok {
+		r.Range(func(_, _ string) bool {
+			exists = true
+			return false
+		})
+	}
+	if exists {
+		return nil, errors.New("cannot restore snapshot into a store that already contains data")
+	}
+	s := furl.NewStore(furl.Data(data), furl.MetaData(meta))
+	if _, err := furl.Migrate(store, s.(furl.Ranger)); err != nil {
+		return nil, fmt.Errorf("error restoring snapshot: %w", err)
+	}
+	return store, nil
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"vimagination.zapto.org/furl"
+)
+
+/*
+	Each key:url pair is stored sequentially and according to the following format:
+
+	struct {
+		KeyLength uint16
+		Key       [KeyLength]byte
+		URLLength uint16
+		URL       [URLLength]byte
+	}
+
+	The uint16s are store in LittleEndian format.
+
+	If the top bit of the URLLength is set, the record instead contains the JSON
+	encoded metadata for the key, with the remaining bits holding its length.
+	Metadata records follow the record that sets the URL for the key.
+
+	A record with a zero URLLength, and the top bit unset, removes the key.
+*/
+
+const metaRecord = 0x8000
+
+func openStore(file string) (furl.Store, *os.File, error) {
+	f, err := os.OpenFile(file, os.O_RDWR|os.O_CREATE, 0o666)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error opening database file (%s): %w", file, err)
+	}
+	data, meta, history, err := readData(bufio.NewReader(f))
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	w := bufio.NewWriter(f)
+	var length [2]byte
+	write := func(key, value string, flag int) {
+		length[0] = byte(len(key))
+		length[1] = byte(len(key) >> 8)
+		if _, err := w.Write(length[:]); err != nil {
+			panic(fmt.Errorf("error while writing key length: %w", err))
+		}
+		if _, err := w.WriteString(key); err != nil {
+			panic(fmt.Errorf("error while writing key: %w", err))
+		}
+		length[0] = byte(len(value))
+		length[1] = byte(len(value)>>8 | flag>>8)
+		if _, err := w.Write(length[:]); err != nil {
+			panic(fmt.Errorf("error while writing url length: %w", err))
+		}
+		if _, err := w.WriteString(value); err != nil {
+			panic(fmt.Errorf("error while writing url: %w", err))
+		}
+		if err := w.Flush(); err != nil {
+			panic(fmt.Errorf("error while flushing buffers: %w", err))
+		}
+		if err := f.Sync(); err != nil {
+			panic(fmt.Errorf("error while syncing file: %w", err))
+		}
+	}
+	return furl.NewStore(furl.Data(data), furl.MetaData(meta), furl.HistoryData(history), furl.Save(func(key, url string) {
+		write(key, url, 0)
+	}), furl.SaveMeta(func(key string, meta furl.Meta) {
+		data, err := encodeMeta(meta)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error saving metadata for key %s: %s\n", key, err)
+			return
+		}
+		write(key, data, metaRecord)
+	}), furl.SaveDelete(func(key string) {
+		write(key, "", 0)
+	})), f, nil
+}
+
+// encodeMeta encodes the metadata for a metadata record. Furl limits the size
+// of the metadata it accepts to well within that of a record.
+func encodeMeta(meta furl.Meta) (string, error) {
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return "", fmt.Errorf("error encoding metadata: %w", err)
+	} else if len(data) >= metaRecord {
+		return "", errors.New("metadata too large for record")
+	}
+	return string(data), nil
+}
+
+// readData replays the records, keeping the previous URLs and metadata of each
+// key as its history.
+func readData(r io.Reader) (map[string]string, map[string]furl.Meta, map[string][]furl.Revision, error) {
+	data := make(map[string]string)
+	meta := make(map[string]furl.Meta)
+	history := make(map[string][]furl.Revision)
+	if _, err := readRecords(r, func(key, url string) {
+		if url == "" {
+			delete(data, key)
+			delete(meta, key)
+			delete(history, key)
+			return
+		}
+		if old, ok := data[key]; ok {
+			history[key] = append(history[key], furl.Revision{URL: old, Meta: meta[key]})
+		}
+		data[key] = url
+		delete(meta, key)
+	}, func(key string, m furl.Meta) {
+		meta[key] = m
+	}); err != nil {
+		return nil, nil, nil, err
+	}
+	return data, meta, history, nil
+}
+
+// readRecords calls fn for each key:url record, with an empty url for a
+// removed key, and, if it is not nil, metaFn for each metadata record.
+func readRecords(r io.Reader, fn func(key, url string), metaFn func(key string, meta furl.Meta)) (int64, error) {
+	var (
+		length [2]byte
+		offset int64
+	)
+	for {
+		if _, err := io.ReadFull(r, length[:]); err != nil && err != io.EOF {
+			return offset, fmt.Errorf("error reading key length: %w", err)
+		}
+		keyLength := int(length[0]) | (int(length[1]) << 8)
+		if keyLength == 0 {
+			break
+		}
+		key := make([]byte, keyLength)
+		if _, err := io.ReadFull(r, key); err != nil {
+			return offset, fmt.Errorf("error reading key: %w", err)
+		}
+		if _, err := io.ReadFull(r, length[:]); err == io.EOF {
+			break
+		} else if err != nil {
+			return offset, fmt.Errorf("error reading url length: %w", err)
+		}
+		urlLength := int(length[0]) | (int(length[1]) << 8)
+		isMeta := urlLength&metaRecord != 0
+		urlLength &^= metaRecord
+		if urlLength == 0 && !isMeta {
+			fn(string(key), "")
+		} else if urlLength > 0 {
+			url := make([]byte, urlLength)
+			if _, err := io.ReadFull(r, url); err != nil {
+				return offset, fmt.Errorf("error reading url: %w", err)
+			}
+			if !isMeta {
+				fn(string(key), string(url))
+			} else if metaFn != nil {
+				var meta furl.Meta
+				if err := json.Unmarshal(url, &meta); err != nil {
+					return offset, fmt.Errorf("error reading metadata: %w", err)
+				}
+				metaFn(string(key), meta)
+			}
+		}
+		offset += int64(4 + keyLength + urlLength)
+		length[0] = 0
+		length[1] = 0
+	}
+	return offset, nil
+}
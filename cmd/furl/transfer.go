@@ -0,0 +1,132 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"vimagination.zapto.org/furl"
+)
+
+var (
+	formats = map[string]furl.Format{
+		"jsonl": furl.JSONLines,
+		"csv":   furl.CSV,
+		"xml":   furl.XML,
+	}
+	shorteners = map[string]func(*furl.Furl, io.Reader) (*furl.ImportReport, error){
+		"bitly":  (*furl.Furl).ImportBitly,
+		"yourls": (*furl.Furl).ImportYOURLS,
+		"shlink": (*furl.Furl).ImportShlink,
+	}
+	conflicts = map[string]furl.Conflict{
+		"skip":              furl.ConflictSkip,
+		"overwrite":         furl.ConflictOverwrite,
+		"fail":              furl.ConflictFail,
+		"overwrite-deleted": furl.ConflictOverwriteDeleted,
+	}
+)
+
+func exportData(args []string) error {
+	flags := flag.NewFlagSet(os.Args[0]+" export", flag.ExitOnError)
+	file := flags.String("f", "", "filename of key:url map data to export")
+	formatName := flags.String("format", "jsonl", "format of the exported data (jsonl, csv, xml)")
+	output := flags.String("o", "-", "filename to write the exported data to; - for stdout")
+	tags := flags.String("tag", "", "comma separated list of tags; only links with all of the tags will be exported")
+	passwords := flags.Bool("passwords", false, "include password hashes in the exported data")
+	flags.Parse(args)
+
+	format, ok := formats[*formatName]
+	if !ok {
+		return fmt.Errorf("unknown format: %s", *formatName)
+	} else if *file == "" {
+		return errors.New("no data file specified")
+	}
+	store, f, err := openStore(*file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var w io.Writer = os.Stdout
+	if *output != "-" {
+		o, err := os.Create(*output)
+		if err != nil {
+			return fmt.Errorf("error creating output file (%s): %w", *output, err)
+		}
+		defer o.Close()
+		w = o
+	}
+	r := store.(furl.Ranger)
+	if *tags != "" {
+		r = furl.Tagged(r, strings.Split(*tags, ",")...)
+	}
+	export := furl.Export
+	if *passwords {
+		export = furl.ExportWithPasswords
+	}
+	if err := export(w, r, format); err != nil {
+		return fmt.Errorf("error exporting data: %w", err)
+	}
+	return nil
+}
+
+func importData(args []string) error {
+	flags := flag.NewFlagSet(os.Args[0]+" import", flag.ExitOnError)
+	file := flags.String("f", "", "filename of key:url map data to import into")
+	formatName := flags.String("format", "jsonl", "format of the imported data (jsonl, csv, xml, bitly, yourls, shlink)")
+	conflictName := flags.String("conflict", "fail", "how to treat keys that already exist (skip, overwrite, overwrite-deleted, fail)")
+	input := flags.String("i", "-", "filename to read the imported data from; - for stdin")
+	flags.Parse(args)
+
+	format, ok := formats[*formatName]
+	shortener, isShortener := shorteners[*formatName]
+	if !ok && !isShortener {
+		return fmt.Errorf("unknown format: %s", *formatName)
+	}
+	conflict, ok := conflicts[*conflictName]
+	if !ok {
+		return fmt.Errorf("unknown conflict policy: %s", *conflictName)
+	} else if *file == "" {
+		return errors.New("no data file specified")
+	}
+	store, f, err := openStore(*file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var r io.Reader = os.Stdin
+	if *input != "-" {
+		i, err := os.Open(*input)
+		if err != nil {
+			return fmt.Errorf("error opening input file (%s): %w", *input, err)
+		}
+		defer i.Close()
+		r = i
+	}
+	fu := furl.New(furl.SetStore(store), furl.URLValidator(furl.HTTPURL), furl.KeyValidator(keyValidator))
+	if isShortener {
+		report, err := shortener(fu, r)
+		if report != nil {
+			for _, r := range report.Renamed {
+				fmt.Printf("renamed %s -> %s\n", r.Old, r.New)
+			}
+			for _, key := range report.Invalid {
+				fmt.Printf("invalid url for key %s\n", key)
+			}
+			fmt.Fprintf(os.Stderr, "imported %d keys\n", report.Imported)
+		}
+		if err != nil {
+			return fmt.Errorf("error importing data: %w", err)
+		}
+		return nil
+	}
+	n, err := fu.Import(r, format, conflict)
+	if err != nil {
+		return fmt.Errorf("error importing data: %w", err)
+	}
+	fmt.Fprintf(os.Stderr, "imported %d keys\n", n)
+	return nil
+}
@@ -0,0 +1,274 @@
+package furl
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	maxDestinations    = 32
+	defaultServedBatch = 100
+
+	invalidDestinations = "invalid destinations"
+)
+
+// The Destination type is one of the URLs that a link with multiple
+// destinations can redirect to.
+//
+// The Weight sets how often the URL is chosen, relative to the weights of the
+// other destinations of the link, with a zero weight being treated as one.
+//
+// The Served count is set by Furl, and counts the number of times that the
+// destination has been redirected to. Counts are written to the Store in
+// batches, as set by the ServedBatch Option, so recent redirects may not yet be
+// included.
+type Destination struct {
+	URL    string `json:"url" xml:"url"`
+	Weight uint   `json:"weight,omitempty" xml:"weight,omitempty"`
+	Served uint64 `json:"served,omitempty" xml:"served,omitempty"`
+}
+
+func (d Destination) weight() int64 {
+	if d.Weight == 0 {
+		return 1
+	}
+
+	return int64(d.Weight)
+}
+
+func (f *Furl) validDestinations(destinations []Destination) bool {
+	for _, d := range destinations {
+		if !f.validURL(d.URL) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// formDestinations parses destinations from form values, each of which can
+// contain multiple lines of a URL optionally followed by a space and its weight.
+func formDestinations(form url.Values) ([]Destination, error) {
+	var destinations []Destination
+
+	for _, values := range form["destinations"] {
+		for _, line := range strings.Split(values, "\n") {
+			fields := strings.Fields(line)
+			if len(fields) == 0 {
+				continue
+			} else if len(fields) > 2 {
+				return nil, ErrInvalidDestinations
+			}
+
+			d := Destination{URL: fields[0]}
+
+			if len(fields) == 2 {
+				weight, err := strconv.ParseUint(fields[1], 10, 32)
+				if err != nil {
+					return nil, err
+				}
+
+				d.Weight = uint(weight)
+			}
+
+			destinations = append(destinations, d)
+		}
+	}
+
+	return destinations, nil
+}
+
+// follow writes the response that takes the user to the URL of the link,
+// either a redirect or an interstitial page.
+//
+// For a link with targeting rules or multiple destinations, the URL is chosen
+// for the request and a 302 Found redirect is used, so that the choice isn't
+// cached. A link with limited uses, an activation window, or a password is
+// also not stored by caches, so that every visit is checked.
+//
+// For a POST request, such as the submission of the password form, a 303 See
+// Other redirect is used, so that the URL is followed with a GET request.
+func (f *Furl) follow(w http.ResponseWriter, r *http.Request, key, url string) {
+	code := http.StatusMovedPermanently
+
+	meta, _ := getMeta(f.store, key)
+	if meta.MaxUses > 0 || meta.NotBefore != nil || meta.NotAfter != nil || meta.Password != "" {
+		code = http.StatusFound
+
+		w.Header().Set("Cache-Control", "no-store")
+	} else if len(meta.Rules) > 0 {
+		code = http.StatusFound
+	}
+
+	if u, ok := f.ruleDestination(w, r, meta.Rules); ok {
+		url = u
+	} else if d, ok := f.destination(w, r, key); ok {
+		url = d
+		code = http.StatusFound
+	}
+
+	if r.Method == http.MethodPost {
+		code = http.StatusSeeOther
+	}
+
+	if f.interstitial(key, url) {
+		f.confirm(w, r, url)
+	} else {
+		http.Redirect(w, r, url, code)
+	}
+}
+
+// destination chooses one of the destinations of the link for the key,
+// according to their weights, or the one remembered by the sticky cookie, as
+// set by the StickyDestinations Option. For a GET or POST request, the chosen
+// destination is counted, to be added to its Served count.
+func (f *Furl) destination(w http.ResponseWriter, r *http.Request, key string) (string, bool) {
+	meta, _ := getMeta(f.store, key)
+	if len(meta.Destinations) == 0 {
+		return "", false
+	}
+
+	chosen := f.stickyDestination(r, len(meta.Destinations))
+	if chosen < 0 {
+		chosen = f.chooseDestination(meta.Destinations)
+	}
+
+	if r.Method == http.MethodGet || r.Method == http.MethodPost {
+		f.countServed(key, meta.Destinations[chosen].URL)
+	}
+
+	if f.stickyCookie != "" {
+		http.SetCookie(w, &http.Cookie{
+			Name:     f.stickyCookie,
+			Value:    strconv.Itoa(chosen),
+			Path:     r.URL.EscapedPath(),
+			MaxAge:   int(f.stickyMaxAge / time.Second),
+			HttpOnly: true,
+			SameSite: http.SameSiteLaxMode,
+		})
+	}
+
+	return meta.Destinations[chosen].URL, true
+}
+
+// countServed counts a redirect to the destination URL of the link for the key,
+// writing all of the counts to the Store once the batch size set by the
+// ServedBatch Option has been reached.
+func (f *Furl) countServed(key, url string) {
+	if f.servedBatch == 0 {
+		return
+	}
+
+	f.servedMu.Lock()
+
+	counts, ok := f.served[key]
+	if !ok {
+		counts = make(map[string]uint64)
+		f.served[key] = counts
+	}
+
+	counts[url]++
+	f.servedCount++
+
+	var served map[string]map[string]uint64
+
+	if f.servedCount >= f.servedBatch {
+		served = f.takeServed()
+	}
+
+	f.servedMu.Unlock()
+
+	f.writeServed(served)
+}
+
+// takeServed returns the counted redirects, replacing them with an empty set.
+//
+// NB: servedMu must be held.
+func (f *Furl) takeServed() map[string]map[string]uint64 {
+	served := f.served
+	f.served = make(map[string]map[string]uint64)
+	f.servedCount = 0
+
+	return served
+}
+
+// writeServed adds the counted redirects to the Served counts of the
+// destinations, matched by URL, of each link.
+func (f *Furl) writeServed(served map[string]map[string]uint64) {
+	for key, counts := range served {
+		keyTx(f.store, key, func(tx Tx) {
+			meta, _ := getMeta(tx, key)
+			if len(meta.Destinations) == 0 {
+				return
+			}
+
+			meta.Destinations = append([]Destination(nil), meta.Destinations...) // NB: don't modify the slice held by the Store
+
+			for n, d := range meta.Destinations {
+				meta.Destinations[n].Served += counts[d.URL]
+
+				delete(counts, d.URL) // NB: only count a URL listed more than once for its first destination
+			}
+
+			setMeta(tx, key, &meta)
+		})
+	}
+}
+
+// The FlushServed method writes the Served counts of all destinations that
+// have been redirected to since the last batch was written to the Store.
+//
+// NB: Counts that have not been written are lost when the Furl instance is
+// discarded, so this method should be called when shutting down.
+func (f *Furl) FlushServed() {
+	f.servedMu.Lock()
+	served := f.takeServed()
+	f.servedMu.Unlock()
+
+	f.writeServed(served)
+}
+
+func (f *Furl) stickyDestination(r *http.Request, count int) int {
+	if f.stickyCookie == "" {
+		return -1
+	}
+
+	cookie, err := r.Cookie(f.stickyCookie)
+	if err != nil {
+		return -1
+	}
+
+	chosen, err := strconv.Atoi(cookie.Value)
+	if err != nil || chosen < 0 || chosen >= count {
+		return -1
+	}
+
+	return chosen
+}
+
+func (f *Furl) chooseDestination(destinations []Destination) int {
+	var total int64
+
+	for _, d := range destinations {
+		total += d.weight()
+	}
+
+	f.randMu.Lock()
+	n := f.rand.Int63n(total)
+	f.randMu.Unlock()
+
+	for i, d := range destinations {
+		if n -= d.weight(); n < 0 {
+			return i
+		}
+	}
+
+	return len(destinations) - 1
+}
+
+// Errors.
+var ErrInvalidDestinations = errors.New(invalidDestinations)
@@ -0,0 +1,160 @@
+package furl
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDestinations(t *testing.T) {
+	rs := nonrand{0, 1, 3, 2}
+	f := New(Clock(testClock), RandomSource(&rs), URLValidator(HTTPURL), StickyDestinations("variant", time.Hour), ServedBatch(1))
+	r := httptest.NewRequest(http.MethodPost, "/AAA", strings.NewReader("url=http://www.example.com/&destinations=http://a.example.com/%0Ahttp://b.example.com/+3"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	f.ServeHTTP(httptest.NewRecorder(), r)
+	for n, test := range [...]struct {
+		Method, Path, Cookie string
+		Code                 int
+		Location, SetCookie  string
+		Response             string
+	}{
+		{ // 1
+			Method:    http.MethodGet,
+			Path:      "/AAA",
+			Code:      http.StatusFound,
+			Location:  "http://a.example.com/",
+			SetCookie: "variant=0; Path=/AAA; Max-Age=3600; HttpOnly; SameSite=Lax",
+		},
+		{ // 2
+			Method:    http.MethodGet,
+			Path:      "/AAA",
+			Code:      http.StatusFound,
+			Location:  "http://b.example.com/",
+			SetCookie: "variant=1; Path=/AAA; Max-Age=3600; HttpOnly; SameSite=Lax",
+		},
+		{ // 3
+			Method:    http.MethodHead,
+			Path:      "/AAA",
+			Code:      http.StatusFound,
+			Location:  "http://b.example.com/",
+			SetCookie: "variant=1; Path=/AAA; Max-Age=3600; HttpOnly; SameSite=Lax",
+		},
+		{ // 4
+			Method:    http.MethodGet,
+			Path:      "/AAA",
+			Cookie:    "variant=0",
+			Code:      http.StatusFound,
+			Location:  "http://a.example.com/",
+			SetCookie: "variant=0; Path=/AAA; Max-Age=3600; HttpOnly; SameSite=Lax",
+		},
+		{ // 5
+			Method:    http.MethodGet,
+			Path:      "/AAA",
+			Cookie:    "variant=2",
+			Code:      http.StatusFound,
+			Location:  "http://b.example.com/",
+			SetCookie: "variant=1; Path=/AAA; Max-Age=3600; HttpOnly; SameSite=Lax",
+		},
+		{ // 6
+			Method:   http.MethodGet,
+			Path:     "/AAA+",
+			Code:     http.StatusOK,
+			Response: `{"key":"AAA","url":"http://www.example.com/","created":"2020-01-02T03:04:05Z","destinations":[{"url":"http://a.example.com/","served":2},{"url":"http://b.example.com/","weight":3,"served":2}]}`,
+		},
+	} {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(test.Method, test.Path, nil)
+		if test.Cookie != "" {
+			r.Header.Set("Cookie", test.Cookie)
+		}
+		f.ServeHTTP(w, r)
+		if w.Code != test.Code {
+			t.Errorf("test %d: expecting response code %d, got %d", n+1, test.Code, w.Code)
+		} else if location := w.Header().Get("Location"); location != test.Location {
+			t.Errorf("test %d: expecting location %q, got %q", n+1, test.Location, location)
+		} else if cookie := w.Header().Get("Set-Cookie"); cookie != test.SetCookie {
+			t.Errorf("test %d: expecting cookie %q, got %q", n+1, test.SetCookie, cookie)
+		} else if response := strings.TrimSpace(w.Body.String()); test.Response != "" && response != test.Response {
+			t.Errorf("test %d: expecting response %s, got %s", n+1, test.Response, response)
+		}
+	}
+	for n, test := range [...]struct {
+		ContentType, Body string
+		Code              int
+	}{
+		{ // 1
+			ContentType: "application/json",
+			Body:        `{"url":"http://www.example.com/","destinations":[{"url":"http://a.example.com/"},{"url":"ftp://b.example.com/"}]}`,
+			Code:        http.StatusBadRequest,
+		},
+		{ // 2
+			ContentType: "application/json",
+			Body:        `{"url":"http://www.example.com/","destinations":[` + strings.Repeat(`{"url":"http://a.example.com/"},`, maxDestinations) + `{"url":"http://a.example.com/"}]}`,
+			Code:        http.StatusBadRequest,
+		},
+		{ // 3
+			ContentType: "application/x-www-form-urlencoded",
+			Body:        "url=http://www.example.com/&destinations=http://a.example.com/+a",
+			Code:        http.StatusBadRequest,
+		},
+		{ // 4
+			ContentType: "application/x-www-form-urlencoded",
+			Body:        "url=http://www.example.com/&destinations=http://a.example.com/+1+2",
+			Code:        http.StatusBadRequest,
+		},
+		{ // 5
+			ContentType: "text/xml",
+			Body:        `<furl><url>http://www.example.com/</url><destination><url>http://a.example.com/</url><weight>2</weight><served>5</served></destination></furl>`,
+			Code:        http.StatusOK,
+		},
+	} {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/BBB", strings.NewReader(test.Body))
+		r.Header.Set("Content-Type", test.ContentType)
+		f.ServeHTTP(w, r)
+		if w.Code != test.Code {
+			t.Errorf("test %d: expecting response code %d, got %d", n+1, test.Code, w.Code)
+		}
+	}
+	if meta, _ := getMeta(f.store, "BBB"); len(meta.Destinations) != 1 || meta.Destinations[0].Weight != 2 || meta.Destinations[0].Served != 0 {
+		t.Errorf("unexpected destinations: %v", meta.Destinations)
+	}
+}
+
+func TestServedBatch(t *testing.T) {
+	rs := nonrand{0, 1, 0}
+	f := New(RandomSource(&rs), ServedBatch(3))
+	f.store.Tx(func(tx Tx) {
+		tx.Set("AAA", "http://www.example.com/")
+		setMeta(tx, "AAA", &Meta{Destinations: []Destination{{URL: "http://a.example.com/"}, {URL: "http://b.example.com/"}}})
+	})
+	served := func() []uint64 {
+		meta, _ := getMeta(f.store, "AAA")
+		return []uint64{meta.Destinations[0].Served, meta.Destinations[1].Served}
+	}
+	for n, test := range [...]struct {
+		Flush  bool
+		Served []uint64
+	}{
+		{Served: []uint64{0, 0}},              // 1
+		{Served: []uint64{0, 0}},              // 2
+		{Served: []uint64{2, 1}},              // 3
+		{Flush: true, Served: []uint64{3, 1}}, // 4
+	} {
+		f.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/AAA", nil))
+		if test.Flush {
+			f.FlushServed()
+		}
+		if s := served(); s[0] != test.Served[0] || s[1] != test.Served[1] {
+			t.Errorf("test %d: expecting served counts %v, got %v", n+1, test.Served, s)
+		}
+	}
+	f = New(ServedBatch(0), SetStore(f.store))
+	f.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/AAA", nil))
+	f.FlushServed()
+	if s := served(); s[0] != 3 || s[1] != 1 {
+		t.Errorf("expecting served counts not to change when not counting, got %v", s)
+	}
+}
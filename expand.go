@@ -0,0 +1,286 @@
+package furl
+
+import (
+	"bufio"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	maxExpandLinks = 100
+
+	tooManyLinks   = "too many links"
+	unknownBaseURL = "unknown base url"
+)
+
+var (
+	xmlExpandStart = xml.StartElement{
+		Name: xml.Name{
+			Local: "expand",
+		},
+	}
+	xmlExpansionStart = xml.StartElement{
+		Name: xml.Name{
+			Local: "expansion",
+		},
+	}
+)
+
+type baseURL struct {
+	url, host, path string
+	tenant          *Furl
+}
+
+func parseBaseURL(base string, tenant *Furl) baseURL {
+	u, err := url.Parse(base)
+	if err != nil {
+		return baseURL{}
+	}
+
+	path := strings.TrimSuffix(u.EscapedPath(), "/") + "/"
+
+	return baseURL{
+		url:    u.Scheme + "://" + u.Host + path,
+		host:   strings.ToLower(u.Host),
+		path:   path,
+		tenant: tenant,
+	}
+}
+
+// The Expansion type is the result of resolving a short link with the Resolve
+// method.
+//
+// The Link is the short URL or key that was resolved, and the Key is the key
+// that it was resolved to, in its canonical form. If the link was resolved, the URL will be set to its
+// destination; otherwise, Error will describe why it could not be.
+type Expansion struct {
+	Link  string `json:"link" xml:"link"`
+	Key   string `json:"key,omitempty" xml:"key,omitempty"`
+	URL   string `json:"url,omitempty" xml:"url,omitempty"`
+	Error string `json:"error,omitempty" xml:"error,omitempty"`
+}
+
+// The Resolve method finds the destination URL of each of the given links,
+// which can either be keys or short URLs.
+//
+// A short URL is resolved using the Furl instance set for its base URL with
+// the BaseURL or Tenant Options. When no base URLs have been set, the last
+// element of the path of any URL is used as a key for this instance.
+func (f *Furl) Resolve(links ...string) []Expansion {
+	expansions := make([]Expansion, len(links))
+
+	for n, link := range links {
+		expansions[n] = f.resolve(link)
+	}
+
+	return expansions
+}
+
+func (f *Furl) resolve(link string) Expansion {
+	e := Expansion{Link: link}
+
+	tenant, key := f.linkKey(link)
+	if tenant == nil {
+		e.Error = unknownBaseURL
+
+		return e
+	}
+
+	key, url, err := tenant.lookup(key)
+	if err != nil {
+		e.Error = err.Error()
+	}
+
+	e.Key = key
+	e.URL = url
+
+	return e
+}
+
+// linkKey determines the Furl instance, and the key, that a link refers to.
+func (f *Furl) linkKey(link string) (*Furl, string) {
+	u, err := url.Parse(link)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return f, link
+	}
+
+	_, key := pathKey(u.EscapedPath())
+
+	if len(f.bases) == 0 {
+		return f, key
+	}
+
+	host := strings.ToLower(u.Host)
+
+	for _, base := range f.bases {
+		if base.host != host || !strings.HasPrefix(u.EscapedPath(), base.path) {
+			continue
+		}
+
+		if base.tenant == nil {
+			return f, key
+		}
+
+		return base.tenant, key
+	}
+
+	return nil, ""
+}
+
+// lookup finds the URL for the key, as would be redirected to by a GET request,
+// returning the key in its canonical form.
+func (f *Furl) lookup(key string) (string, string, error) {
+	key, _ = trimPreview(key)
+
+	if !f.keyValidator(key) {
+		return key, "", ErrInvalidKey
+	}
+
+	key = f.canonicalise(key)
+
+	url, ok := f.store.Get(key)
+	if !ok {
+		return key, "", ErrMissingKey
+	} else if meta, _ := getMeta(f.store, key); meta.Deleted != nil {
+		return key, "", ErrDeleted
+	} else if meta.Password != "" {
+		return key, "", ErrPasswordRequired
+	} else if meta.MaxUses > 0 && meta.Uses >= meta.MaxUses {
+		return key, "", ErrUsedUp
+	} else if err := activeErr(meta, f.now()); err != nil {
+		return key, "", err
+	}
+
+	return key, url, nil
+}
+
+type expandLinks struct {
+	Links []string `xml:"link"`
+}
+
+// The Expand method returns an http.Handler that resolves short links, as per
+// the Resolve method, without following them.
+//
+// The handler accepts POST requests with the links provided in one of the
+// following content types:
+//
+// application/json:                  ["LINK HERE", "LINK HERE"] or "LINK HERE"
+// text/xml:                          <expand><link>LINK HERE</link><link>LINK HERE</link></expand>
+// application/x-www-form-urlencoded: link=LINK+HERE&link=LINK+HERE
+// text/plain:                        A link on each line.
+//
+// Up to 100 links can be resolved in a single request. Each link is reported
+// in the response, in the order given, with an error if it could not be
+// resolved. The response type will be determined by the POST content type:
+//
+// application/json: [{"link": "LINK HERE", "key": "KEY HERE", "url": "URL HERE"}, {"link": "LINK HERE", "key": "KEY HERE", "error": "ERROR"}]
+// text/xml:         <expand><expansion><link>LINK HERE</link><key>KEY HERE</key><url>URL HERE</url></expansion></expand>
+// text/plain:       A line for each link, containing the link, URL, and error, separated by tabs.
+//
+// For application/x-www-form-urlencoded, the content type of the response will
+// be text/plain.
+//
+// NB: The handler is intended to be served on its own path, such as /expand,
+// which should be reserved so that it cannot be used as a key.
+func (f *Furl) Expand() http.Handler {
+	return http.HandlerFunc(f.expand)
+}
+
+func (f *Furl) expand(w http.ResponseWriter, r *http.Request) {
+	if !allowPost(w, r) {
+		return
+	}
+
+	var (
+		links []string
+		err   error
+	)
+
+	contentType := r.Header.Get("Content-Type")
+	switch contentType {
+	case "text/json", "application/json":
+		links, err = readJSONLinks(r.Body)
+	case "text/xml", "application/xml":
+		var el expandLinks
+
+		err = xml.NewDecoder(r.Body).Decode(&el)
+		links = el.Links
+	case "application/x-www-form-urlencoded":
+		err = r.ParseForm()
+		links = r.PostForm["link"]
+		contentType = "text/plain"
+	case "text/plain":
+		s := bufio.NewScanner(r.Body)
+
+		for s.Scan() {
+			if link := strings.TrimSpace(s.Text()); link != "" {
+				links = append(links, link)
+			}
+		}
+
+		err = s.Err()
+	default:
+		http.Error(w, unrecognisedContentType, http.StatusUnsupportedMediaType)
+
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+
+	if err != nil {
+		f.writeResponse(w, r, http.StatusBadRequest, contentType, failedReadRequest)
+
+		return
+	} else if len(links) > maxExpandLinks {
+		f.writeResponse(w, r, http.StatusRequestEntityTooLarge, contentType, tooManyLinks)
+
+		return
+	}
+
+	expansions := f.Resolve(links...)
+
+	switch contentType {
+	case "text/json", "application/json":
+		json.NewEncoder(w).Encode(expansions)
+	case "text/xml", "application/xml":
+		x := xml.NewEncoder(w)
+
+		x.EncodeToken(xmlExpandStart)
+
+		for _, e := range expansions {
+			x.EncodeElement(e, xmlExpansionStart)
+		}
+
+		x.EncodeToken(xmlExpandStart.End())
+		x.Flush()
+	default:
+		for _, e := range expansions {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", e.Link, e.URL, e.Error)
+		}
+	}
+}
+
+func readJSONLinks(r io.Reader) ([]string, error) {
+	var data json.RawMessage
+
+	if err := json.NewDecoder(r).Decode(&data); err != nil {
+		return nil, err
+	}
+
+	var link string
+
+	if err := json.Unmarshal(data, &link); err == nil {
+		return []string{link}, nil
+	}
+
+	var links []string
+
+	err := json.Unmarshal(data, &links)
+
+	return links, err
+}
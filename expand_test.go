@@ -0,0 +1,153 @@
+package furl
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestResolve(t *testing.T) {
+	other := New()
+	post(other, "CCC", "http://www.example.net/")
+	f := New(BaseURL("https://s.example.com/go/"), Tenant("http://other.example.com", other))
+	post(f, "AAA", "http://www.example.com/")
+	post(f, "BBB", "http://www.example.org/")
+	f.Delete("BBB")
+	for n, test := range [...]struct {
+		Link      string
+		Expansion Expansion
+	}{
+		{ // 1
+			Link:      "AAA",
+			Expansion: Expansion{Link: "AAA", Key: "AAA", URL: "http://www.example.com/"},
+		},
+		{ // 2
+			Link:      "https://s.example.com/go/AAA",
+			Expansion: Expansion{Link: "https://s.example.com/go/AAA", Key: "AAA", URL: "http://www.example.com/"},
+		},
+		{ // 3
+			Link:      "http://S.EXAMPLE.COM/go/AAA+",
+			Expansion: Expansion{Link: "http://S.EXAMPLE.COM/go/AAA+", Key: "AAA", URL: "http://www.example.com/"},
+		},
+		{ // 4
+			Link:      "https://other.example.com/CCC",
+			Expansion: Expansion{Link: "https://other.example.com/CCC", Key: "CCC", URL: "http://www.example.net/"},
+		},
+		{ // 5
+			Link:      "https://s.example.com/go/CCC",
+			Expansion: Expansion{Link: "https://s.example.com/go/CCC", Key: "CCC", Error: ErrMissingKey.Error()},
+		},
+		{ // 6
+			Link:      "https://s.example.com/AAA",
+			Expansion: Expansion{Link: "https://s.example.com/AAA", Error: unknownBaseURL},
+		},
+		{ // 7
+			Link:      "BBB",
+			Expansion: Expansion{Link: "BBB", Key: "BBB", Error: ErrDeleted.Error()},
+		},
+	} {
+		if e := f.Resolve(test.Link); len(e) != 1 || !reflect.DeepEqual(e[0], test.Expansion) {
+			t.Errorf("test %d: expecting expansion %v, got %v", n+1, test.Expansion, e)
+		}
+	}
+	f = New(KeyValidator(func(key string) bool { return key != "bad" }))
+	post(f, "AAA", "http://www.example.com/")
+	if e := f.Resolve("https://anywhere.example.com/x/AAA", "bad"); len(e) != 2 {
+		t.Errorf("expecting 2 expansions, got %d", len(e))
+	} else if e[0].URL != "http://www.example.com/" {
+		t.Errorf("expecting URL to be resolved without base URL, got %v", e[0])
+	} else if e[1].Error != ErrInvalidKey.Error() {
+		t.Errorf("expecting invalid key error, got %v", e[1])
+	}
+}
+
+func TestExpand(t *testing.T) {
+	f := New()
+	post(f, "AAA", "http://www.example.com/")
+	for n, test := range [...]struct {
+		Method, ContentType, Body, ResponseType, Response string
+		Code                                              int
+	}{
+		{ // 1
+			Method:       http.MethodPost,
+			ContentType:  "application/json",
+			Body:         `["AAA","BBB"]`,
+			ResponseType: "application/json",
+			Response:     `[{"link":"AAA","key":"AAA","url":"http://www.example.com/"},{"link":"BBB","key":"BBB","error":"missing key"}]`,
+			Code:         http.StatusOK,
+		},
+		{ // 2
+			Method:       http.MethodPost,
+			ContentType:  "application/json",
+			Body:         `"http://localhost/AAA"`,
+			ResponseType: "application/json",
+			Response:     `[{"link":"http://localhost/AAA","key":"AAA","url":"http://www.example.com/"}]`,
+			Code:         http.StatusOK,
+		},
+		{ // 3
+			Method:       http.MethodPost,
+			ContentType:  "text/xml",
+			Body:         `<expand><link>AAA</link><link>BBB</link></expand>`,
+			ResponseType: "text/xml",
+			Response:     `<expand><expansion><link>AAA</link><key>AAA</key><url>http://www.example.com/</url></expansion><expansion><link>BBB</link><key>BBB</key><error>missing key</error></expansion></expand>`,
+			Code:         http.StatusOK,
+		},
+		{ // 4
+			Method:       http.MethodPost,
+			ContentType:  "application/x-www-form-urlencoded",
+			Body:         `link=AAA&link=BBB`,
+			ResponseType: "text/plain",
+			Response:     "AAA\thttp://www.example.com/\t\nBBB\t\tmissing key",
+			Code:         http.StatusOK,
+		},
+		{ // 5
+			Method:       http.MethodPost,
+			ContentType:  "text/plain",
+			Body:         "AAA\n\n  http://localhost/BBB  \n",
+			ResponseType: "text/plain",
+			Response:     "AAA\thttp://www.example.com/\t\nhttp://localhost/BBB\t\tmissing key",
+			Code:         http.StatusOK,
+		},
+		{ // 6
+			Method:       http.MethodPost,
+			ContentType:  "application/json",
+			Body:         `{"link":"AAA"}`,
+			ResponseType: "application/json",
+			Response:     `{"error":"failed to read request"}`,
+			Code:         http.StatusBadRequest,
+		},
+		{ // 7
+			Method:       http.MethodPost,
+			ContentType:  "text/plain",
+			Body:         strings.Repeat("AAA\n", maxExpandLinks+1),
+			ResponseType: "text/plain",
+			Response:     tooManyLinks,
+			Code:         http.StatusRequestEntityTooLarge,
+		},
+		{ // 8
+			Method:      http.MethodPost,
+			ContentType: "image/png",
+			Code:        http.StatusUnsupportedMediaType,
+		},
+		{ // 9
+			Method: http.MethodGet,
+			Code:   http.StatusMethodNotAllowed,
+		},
+	} {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(test.Method, "/expand", strings.NewReader(test.Body))
+		r.Header.Set("Content-Type", test.ContentType)
+		f.Expand().ServeHTTP(w, r)
+		if w.Code != test.Code {
+			t.Errorf("test %d: expecting response code %d, got %d", n+1, test.Code, w.Code)
+		} else if test.ResponseType == "" {
+			continue
+		} else if contentType := w.Header().Get("Content-Type"); contentType != test.ResponseType {
+			t.Errorf("test %d: expecting content type %q, got %q", n+1, test.ResponseType, contentType)
+		} else if response := strings.TrimSpace(w.Body.String()); response != test.Response {
+			t.Errorf("test %d: expecting response %q, got %q", n+1, test.Response, response)
+		}
+	}
+}
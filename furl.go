@@ -10,8 +10,11 @@ import (
 	"io"
 	"math/rand"
 	"net/http"
-	"path"
+	"net/netip"
+	"net/url"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -47,9 +50,34 @@ func allValid(_ string) bool {
 type Furl struct {
 	urlValidator, keyValidator func(string) bool
 	keyLength, retries         uint
+	randMu                     sync.Mutex
 	rand                       *rand.Rand
 	index                      func(http.ResponseWriter, *http.Request, int, string)
 	store                      Store
+	now                        func() time.Time
+	audit                      AuditSink
+	auditUser                  func(*http.Request) string
+	quarantine                 time.Duration
+	reserved                   *ReservedKeys
+	reservedCanonical          *ReservedKeys
+	canonicalise               func(string) string
+	bases                      []baseURL
+	passwordMu                 sync.Mutex
+	passwordAttempts           map[passwordClient]*passwordAttempts
+	passwordSwept              time.Time
+	passwordFree               uint
+	passwordMaxDelay           time.Duration
+	interstitialAll            bool
+	interstitialPage           func(http.ResponseWriter, *http.Request, string)
+	trustedDomains             []string
+	stickyCookie               string
+	stickyMaxAge               time.Duration
+	servedMu                   sync.Mutex
+	served                     map[string]map[string]uint64
+	servedCount                uint
+	servedBatch                uint
+	geoIP                      *MMDB
+	trustedProxies             []netip.Prefix
 }
 
 // The New function creates a new instance of Furl, with the following defaults
@@ -73,12 +101,63 @@ type Furl struct {
 //
 // index: By default, Furl offers no HTML output. This can be changed by using
 // the Index Option.
+//
+// now: By default, the Created time of new links is set using time.Now. This
+// can be changed by using the Clock Option.
+//
+// audit: By default, changes are not audited. This can be changed by using the
+// Audit Option.
+//
+// quarantine: By default, deleted keys are not reused until they are purged.
+// This can be changed by using the Quarantine Option.
+//
+// reserved: By default, no keys are reserved. This can be changed by using the
+// Reserved Option.
+//
+// canonicalise: By default, keys are stored and looked up exactly as given.
+// This can be changed by using the Canonicalise Option.
+//
+// bases: By default, any short URL given to the Resolve method is treated as a
+// link for this instance. This can be changed by using the BaseURL and Tenant
+// Options.
+//
+// passwordThrottle: By default, after 5 incorrect passwords from a client for a
+// protected link, the time until another attempt is allowed doubles with each incorrect
+// password, up to 15 minutes. This can be changed by using the
+// PasswordThrottle Option.
+//
+// interstitial: By default, links redirect without a confirmation page, unless
+// the link has the Interstitial flag set in its Meta. This can be changed by
+// using the Interstitial Option.
+//
+// stickyDestinations: By default, a destination is chosen for each request to a
+// link with multiple destinations. This can be changed by using the
+// StickyDestinations Option.
+//
+// servedBatch: By default, the Served counts of destinations are written to the
+// Store after every 100 redirects. This can be changed by using the ServedBatch
+// Option.
+//
+// geoIP: By default, the country of a request is not known, and so rules with a
+// Country condition match no requests. This can be changed by using the GeoIP
+// Option.
+//
+// trustedProxies: By default, the client address of a request is its remote
+// address. This can be changed by using the TrustedProxies Option.
 func New(opts ...Option) *Furl {
 	f := &Furl{
-		urlValidator: allValid,
-		keyValidator: allValid,
-		keyLength:    defaultKeyLength,
-		retries:      defaultRetries,
+		urlValidator:     allValid,
+		keyValidator:     allValid,
+		keyLength:        defaultKeyLength,
+		retries:          defaultRetries,
+		now:              time.Now,
+		auditUser:        BasicAuthUser,
+		canonicalise:     sameKey,
+		passwordAttempts: make(map[passwordClient]*passwordAttempts),
+		passwordFree:     defaultPasswordAttempts,
+		passwordMaxDelay: defaultPasswordMaxDelay,
+		served:           make(map[string]map[string]uint64),
+		servedBatch:      defaultServedBatch,
 	}
 
 	for _, o := range opts {
@@ -89,6 +168,10 @@ func New(opts ...Option) *Furl {
 		f.store = NewStore()
 	}
 
+	if f.reserved != nil {
+		f.reservedCanonical = f.reserved.canonicalised(f.canonicalise)
+	}
+
 	if f.rand == nil {
 		f.rand = rand.New(rand.NewSource(time.Now().UnixMicro()))
 	}
@@ -100,8 +183,91 @@ func New(opts ...Option) *Furl {
 // following endpoints:
 // GET /[key] -  Will redirect the call to the associated URL if it exists, or
 //
-//	will return 404 Not Found if it doesn't exists and 422
-//	Unprocessable Entity if the key is invalid.
+//	will return 404 Not Found if it doesn't exists, 410 Gone if
+//	it has been deleted, and 422 Unprocessable Entity if the key
+//	is invalid.
+//
+//	If the link has a maximum number of uses, each redirect is
+//	counted, and once all of the uses have been used, the
+//	response will be 410 Gone. HEAD requests, previews, and QR
+//	codes are not counted.
+//
+//	If the link has an activation window, the response will be
+//	403 Forbidden before the window opens, and 410 Gone after it
+//	has closed. Previews and QR codes are available at any time.
+//
+//	For a link with a maximum number of uses, an activation
+//	window, or a password, the response will be a 302 Found
+//	redirect with a Cache-Control header of no-store, so that
+//	each visit is checked by the server.
+//
+//	If the link requires an interstitial, as set by the
+//	Interstitial Option or the Meta of the link, the response
+//	will be a 200 OK HTML page asking the user to confirm that
+//	they wish to continue to the URL, instead of a redirect. The
+//	page is produced by the function set with the
+//	InterstitialPage Option, if set, or else by a minimal
+//	built-in template.
+//
+//	If the link has multiple destinations, one is chosen for each
+//	request, according to their weights, and the response will
+//	be a 302 Found redirect to it. When the StickyDestinations
+//	Option has been set, the choice is remembered for each
+//	visitor with a cookie. For GET requests, the number of times
+//	that each destination has been served is counted in the Meta
+//	of the link, in batches set by the ServedBatch Option.
+//
+//	If the link has targeting rules, the first rule that matches
+//	the User-Agent, Accept-Language, or other headers of the
+//	request, or the country of its client address, as found in
+//	the database set with the GeoIP Option, chooses the URL,
+//	with requests that match no rule following the
+//	destinations, or URL, of the link. The
+//	response will be a 302 Found redirect, with a Vary header
+//	listing the headers used by the rules.
+//
+//	If the link is protected by a password, the password must be
+//	supplied using Basic authentication, with any username,
+//	otherwise the response will be 401 Unauthorized. If the Index
+//	Option has been set and the Accept header prefers HTML, the
+//	Index function will be called with the 401 code instead, and
+//	should show a form to submit the password, as below. The same
+//	applies to previews and history of the link.
+//
+// GET /[key]+ -  Will respond with the URL that the key redirects to, along
+//
+//	with its Meta, instead of redirecting. The response will be
+//	JSON, XML, or plain text, as negotiated using the Accept
+//	header, defaulting to JSON. If the Index Option has been set,
+//	an HTML response can be negotiated, which will be produced
+//	by the Index function. A preview can also be requested by
+//	adding a preview query param, e.g. GET /[key]?preview.
+//
+// GET /[key].png - Will respond with a QR code image of the short URL of the
+//
+//	key, instead of redirecting. The short URL uses the base URL
+//	set with the BaseURL Option, or else the host of the request.
+//	An SVG image can be requested with GET /[key].svg, and the
+//	image can also be requested by adding a qr query param, e.g.
+//	GET /[key]?qr or GET /[key]?qr=svg. The following query
+//	params can be used to change the image:
+//
+//	size:  The maximum width of the image, in pixels, up to 4096.
+//	       Each module of the code is drawn as a whole number of
+//	       pixels, four by default.
+//	ecc:   The error correction level, one of L, M (default), Q,
+//	       or H.
+//	quiet: The width of the light border around the code, in
+//	       modules, up to 16 (default 4).
+//
+//	NB: As such, a key ending in .png or .svg cannot be
+//	redirected to.
+//
+// GET /[key]/history - Will respond with all of the revisions of the key,
+//
+//	oldest first, if the Store implements HistoryStore. The
+//	response will be JSON, XML, or plain text, as negotiated
+//	using the Accept header, defaulting to JSON.
 //
 // POST / -      The root can be used to add urls to the store with a generated
 //
@@ -111,8 +277,21 @@ func New(opts ...Option) *Furl {
 // POST /[key] - Will attempt to create the specified path with the URL
 //
 //	provided as below. If the key is invalid, will respond with
-//	422 Unprocessable Entity. This method cannot be used on
-//	existing keys.
+//	422 Unprocessable Entity, and if the key is reserved, will
+//	respond with 403 Forbidden. This method cannot be used on
+//	existing keys, or on deleted keys that are still within
+//	their quarantine period.
+//
+//	If a password is provided, as below, without a URL, the
+//	password will be checked against that of the link, and
+//	for a correct password, the response will be the link as
+//	JSON or XML, or, for a form, the link is followed as for a
+//	GET, with a 303 See Other redirect to the URL, chosen by
+//	any rules or destinations, or an interstitial page.
+//	An incorrect password will result in a 401
+//	Unauthorized. After too many incorrect passwords, further
+//	attempts will result in a 429 Too Many Requests, as set by
+//	the PasswordThrottle Option.
 //
 // The URL for the POST methods can be provided in a few content types:
 // application/json:                  {"key": "KEY HERE", "url": "URL HERE"}
@@ -123,11 +302,50 @@ func New(opts ...Option) *Furl {
 // For the json, xml, and form content types, the key can be omitted if it has
 // been supplied in the path or if the key is to be generated.
 //
+// The json, xml, and form content types can also supply optional metadata for
+// the link, which will be stored if the Store implements MetaStore:
+// application/json:                  "title": "TITLE", "description": "DESC", "tags": ["TAG1", "TAG2"], "password": "PASS", "maxUses": 1, "notBefore": "TIME", "notAfter": "TIME", "interstitial": true, "destinations": [{"url": "URL", "weight": 1}]
+// text/xml:                          <title>TITLE</title><description>DESC</description><tag>TAG1</tag><tag>TAG2</tag><password>PASS</password><maxUses>1</maxUses><notBefore>TIME</notBefore><notAfter>TIME</notAfter><interstitial>true</interstitial><destination><url>URL</url><weight>1</weight></destination>
+// application/x-www-form-urlencoded: title=TITLE&description=DESC&tags=TAG1,TAG2&password=PASS&maxUses=1&notBefore=TIME&notAfter=TIME&interstitial=on&destinations=URL+1%0AURL+2
+//
+// The json and xml content types can also supply targeting rules, which are
+// checked in order, each sending requests that match all of its conditions to
+// its URL:
+// application/json:                  "rules": [{"device": "ios", "url": "URL"}, {"language": "fr", "url": "URL"}, {"header": "NAME", "value": "VALUE", "url": "URL"}, {"country": "GB,IE", "url": "URL"}]
+// text/xml:                          <rule><device>android</device><url>URL</url></rule>
+//
+// The device of a rule is one of ios, android, mobile, or desktop. Invalid
+// rules will result in a 400 Bad Request. The rules of an existing link can be
+// replaced using the SetRules method, or the /rules endpoint of the Admin
+// handler.
+//
+// For the form content type, each line of the destinations is a URL optionally
+// followed by a space and its weight. Each destination URL is checked by the
+// URLValidator, and an invalid URL will result in a 400 Bad Request.
+//
+// Times are in RFC 3339 format, though the form content type also accepts the
+// format of an HTML datetime-local input, 2006-01-02T15:04, in UTC.
+//
+// A password protects the link, and is stored as a salted hash, which is not
+// included in any response.
+//
+// Invalid metadata, such as an overly long title, a tag containing a comma, or
+// metadata larger than 16KB when encoded as JSON, will result in a 400 Bad
+// Request.
+//
+// If the Store does not implement MetaStore, a link with a password, a limit
+// on its uses, a time window, the interstitial flag, destinations, or rules
+// will not be created, and will result in a 501 Not Implemented, as the link
+// would otherwise be created without them.
+//
 // The response type will be determined by the POST content type:
-// application/json: {"key": "KEY HERE", "url": "URL HERE"}
-// text/xml:         <furl><key>KEY HERE</key><url>URL HERE</url></furl>
+// application/json: {"key": "KEY HERE", "url": "URL HERE", "created": "TIME"}
+// text/xml:         <furl><key>KEY HERE</key><url>URL HERE</url><created>TIME</created></furl>
 // text/plain:       KEY HERE
 //
+// The json and xml responses will also contain any supplied metadata, and the
+// created time of the link, as set by the server.
+//
 // For application/x-www-form-urlencoded, the content type of the return will
 // be text/html and the response will match that of text/plain.
 func (f *Furl) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -142,7 +360,18 @@ func (f *Furl) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 }
 
 func (f *Furl) get(w http.ResponseWriter, r *http.Request) {
-	key := path.Base(r.URL.Path)
+	dir, key := pathKey(r.URL.EscapedPath())
+	if key == historySuffix && dir != "/" && dir != "." {
+		_, key = pathKey(dir)
+
+		f.history(w, r, key)
+
+		return
+	}
+
+	key, preview := previewKey(r, key)
+	key, qr := qrKey(r, key)
+
 	if !f.keyValidator(key) {
 		if f.index != nil {
 			f.index(w, r, http.StatusUnprocessableEntity, invalidKey)
@@ -153,9 +382,23 @@ func (f *Furl) get(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	key = f.canonicalise(key)
+
 	url, ok := f.store.Get(key)
-	if ok {
-		http.Redirect(w, r, url, http.StatusMovedPermanently)
+	if ok && f.gone(w, r, key) {
+		return
+	} else if ok && qr != "" {
+		f.qr(w, r, key, qr)
+	} else if ok && !f.unlocked(w, r, key) {
+		return
+	} else if ok && preview {
+		f.preview(w, r, key, url)
+	} else if ok && !f.active(w, r, key) {
+		return
+	} else if ok && r.Method == http.MethodGet && !f.use(key) {
+		f.exhausted(w, r)
+	} else if ok {
+		f.follow(w, r, key, url)
 	} else if f.index != nil {
 		f.index(w, r, http.StatusNotFound, "404 page not found")
 	} else {
@@ -189,6 +432,7 @@ func (f *Furl) writeResponse(w http.ResponseWriter, r *http.Request, status int,
 type keyURL struct {
 	Key string `json:"key" xml:"key"`
 	URL string `json:"url" xml:"url"`
+	*Meta
 }
 
 func (f *Furl) post(w http.ResponseWriter, r *http.Request) {
@@ -204,7 +448,10 @@ func (f *Furl) post(w http.ResponseWriter, r *http.Request) {
 	case "text/xml", "application/xml":
 		err = xml.NewDecoder(r.Body).Decode(&data)
 	case "application/x-www-form-urlencoded":
-		err = r.ParseForm()
+		if err = r.ParseForm(); err == nil {
+			data.Meta, err = formMeta(r.PostForm)
+		}
+
 		data.Key = r.PostForm.Get("key")
 		data.URL = r.PostForm.Get("url")
 		contentType = "text/html"
@@ -221,16 +468,56 @@ func (f *Furl) post(w http.ResponseWriter, r *http.Request) {
 
 	w.Header().Set("Content-Type", contentType)
 
+	if data.Key == "" {
+		_, data.Key = pathKey("/" + r.URL.EscapedPath()) // see if suggested key in path
+	}
+
 	if err != nil {
 		f.writeResponse(w, r, http.StatusBadRequest, contentType, failedReadRequest)
 
 		return
-	} else if len(data.URL) > maxURLLength || data.URL == "" || !f.urlValidator(data.URL) {
+	} else if data.URL == "" && data.Meta != nil && data.Password != "" {
+		f.unlock(w, r, contentType, data.Key, data.Password)
+
+		return
+	} else if !f.validURL(data.URL) {
 		f.writeResponse(w, r, http.StatusBadRequest, contentType, invalidURL)
 
 		return
-	} else if data.Key == "" {
-		data.Key = path.Base("/" + r.URL.Path) // see if suggested key in path
+	} else if data.Meta == nil {
+		data.Meta = new(Meta)
+	} else if !data.Meta.valid() {
+		f.writeResponse(w, r, http.StatusBadRequest, contentType, invalidMeta)
+
+		return
+	} else if !f.validDestinations(data.Destinations) {
+		f.writeResponse(w, r, http.StatusBadRequest, contentType, invalidDestinations)
+
+		return
+	} else if !f.validRules(data.Rules) {
+		f.writeResponse(w, r, http.StatusBadRequest, contentType, invalidRules)
+
+		return
+	} else if data.Meta.restricted() && !storesMeta(f.store) {
+		f.writeResponse(w, r, http.StatusNotImplemented, contentType, unsupportedMeta)
+
+		return
+	}
+
+	data.Created = f.now().UTC()
+	data.Updated = nil
+	data.Uses = 0
+
+	for n := range data.Destinations {
+		data.Destinations[n].Served = 0
+	}
+
+	if data.Password != "" {
+		if data.Password, err = hashPassword(data.Password); err != nil {
+			f.writeResponse(w, r, http.StatusInternalServerError, contentType, err.Error())
+
+			return
+		}
 	}
 
 	var (
@@ -238,39 +525,30 @@ func (f *Furl) post(w http.ResponseWriter, r *http.Request) {
 		errString string
 	)
 	if data.Key == "" || data.Key == "/" || data.Key == "." || data.Key == ".." { // generate key
-		f.store.Tx(func(tx Tx) {
-			for idLength := f.keyLength; ; idLength++ {
-				keyBytes := make([]byte, idLength)
-
-				for i := uint(0); i < f.retries; i++ {
-					f.rand.Read(keyBytes) // NB: will never error
-					data.Key = base64.RawURLEncoding.EncodeToString(keyBytes)
-
-					if ok := tx.Has(data.Key); !ok && f.keyValidator(data.Key) {
-						tx.Set(data.Key, data.URL)
-
-						return
-					}
-				}
-				if idLength == maxKeyLength {
-					errCode = http.StatusInternalServerError
-					errString = failedKeyGeneration
+		key, ok := f.generateKey(actor{SourceHTTP, r}, data.URL, data.Meta)
+		if !ok {
+			errCode = http.StatusInternalServerError
+			errString = failedKeyGeneration
+		}
 
-					return
-				}
-			}
-		})
-	} else if len(data.Key) > maxKeyLength || !f.keyValidator(data.Key) {
+		data.Key = key
+	} else if !f.validKey(data.Key) {
 		f.writeResponse(w, r, http.StatusUnprocessableEntity, contentType, invalidKey)
 
+		return
+	} else if f.reservedKey(data.Key) {
+		f.writeResponse(w, r, http.StatusForbidden, contentType, keyReserved)
+
 		return
 	} else { // use suggested key
-		f.store.Tx(func(tx Tx) {
-			if ok := tx.Has(data.Key); ok {
+		key, meta := f.canonical(data.Key, data.Meta)
+
+		f.keyTx(actor{SourceHTTP, r}, key, func(tx Tx) {
+			if !f.create(tx, key, data.URL) {
 				errCode = http.StatusMethodNotAllowed
 				errString = keyExists
 			} else {
-				tx.Set(data.Key, data.URL)
+				setMeta(tx, key, meta)
 			}
 		})
 	}
@@ -281,6 +559,8 @@ func (f *Furl) post(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	hidePassword(data.Meta)
+
 	switch contentType {
 	case "text/json", "application/json":
 		json.NewEncoder(w).Encode(data)
@@ -298,8 +578,114 @@ func (f *Furl) post(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+func (f *Furl) validURL(url string) bool {
+	return len(url) <= maxURLLength && url != "" && f.urlValidator(url)
+}
+
+func (f *Furl) validKey(key string) bool {
+	return len(key) <= maxKeyLength && f.keyValidator(key)
+}
+
+func formMeta(form url.Values) (*Meta, error) {
+	meta := &Meta{
+		Title:        form.Get("title"),
+		Description:  form.Get("description"),
+		Password:     form.Get("password"),
+		Interstitial: form.Get("interstitial") != "",
+	}
+
+	var err error
+
+	if maxUses := form.Get("maxUses"); maxUses != "" {
+		if meta.MaxUses, err = strconv.ParseUint(maxUses, 10, 64); err != nil {
+			return nil, err
+		}
+	}
+
+	if meta.NotBefore, err = formTime(form, "notBefore"); err != nil {
+		return nil, err
+	} else if meta.NotAfter, err = formTime(form, "notAfter"); err != nil {
+		return nil, err
+	} else if meta.Destinations, err = formDestinations(form); err != nil {
+		return nil, err
+	}
+
+	for _, tags := range form["tags"] {
+		for _, tag := range strings.Split(tags, ",") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				meta.Tags = append(meta.Tags, tag)
+			}
+		}
+	}
+
+	return meta, nil
+}
+
+func (f *Furl) generateKey(a actor, url string, meta *Meta) (string, bool) {
+	if _, ok := f.store.(KeyTxStore); ok {
+		return f.nextKey(func(key string) bool {
+			if !f.keyValidator(key) || f.reservedKey(key) {
+				return false
+			}
+
+			var set bool
+
+			canonical, meta := f.canonical(key, meta)
+
+			f.keyTx(a, canonical, func(tx Tx) {
+				if set = f.create(tx, canonical, url); set {
+					setMeta(tx, canonical, meta)
+				}
+			})
+
+			return set
+		})
+	}
+
+	var (
+		key string
+		ok  bool
+	)
+
+	f.tx(a, func(tx Tx) {
+		key, ok = f.nextKey(func(key string) bool {
+			canonical, meta := f.canonical(key, meta)
+
+			if !f.keyValidator(key) || f.reservedKey(key) || !f.create(tx, canonical, url) {
+				return false
+			}
+
+			setMeta(tx, canonical, meta)
+
+			return true
+		})
+	})
+
+	return key, ok
+}
+
+func (f *Furl) nextKey(try func(string) bool) (string, bool) {
+	for idLength := f.keyLength; ; idLength++ {
+		keyBytes := make([]byte, idLength)
+
+		for i := uint(0); i < f.retries; i++ {
+			f.randMu.Lock()
+			f.rand.Read(keyBytes) // NB: will never error
+			f.randMu.Unlock()
+
+			if key := base64.RawURLEncoding.EncodeToString(keyBytes); try(key) {
+				return key, true
+			}
+		}
+
+		if idLength == maxKeyLength {
+			return "", false
+		}
+	}
+}
+
 func (f *Furl) options(w http.ResponseWriter, r *http.Request) {
-	key := path.Base(r.URL.Path)
+	_, key := pathKey(r.URL.EscapedPath())
 	if key == "" || key == "/" {
 		w.Header().Add("Allow", optionsPost)
 	} else if !f.keyValidator(key) {
@@ -307,7 +693,7 @@ func (f *Furl) options(w http.ResponseWriter, r *http.Request) {
 
 		return
 	} else {
-		_, ok := f.store.Get(key)
+		_, ok := f.store.Get(f.canonicalise(key))
 		if ok {
 			w.Header().Add("Allow", optionsGetHead)
 		} else {
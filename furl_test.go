@@ -7,6 +7,7 @@ import (
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestOptions(t *testing.T) {
@@ -99,6 +100,14 @@ func TestGet(t *testing.T) {
 	}
 }
 
+func post(h http.Handler, key, url string) int {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/"+key, strings.NewReader(url))
+	r.Header.Set("Content-Type", "text/plain")
+	h.ServeHTTP(w, r)
+	return w.Code
+}
+
 type nonrand []int64
 
 func (n *nonrand) Int63() int64 {
@@ -117,13 +126,17 @@ type postTest struct {
 	Status              int
 }
 
+func testClock() time.Time {
+	return time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+}
+
 func testPost(t *testing.T, contentType string, tests []postTest) {
 	rs := nonrand{0, 0, 1, 2}
 	f := New(SetStore(NewStore(Data(map[string]string{
 		"AA": "http://www.google.com",
 	}))), RandomSource(&rs), KeyLength(1), URLValidator(HTTPURL), KeyValidator(func(key string) bool {
 		return key != "ABC"
-	}))
+	}), Clock(testClock))
 	responseType := contentType
 	if contentType == "application/x-www-form-urlencoded" {
 		responseType = "text/html"
@@ -253,7 +266,7 @@ func TestPostJSON(t *testing.T) {
 		},
 		{ // 10
 			Body:     `{"url":"http://google.com"}`,
-			Response: `{"key":"AQ","url":"http://google.com"}`,
+			Response: `{"key":"AQ","url":"http://google.com","created":"2020-01-02T03:04:05Z"}`,
 			Status:   http.StatusOK,
 		},
 		{ // 11
@@ -270,19 +283,29 @@ func TestPostJSON(t *testing.T) {
 		{ // 13
 			Body:     `{"url":"http://google.com"}`,
 			Key:      "Ag",
-			Response: `{"key":"Ag","url":"http://google.com"}`,
+			Response: `{"key":"Ag","url":"http://google.com","created":"2020-01-02T03:04:05Z"}`,
 			Status:   http.StatusOK,
 		},
 		{ // 14
 			Body:     `{"url":"http://google.com"}`,
-			Response: `{"key":"AAA","url":"http://google.com"}`,
+			Response: `{"key":"AAA","url":"http://google.com","created":"2020-01-02T03:04:05Z"}`,
 			Status:   http.StatusOK,
 		},
 		{ // 15
 			Body:     `{"key":"ABCD","url":"http://google.com"}`,
-			Response: `{"key":"ABCD","url":"http://google.com"}`,
+			Response: `{"key":"ABCD","url":"http://google.com","created":"2020-01-02T03:04:05Z"}`,
 			Status:   http.StatusOK,
 		},
+		{ // 16
+			Body:     `{"key":"ABCDE","url":"http://google.com","title":"Google","description":"Search","tags":["search","web"],"created":"2000-01-01T00:00:00Z"}`,
+			Response: `{"key":"ABCDE","url":"http://google.com","title":"Google","description":"Search","tags":["search","web"],"created":"2020-01-02T03:04:05Z"}`,
+			Status:   http.StatusOK,
+		},
+		{ // 17
+			Body:     `{"key":"ABCDEF","url":"http://google.com","tags":["a,b"]}`,
+			Response: fmt.Sprintf(`{"error":%q}`, invalidMeta),
+			Status:   http.StatusBadRequest,
+		},
 	})
 }
 
@@ -337,7 +360,7 @@ func TestPostXML(t *testing.T) {
 		},
 		{ // 10
 			Body:     "<furl><url>http://google.com</url></furl>",
-			Response: "<furl><key>AQ</key><url>http://google.com</url></furl>",
+			Response: "<furl><key>AQ</key><url>http://google.com</url><created>2020-01-02T03:04:05Z</created></furl>",
 			Status:   http.StatusOK,
 		},
 		{ // 11
@@ -354,19 +377,29 @@ func TestPostXML(t *testing.T) {
 		{ // 13
 			Body:     "<furl><url>http://google.com</url></furl>",
 			Key:      "Ag",
-			Response: "<furl><key>Ag</key><url>http://google.com</url></furl>",
+			Response: "<furl><key>Ag</key><url>http://google.com</url><created>2020-01-02T03:04:05Z</created></furl>",
 			Status:   http.StatusOK,
 		},
 		{ // 14
 			Body:     "<furl><url>http://google.com</url></furl>",
-			Response: "<furl><key>AAA</key><url>http://google.com</url></furl>",
+			Response: "<furl><key>AAA</key><url>http://google.com</url><created>2020-01-02T03:04:05Z</created></furl>",
 			Status:   http.StatusOK,
 		},
 		{ // 15
 			Body:     "<furl><key>ABCD</key><url>http://google.com</url></furl>",
-			Response: "<furl><key>ABCD</key><url>http://google.com</url></furl>",
+			Response: "<furl><key>ABCD</key><url>http://google.com</url><created>2020-01-02T03:04:05Z</created></furl>",
 			Status:   http.StatusOK,
 		},
+		{ // 16
+			Body:     "<furl><key>ABCDE</key><url>http://google.com</url><title>Google</title><tag>search</tag><tag>web</tag></furl>",
+			Response: "<furl><key>ABCDE</key><url>http://google.com</url><title>Google</title><tag>search</tag><tag>web</tag><created>2020-01-02T03:04:05Z</created></furl>",
+			Status:   http.StatusOK,
+		},
+		{ // 17
+			Body:     "<furl><key>ABCDEF</key><url>http://google.com</url><title>" + strings.Repeat("A", maxTitleLength+1) + "</title></furl>",
+			Response: "<furl><error>" + invalidMeta + "</error></furl>",
+			Status:   http.StatusBadRequest,
+		},
 	})
 }
 
@@ -450,6 +483,16 @@ func TestPostForm(t *testing.T) {
 			Response: "ABCD",
 			Status:   http.StatusOK,
 		},
+		{ // 16
+			Body:     "key=ABCDE&url=http://google.com&title=Google&tags=search,+web&tags=",
+			Response: "ABCDE",
+			Status:   http.StatusOK,
+		},
+		{ // 17
+			Body:     "key=ABCDEF&url=http://google.com&tags=" + strings.Repeat("A", maxTagLength+1),
+			Response: invalidMeta,
+			Status:   http.StatusBadRequest,
+		},
 	})
 }
 
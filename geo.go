@@ -0,0 +1,65 @@
+package furl
+
+import (
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// clientAddr returns the address of the client that made the request.
+//
+// When the request comes from one of the proxies set with the TrustedProxies
+// Option, the X-Forwarded-For header is read from right to left, skipping any
+// other trusted proxies, to find the address of the client.
+func (f *Furl) clientAddr(r *http.Request) netip.Addr {
+	var addr netip.Addr
+
+	if ap, err := netip.ParseAddrPort(r.RemoteAddr); err == nil {
+		addr = ap.Addr()
+	} else if addr, err = netip.ParseAddr(r.RemoteAddr); err != nil {
+		return netip.Addr{}
+	}
+
+	addr = addr.Unmap()
+
+	if !f.trustedProxy(addr) {
+		return addr
+	}
+
+	forwarded := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+
+	for n := len(forwarded) - 1; n >= 0; n-- {
+		a, err := netip.ParseAddr(strings.TrimSpace(forwarded[n]))
+		if err != nil {
+			break
+		}
+
+		addr = a.Unmap()
+
+		if !f.trustedProxy(addr) {
+			break
+		}
+	}
+
+	return addr
+}
+
+func (f *Furl) trustedProxy(addr netip.Addr) bool {
+	for _, prefix := range f.trustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// country returns the country of the client that made the request, using the
+// database set with the GeoIP Option.
+func (f *Furl) country(r *http.Request) string {
+	if f.geoIP == nil {
+		return ""
+	}
+
+	return f.geoIP.Country(f.clientAddr(r))
+}
@@ -1,3 +1,5 @@
 module vimagination.zapto.org/furl
 
 go 1.19
+
+require golang.org/x/text v0.14.0
@@ -0,0 +1,272 @@
+package furl
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	historySuffix = "history"
+
+	unknownRevision = "unknown revision"
+	notAcceptable   = "not acceptable"
+)
+
+var (
+	xmlHistoryStart = xml.StartElement{
+		Name: xml.Name{
+			Local: "history",
+		},
+	}
+	xmlRevisionStart = xml.StartElement{
+		Name: xml.Name{
+			Local: "revision",
+		},
+	}
+	historyContentTypes = []string{"application/json", "text/json", "application/xml", "text/xml", "text/plain"}
+)
+
+// The Revision type represents a URL, and its Meta, that a key has pointed to.
+type Revision struct {
+	URL string `json:"url" xml:"url"`
+	Meta
+}
+
+// The Time method returns the time that the Revision was made; the Updated
+// time if it was set, otherwise the Created time.
+func (r Revision) Time() time.Time {
+	if r.Updated != nil {
+		return *r.Updated
+	}
+
+	return r.Created
+}
+
+// The HistoryStore interface is an optional extension to the Store interface
+// that allows a Store to keep the previous URLs of each key.
+//
+// The History method should return all of the revisions of the key, oldest
+// first, with the last being the current URL and Meta of the key. A key that
+// does not exist should return no revisions.
+//
+// The Set method of a Tx should record the replaced URL and Meta, if any, as a
+// revision. A Store may limit the number of revisions it keeps for each key,
+// dropping the oldest.
+type HistoryStore interface {
+	Store
+	History(key string) []Revision
+}
+
+func getHistory(s interface{}, key string) ([]Revision, bool) {
+	if hs, ok := s.(interface{ History(string) []Revision }); ok {
+		return hs.History(key), true
+	}
+
+	return nil, false
+}
+
+func (f *Furl) history(w http.ResponseWriter, r *http.Request, key string) {
+	if !f.keyValidator(key) {
+		http.Error(w, invalidKey, http.StatusUnprocessableEntity)
+
+		return
+	}
+
+	key = f.canonicalise(key)
+
+	revisions, ok := getHistory(f.store, key)
+	if !ok || len(revisions) == 0 {
+		http.NotFound(w, r)
+
+		return
+	} else if !f.unlocked(w, r, key) {
+		return
+	}
+
+	for n := range revisions {
+		hidePassword(&revisions[n].Meta)
+	}
+
+	contentType := negotiate(r.Header.Get("Accept"), historyContentTypes)
+	if contentType == "" {
+		http.Error(w, notAcceptable, http.StatusNotAcceptable)
+
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+
+	if r.Method == http.MethodHead {
+		return
+	}
+
+	switch contentType {
+	case "application/json", "text/json":
+		json.NewEncoder(w).Encode(revisions)
+	case "application/xml", "text/xml":
+		x := xml.NewEncoder(w)
+
+		x.EncodeToken(xmlHistoryStart)
+
+		for _, rev := range revisions {
+			x.EncodeElement(rev, xmlRevisionStart)
+		}
+
+		x.EncodeToken(xmlHistoryStart.End())
+		x.Flush()
+	default:
+		for _, rev := range revisions {
+			fmt.Fprintf(w, "%s %s\n", rev.Time().Format(time.RFC3339), rev.URL)
+		}
+	}
+}
+
+// negotiate chooses the first of the offered content types with the highest
+// quality in the Accept header, returning an empty string if none are
+// acceptable. An empty Accept header accepts the first offered type.
+func negotiate(accept string, offers []string) string {
+	if accept == "" {
+		return offers[0]
+	}
+
+	type mediaRange struct {
+		typ string
+		q   float64
+	}
+
+	var ranges []mediaRange
+
+	for _, part := range strings.Split(accept, ",") {
+		params := strings.Split(part, ";")
+		mr := mediaRange{typ: strings.ToLower(strings.TrimSpace(params[0])), q: 1}
+
+		for _, param := range params[1:] {
+			if k, v, ok := strings.Cut(strings.TrimSpace(param), "="); ok && strings.TrimSpace(k) == "q" {
+				if q, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil {
+					mr.q = q
+				}
+			}
+		}
+
+		ranges = append(ranges, mr)
+	}
+
+	sort.SliceStable(ranges, func(i, j int) bool {
+		return ranges[i].q > ranges[j].q
+	})
+
+	for _, mr := range ranges {
+		if mr.q <= 0 {
+			break
+		}
+
+		for _, offer := range offers {
+			if mr.typ == offer || mr.typ == "*/*" || strings.HasSuffix(mr.typ, "/*") && strings.HasPrefix(offer, mr.typ[:len(mr.typ)-1]) {
+				return offer
+			}
+		}
+	}
+
+	return ""
+}
+
+// The Rollback method sets the key back to the URL and Meta of one of its
+// previous revisions, as numbered by their position in the list returned by
+// the History method of the Store, starting at zero.
+//
+// The rollback is recorded as a new revision, with its Updated time set to the
+// current time. The Created time, the Uses count, and the Served counts of
+// destinations that are still in use are kept from the current Meta, so that
+// a rollback cannot reset the limits of a link.
+//
+// A deleted key cannot be rolled back, returning ErrDeleted; it should first be
+// reinstated with the Restore method.
+//
+// The Store must implement the HistoryStore interface, otherwise
+// ErrHistoryUnsupported will be returned.
+func (f *Furl) Rollback(key string, revision int) error {
+	return f.rollback(actor{source: SourceRollback}, key, revision)
+}
+
+func (f *Furl) rollback(a actor, key string, revision int) error {
+	key = f.canonicalise(key)
+
+	revisions, ok := getHistory(f.store, key)
+	if !ok {
+		return ErrHistoryUnsupported
+	} else if len(revisions) == 0 {
+		return fmt.Errorf("key %s: %w", key, ErrMissingKey)
+	} else if revision < 0 || revision >= len(revisions) {
+		return fmt.Errorf("key %s, revision %d: %w", key, revision, ErrUnknownRevision)
+	}
+
+	rev := revisions[revision]
+	now := f.now().UTC()
+	rev.Updated = &now
+
+	var err error
+
+	f.keyTx(a, key, func(tx Tx) {
+		current, _ := getMeta(tx, key)
+		if !tx.Has(key) {
+			err = fmt.Errorf("key %s: %w", key, ErrMissingKey)
+
+			return
+		} else if current.Deleted != nil {
+			err = fmt.Errorf("key %s: %w", key, ErrDeleted)
+
+			return
+		}
+
+		rev.Created = current.Created
+		rev.Deleted = nil
+		rev.Uses = current.Uses
+		rev.Destinations = servedDestinations(rev.Destinations, current.Destinations)
+
+		if rev.Created.IsZero() {
+			rev.Created = now
+		}
+
+		tx.Set(key, rev.URL)
+		setMeta(tx, key, &rev.Meta)
+	})
+
+	return err
+}
+
+// servedDestinations returns a copy of the destinations with the Served counts
+// taken from the current destinations with the same URL.
+func servedDestinations(destinations, current []Destination) []Destination {
+	if len(destinations) == 0 {
+		return destinations
+	}
+
+	served := make(map[string]uint64, len(current))
+
+	for _, d := range current {
+		served[d.URL] = d.Served
+	}
+
+	destinations = append([]Destination(nil), destinations...)
+
+	for n, d := range destinations {
+		if s, ok := served[d.URL]; ok {
+			destinations[n].Served = s
+		}
+	}
+
+	return destinations
+}
+
+// Errors.
+var (
+	ErrHistoryUnsupported = errors.New("store does not support history")
+	ErrUnknownRevision    = errors.New(unknownRevision)
+)
@@ -0,0 +1,166 @@
+package furl
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestHistory(t *testing.T) {
+	for n, s := range [...]Store{
+		NewStore(),
+		NewShardedStore(2),
+	} {
+		f := New(SetStore(s), Clock(testClock))
+		if code := post(f, "AAA", "http://www.example.com/1"); code != http.StatusOK {
+			t.Fatalf("test %d: expecting response code 200, got %d", n+1, code)
+		}
+		if _, err := f.Import(strings.NewReader(`{"key":"AAA","url":"http://www.example.com/2","title":"Two"}`), JSONLines, ConflictOverwrite); err != nil {
+			t.Fatalf("test %d: unexpected error importing: %s", n+1, err)
+		}
+		for m, test := range [...]struct {
+			Path, Accept, ContentType, Response string
+			Code                                int
+		}{
+			{ // 1
+				Path:        "/AAA/history",
+				ContentType: "application/json",
+				Response:    `[{"url":"http://www.example.com/1","created":"2020-01-02T03:04:05Z"},{"url":"http://www.example.com/2","title":"Two","created":"2020-01-02T03:04:05Z","updated":"2020-01-02T03:04:05Z"}]`,
+				Code:        http.StatusOK,
+			},
+			{ // 2
+				Path:        "/AAA/history",
+				Accept:      "text/html;q=1, text/xml;q=0.9, */*;q=0.1",
+				ContentType: "text/xml",
+				Response:    `<history><revision><url>http://www.example.com/1</url><created>2020-01-02T03:04:05Z</created></revision><revision><url>http://www.example.com/2</url><title>Two</title><created>2020-01-02T03:04:05Z</created><updated>2020-01-02T03:04:05Z</updated></revision></history>`,
+				Code:        http.StatusOK,
+			},
+			{ // 3
+				Path:        "/AAA/history",
+				Accept:      "text/plain, text/*;q=0.5",
+				ContentType: "text/plain",
+				Response:    "2020-01-02T03:04:05Z http://www.example.com/1\n2020-01-02T03:04:05Z http://www.example.com/2",
+				Code:        http.StatusOK,
+			},
+			{ // 4
+				Path:   "/AAA/history",
+				Accept: "image/png",
+				Code:   http.StatusNotAcceptable,
+			},
+			{ // 5
+				Path: "/BBB/history",
+				Code: http.StatusNotFound,
+			},
+			{ // 6
+				Path:     "/history",
+				Code:     http.StatusNotFound,
+				Response: "404 page not found",
+			},
+		} {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, test.Path, nil)
+			if test.Accept != "" {
+				r.Header.Set("Accept", test.Accept)
+			}
+			f.ServeHTTP(w, r)
+			if w.Code != test.Code {
+				t.Errorf("test %d.%d: expecting response code %d, got %d", n+1, m+1, test.Code, w.Code)
+			} else if test.Code != http.StatusOK {
+				continue
+			} else if contentType := w.Header().Get("Content-Type"); test.ContentType != "" && contentType != test.ContentType {
+				t.Errorf("test %d.%d: expecting content type %q, got %q", n+1, m+1, test.ContentType, contentType)
+			} else if response := strings.TrimSpace(w.Body.String()); response != test.Response {
+				t.Errorf("test %d.%d: expecting response %q, got %q", n+1, m+1, test.Response, response)
+			}
+		}
+		if err := f.Rollback("AAA", 0); err != nil {
+			t.Errorf("test %d: unexpected error rolling back: %s", n+1, err)
+		} else if url, _ := s.Get("AAA"); url != "http://www.example.com/1" {
+			t.Errorf("test %d: expecting url to be rolled back, got %q", n+1, url)
+		} else if history := s.(HistoryStore).History("AAA"); len(history) != 3 || history[2].Updated == nil {
+			t.Errorf("test %d: expecting rollback to be recorded as a new revision, got %v", n+1, history)
+		}
+		if err := f.Rollback("AAA", 3); !errors.Is(err, ErrUnknownRevision) {
+			t.Errorf("test %d: expecting error %v, got %v", n+1, ErrUnknownRevision, err)
+		} else if err := f.Rollback("BBB", 0); !errors.Is(err, ErrMissingKey) {
+			t.Errorf("test %d: expecting error %v, got %v", n+1, ErrMissingKey, err)
+		}
+		for m, test := range [...]struct {
+			Body string
+			Code int
+		}{
+			{ // 1
+				Body: "key=AAA&revision=1",
+				Code: http.StatusNoContent,
+			},
+			{ // 2
+				Body: "key=AAA&revision=a",
+				Code: http.StatusBadRequest,
+			},
+			{ // 3
+				Body: "key=AAA&revision=10",
+				Code: http.StatusNotFound,
+			},
+		} {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, "/rollback", strings.NewReader(test.Body))
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			f.Admin().ServeHTTP(w, r)
+			if w.Code != test.Code {
+				t.Errorf("test %d.%d: expecting response code %d, got %d", n+1, m+1, test.Code, w.Code)
+			}
+		}
+		if url, _ := s.Get("AAA"); url != "http://www.example.com/2" {
+			t.Errorf("test %d: expecting url to be rolled back by admin, got %q", n+1, url)
+		}
+	}
+	if err := New(SetStore(noSnapshotStore{NewStore()})).Rollback("AAA", 0); !errors.Is(err, ErrHistoryUnsupported) {
+		t.Errorf("expecting error %v, got %v", ErrHistoryUnsupported, err)
+	}
+}
+
+func TestRollbackLimits(t *testing.T) {
+	s := NewStore()
+	f := New(SetStore(s), Clock(testClock))
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"key":"AAA","url":"http://www.example.com/1","maxUses":2}`))
+	r.Header.Set("Content-Type", "application/json")
+	f.ServeHTTP(httptest.NewRecorder(), r)
+	s.Tx(func(tx Tx) {
+		tx.Set("AAA", "http://www.example.com/2")
+		setMeta(tx, "AAA", &Meta{Created: testClock(), MaxUses: 2})
+	})
+	get := func() int {
+		w := httptest.NewRecorder()
+		f.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/AAA", nil))
+		return w.Code
+	}
+	get()
+	get()
+	if err := f.Rollback("AAA", 0); err != nil {
+		t.Fatalf("unexpected error rolling back: %s", err)
+	} else if meta, _ := getMeta(s, "AAA"); meta.Uses != 2 {
+		t.Errorf("expecting uses to be kept, got %d", meta.Uses)
+	} else if code := get(); code != http.StatusGone {
+		t.Errorf("expecting used up link to stay used up, got %d", code)
+	}
+	if err := f.Delete("AAA"); err != nil {
+		t.Fatalf("unexpected error deleting: %s", err)
+	} else if err := f.Rollback("AAA", 0); !errors.Is(err, ErrDeleted) {
+		t.Errorf("expecting error %v, got %v", ErrDeleted, err)
+	} else if meta, _ := getMeta(s, "AAA"); meta.Deleted == nil {
+		t.Error("expecting key to remain deleted")
+	}
+	for i := 0; i < maxHistory+10; i++ {
+		s.Tx(func(tx Tx) {
+			tx.Set("BBB", "http://www.example.com/B"+strconv.Itoa(i))
+		})
+	}
+	if history := s.(HistoryStore).History("BBB"); len(history) != maxHistory+1 {
+		t.Errorf("expecting %d revisions, got %d", maxHistory+1, len(history))
+	} else if history[0].URL != "http://www.example.com/B9" {
+		t.Errorf("expecting oldest revisions to be dropped, got %q", history[0].URL)
+	}
+}
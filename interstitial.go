@@ -0,0 +1,82 @@
+package furl
+
+import (
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+var interstitialPage = template.Must(template.New("").Parse(`<!doctype html>
+<html lang="en">
+	<head>
+		<title>Leaving {{.Host}}</title>
+		<meta name="robots" content="noindex" />
+	</head>
+	<body>
+		<p>You are leaving {{.Host}} for {{.Destination}}</p>
+		<p><a href="{{.URL}}" rel="noreferrer">Continue to {{.URL}}</a></p>
+	</body>
+</html>
+`))
+
+// interstitial determines whether a confirmation page should be shown before
+// following the link, either because the link has the Interstitial flag set in
+// its Meta, or because the Interstitial Option has been set and the URL is not
+// on one of the trusted domains.
+func (f *Furl) interstitial(key, uri string) bool {
+	if meta, _ := getMeta(f.store, key); meta.Interstitial {
+		return true
+	} else if !f.interstitialAll {
+		return false
+	}
+
+	return !trustedDomain(f.trustedDomains, destination(uri))
+}
+
+// trustedDomain returns true if the host is one of the domains, or a subdomain
+// of one of them.
+func trustedDomain(domains []string, host string) bool {
+	for _, domain := range domains {
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func destination(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil || u.Hostname() == "" {
+		return uri
+	}
+
+	return strings.ToLower(u.Hostname())
+}
+
+// confirm writes the interstitial page for the URL, using the function set
+// with the InterstitialPage Option, if set, or else a minimal built-in page.
+func (f *Furl) confirm(w http.ResponseWriter, r *http.Request, uri string) {
+	w.Header().Set("Referrer-Policy", "no-referrer")
+
+	if f.interstitialPage != nil {
+		f.interstitialPage(w, r, uri)
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+
+	if r.Method == http.MethodHead {
+		return
+	}
+
+	interstitialPage.Execute(w, struct {
+		Host, Destination, URL string
+	}{
+		Host:        r.Host,
+		Destination: destination(uri),
+		URL:         uri,
+	})
+}
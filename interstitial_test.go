@@ -0,0 +1,104 @@
+package furl
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestInterstitial(t *testing.T) {
+	f := New(Interstitial("Example.com", ".trusted.org"))
+	g := New(SetStore(f.store))
+	post(f, "AAA", "http://www.example.com/")
+	post(f, "BBB", "https://other.net/path?a=1&b=2")
+	post(f, "CCC", "https://trusted.org/")
+	post(f, "DDD", "https://notexample.com/")
+	r := httptest.NewRequest(http.MethodPost, "/EEE", strings.NewReader(`{"url":"https://www.example.com/flagged","interstitial":true}`))
+	r.Header.Set("Content-Type", "application/json")
+	f.ServeHTTP(httptest.NewRecorder(), r)
+	for n, test := range [...]struct {
+		Furl     *Furl
+		Path     string
+		Code     int
+		Location string
+		Body     string
+	}{
+		{ // 1
+			Furl:     f,
+			Path:     "/AAA",
+			Code:     http.StatusMovedPermanently,
+			Location: "http://www.example.com/",
+		},
+		{ // 2
+			Furl: f,
+			Path: "/BBB",
+			Code: http.StatusOK,
+			Body: `<p>You are leaving furl.example for other.net</p>`,
+		},
+		{ // 3
+			Furl: f,
+			Path: "/BBB",
+			Code: http.StatusOK,
+			Body: `<a href="https://other.net/path?a=1&amp;b=2" rel="noreferrer">`,
+		},
+		{ // 4
+			Furl:     f,
+			Path:     "/CCC",
+			Code:     http.StatusMovedPermanently,
+			Location: "https://trusted.org/",
+		},
+		{ // 5
+			Furl: f,
+			Path: "/DDD",
+			Code: http.StatusOK,
+			Body: "notexample.com",
+		},
+		{ // 6
+			Furl: f,
+			Path: "/EEE",
+			Code: http.StatusOK,
+			Body: "https://www.example.com/flagged",
+		},
+		{ // 7
+			Furl:     g,
+			Path:     "/BBB",
+			Code:     http.StatusMovedPermanently,
+			Location: "https://other.net/path?a=1&b=2",
+		},
+		{ // 8
+			Furl: g,
+			Path: "/EEE",
+			Code: http.StatusOK,
+			Body: "You are leaving furl.example for www.example.com",
+		},
+		{ // 9
+			Furl: f,
+			Path: "/BBB+",
+			Code: http.StatusOK,
+			Body: `"url":"https://other.net/path?a=1\u0026b=2"`,
+		},
+	} {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "http://furl.example"+test.Path, nil)
+		test.Furl.ServeHTTP(w, r)
+		if w.Code != test.Code {
+			t.Errorf("test %d: expecting response code %d, got %d", n+1, test.Code, w.Code)
+		} else if location := w.Header().Get("Location"); location != test.Location {
+			t.Errorf("test %d: expecting location %q, got %q", n+1, test.Location, location)
+		} else if !strings.Contains(w.Body.String(), test.Body) {
+			t.Errorf("test %d: expecting body to contain %q, got %q", n+1, test.Body, w.Body.String())
+		}
+	}
+	var indexed, output string
+	f.index = func(w http.ResponseWriter, _ *http.Request, _ int, o string) {
+		indexed = o
+	}
+	f.interstitialPage = func(w http.ResponseWriter, _ *http.Request, url string) {
+		output = url
+	}
+	f.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/BBB", nil))
+	if indexed != "" || output != "https://other.net/path?a=1&b=2" {
+		t.Errorf("expecting interstitial page to be called with the URL, got %q (index %q)", output, indexed)
+	}
+}
@@ -0,0 +1,251 @@
+package furl
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+const (
+	maxTitleLength       = 256
+	maxDescriptionLength = 2048
+	maxTags              = 32
+	maxTagLength         = 64
+	maxMetaSize          = 16 << 10 // JSON encoded, leaving room for the fields set by Furl
+
+	invalidMeta     = "invalid metadata"
+	unsupportedMeta = "link restrictions not supported by store"
+)
+
+// The Meta type contains the optional metadata for a link.
+//
+// The Created time is set by Furl when the link is created, and the Updated
+// time is set when the URL of an existing link is changed. The Deleted time is
+// set when the link is deleted, leaving a tombstone in place of the link.
+//
+// The Display key is set when a link is created with a key that differs from
+// the canonical form under which it is stored, as set by the Canonicalise
+// Option, and holds the key as it was given.
+//
+// The Password is set when a link is protected by a password, and holds a
+// salted hash of the password. When creating a link, the Password should be
+// set to the password itself, which Furl will replace with its hash.
+//
+// The MaxUses is set when a link can only be followed a limited number of
+// times, and Uses counts the number of times that it has been followed. Once
+// all of its uses have been used, a link responds with 410 Gone.
+//
+// NB: Uses are counted in the Store that serves the link, so a Replica counts
+// its uses separately from its Primary.
+//
+// The NotBefore and NotAfter times are set when a link should only redirect
+// during a window of time. Before the NotBefore time, a link responds with 403
+// Forbidden, and from the NotAfter time, it responds with 410 Gone.
+//
+// The Interstitial flag is set when a link, such as one to a flagged
+// destination, should always show a confirmation page instead of redirecting,
+// regardless of the Interstitial Option and its trusted domains.
+//
+// The Destinations are set when a link should split its traffic across
+// multiple URLs, with one chosen for each request according to their weights.
+// The URL of the link is still returned by previews and the Resolve method.
+//
+// The Rules are set when a link should send requests from some devices,
+// languages, or other matching requests to other URLs. The first Rule that
+// matches a request is used, and requests that match none of the Rules follow
+// the Destinations, if set, or else the URL of the link.
+type Meta struct {
+	Title        string        `json:"title,omitempty" xml:"title,omitempty"`
+	Description  string        `json:"description,omitempty" xml:"description,omitempty"`
+	Tags         []string      `json:"tags,omitempty" xml:"tag,omitempty"`
+	Created      time.Time     `json:"created" xml:"created"`
+	Updated      *time.Time    `json:"updated,omitempty" xml:"updated,omitempty"`
+	Deleted      *time.Time    `json:"deleted,omitempty" xml:"deleted,omitempty"`
+	Display      string        `json:"display,omitempty" xml:"display,omitempty"`
+	Password     string        `json:"password,omitempty" xml:"password,omitempty"`
+	MaxUses      uint64        `json:"maxUses,omitempty" xml:"maxUses,omitempty"`
+	Uses         uint64        `json:"uses,omitempty" xml:"uses,omitempty"`
+	NotBefore    *time.Time    `json:"notBefore,omitempty" xml:"notBefore,omitempty"`
+	NotAfter     *time.Time    `json:"notAfter,omitempty" xml:"notAfter,omitempty"`
+	Interstitial bool          `json:"interstitial,omitempty" xml:"interstitial,omitempty"`
+	Destinations []Destination `json:"destinations,omitempty" xml:"destination,omitempty"`
+	Rules        []Rule        `json:"rules,omitempty" xml:"rule,omitempty"`
+}
+
+// The HasTags method returns true if the Meta contains all of the given tags.
+func (m Meta) HasTags(tags ...string) bool {
+	for _, tag := range tags {
+		found := false
+
+		for _, t := range m.Tags {
+			if t == tag {
+				found = true
+
+				break
+			}
+		}
+
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (m *Meta) isZero() bool {
+	return m.Title == "" && m.Description == "" && len(m.Tags) == 0 && m.Created.IsZero() && m.Updated == nil && m.Deleted == nil && m.Display == "" && m.Password == "" && m.MaxUses == 0 && m.Uses == 0 && m.NotBefore == nil && m.NotAfter == nil && !m.Interstitial && len(m.Destinations) == 0 && len(m.Rules) == 0
+}
+
+// restricted returns true if the Meta changes how the link is followed, such
+// that the link must not be created without it.
+func (m *Meta) restricted() bool {
+	return m.Password != "" || m.MaxUses > 0 || m.NotBefore != nil || m.NotAfter != nil || m.Interstitial || len(m.Destinations) > 0 || len(m.Rules) > 0
+}
+
+func newKeyURL(key, url string, meta Meta) keyURL {
+	ku := keyURL{Key: key, URL: url}
+
+	if !meta.isZero() {
+		ku.Meta = &meta
+	}
+
+	return ku
+}
+
+func (m *Meta) valid() bool {
+	if len(m.Title) > maxTitleLength || len(m.Description) > maxDescriptionLength || len(m.Tags) > maxTags || len(m.Display) > maxKeyLength || len(m.Password) > maxPasswordLength || len(m.Destinations) > maxDestinations || len(m.Rules) > maxRules {
+		return false
+	} else if m.NotBefore != nil && m.NotAfter != nil && !m.NotBefore.Before(*m.NotAfter) {
+		return false
+	}
+
+	for _, tag := range m.Tags {
+		if tag == "" || len(tag) > maxTagLength || strings.ContainsRune(tag, ',') {
+			return false
+		}
+	}
+
+	data, err := json.Marshal(m)
+
+	return err == nil && len(data) <= maxMetaSize
+}
+
+// The MetaStore interface is an optional extension to the Store interface that
+// allows a Store to hold the metadata for each link.
+//
+// The GetMeta method should return the Meta set for the key, and whether any
+// Meta has been set.
+//
+// A Store that implements this interface should pass a Tx that implements the
+// MetaTx interface to its Tx methods.
+type MetaStore interface {
+	Store
+	GetMeta(key string) (Meta, bool)
+}
+
+// The MetaTx interface is an optional extension to the Tx interface that
+// allows the metadata for a link to be stored.
+//
+// The GetMeta method should return the Meta set for the key, as seen by the Tx,
+// and whether any Meta has been set.
+//
+// The SetMeta method will be called after the URL for the key has been set,
+// and should replace any existing Meta for the key. A call to Set should remove
+// any existing Meta for the key.
+type MetaTx interface {
+	Tx
+	GetMeta(key string) (Meta, bool)
+	SetMeta(key string, meta Meta)
+}
+
+// The MetaRanger interface is an optional extension to the Ranger interface
+// that allows the metadata of each link to be iterated over along with the
+// key and URL.
+//
+// The RangeMeta method should call the passed function for each key:url pair,
+// along with its Meta, or a zero Meta if none has been set, stopping when the
+// function returns false.
+type MetaRanger interface {
+	Ranger
+	RangeMeta(fn func(key, url string, meta Meta) bool)
+}
+
+// storesMeta returns true if the Store keeps the Meta of its links, looking
+// through a Primary or Replica to the Store that it wraps.
+func storesMeta(s Store) bool {
+	switch s := s.(type) {
+	case *Primary:
+		return storesMeta(s.Store)
+	case *Replica:
+		return storesMeta(s.local)
+	}
+
+	_, ok := s.(MetaStore)
+
+	return ok
+}
+
+func getMeta(s interface{}, key string) (Meta, bool) {
+	if ms, ok := s.(interface{ GetMeta(string) (Meta, bool) }); ok {
+		return ms.GetMeta(key)
+	}
+
+	return Meta{}, false
+}
+
+func setMeta(tx Tx, key string, meta *Meta) {
+	if mt, ok := tx.(MetaTx); ok && meta != nil {
+		mt.SetMeta(key, *meta)
+	}
+}
+
+func rangeMeta(r Ranger, fn func(key, url string, meta Meta) bool) {
+	if mr, ok := r.(MetaRanger); ok {
+		mr.RangeMeta(fn)
+	} else {
+		r.Range(func(key, url string) bool {
+			return fn(key, url, Meta{})
+		})
+	}
+}
+
+type tagged struct {
+	Ranger
+	tags []string
+}
+
+// The Tagged function wraps a Ranger so that only the links that have all of
+// the given tags will be iterated over.
+//
+// The Ranger must implement the MetaRanger interface for any links to match.
+func Tagged(r Ranger, tags ...string) MetaRanger {
+	return tagged{Ranger: r, tags: tags}
+}
+
+func (t tagged) Range(fn func(key, url string) bool) {
+	t.RangeMeta(func(key, url string, _ Meta) bool {
+		return fn(key, url)
+	})
+}
+
+func (t tagged) RangeMeta(fn func(key, url string, meta Meta) bool) {
+	if _, ok := t.Ranger.(MetaRanger); !ok && len(t.tags) > 0 {
+		return
+	}
+
+	rangeMeta(t.Ranger, func(key, url string, meta Meta) bool {
+		if !meta.HasTags(t.tags...) {
+			return true
+		}
+
+		return fn(key, url, meta)
+	})
+}
+
+// Errors.
+var (
+	ErrInvalidMeta     = errors.New(invalidMeta)
+	ErrMetaUnsupported = errors.New(unsupportedMeta)
+)
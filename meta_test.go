@@ -0,0 +1,190 @@
+package furl
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMeta(t *testing.T) {
+	btree, err := OpenBTreeStore(filepath.Join(t.TempDir(), "furl.btree"))
+	if err != nil {
+		t.Fatalf("unexpected error opening btree: %s", err)
+	}
+	defer btree.Close()
+	created := testClock()
+	for n, s := range [...]Store{
+		NewStore(),
+		NewShardedStore(2),
+		btree,
+		testPrimary(t, NewStore()),
+	} {
+		f := New(SetStore(s), Clock(testClock))
+		for _, body := range [...]string{
+			`{"key":"AAA","url":"http://www.example.com/A","title":"A","tags":["one","two"]}`,
+			`{"key":"BBB","url":"http://www.example.com/B","description":"B","tags":["two"]}`,
+			`{"key":"CCC","url":"http://www.example.com/C"}`,
+		} {
+			r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+			r.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			f.ServeHTTP(w, r)
+			if w.Code != http.StatusOK {
+				t.Fatalf("test %d: expecting response code 200, got %d", n+1, w.Code)
+			}
+		}
+		if meta, ok := s.(MetaStore).GetMeta("AAA"); !ok {
+			t.Errorf("test %d: expecting meta for key AAA", n+1)
+		} else if expected := (Meta{Title: "A", Tags: []string{"one", "two"}, Created: created}); !reflect.DeepEqual(meta, expected) {
+			t.Errorf("test %d: expecting meta %v, got %v", n+1, expected, meta)
+		}
+		if meta, _ := s.(MetaStore).GetMeta("CCC"); !meta.Created.Equal(created) {
+			t.Errorf("test %d: expecting created time %s, got %s", n+1, created, meta.Created)
+		}
+		var sb strings.Builder
+		if err := Export(&sb, Tagged(s.(Ranger), "two"), JSONLines); err != nil {
+			t.Errorf("test %d: unexpected error exporting: %s", n+1, err)
+		}
+		dst := NewStore()
+		if count, err := New(SetStore(dst)).Import(strings.NewReader(sb.String()), JSONLines, ConflictFail); err != nil {
+			t.Errorf("test %d: unexpected error importing: %s", n+1, err)
+		} else if count != 2 {
+			t.Errorf("test %d: expecting 2 tagged links, got %d", n+1, count)
+		} else if meta, _ := dst.(MetaStore).GetMeta("BBB"); meta.Description != "B" || !meta.Created.Equal(created) {
+			t.Errorf("test %d: expecting imported meta to be kept, got %v", n+1, meta)
+		}
+		w := httptest.NewRecorder()
+		f.Admin().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/links?tag=one&tag=two", nil))
+		if w.Code != http.StatusOK {
+			t.Errorf("test %d: expecting response code 200, got %d", n+1, w.Code)
+		} else if list := w.Body.String(); !strings.HasPrefix(list, `{"key":"AAA"`) || strings.Count(list, "\n") != 1 {
+			t.Errorf("test %d: expecting a single tagged link, got %q", n+1, list)
+		}
+		s.Tx(func(tx Tx) {
+			tx.Set("AAA", "http://www.example.com/AA")
+		})
+		if _, ok := s.(MetaStore).GetMeta("AAA"); ok {
+			t.Errorf("test %d: expecting Set to remove meta", n+1)
+		}
+	}
+}
+
+func TestImportMeta(t *testing.T) {
+	now := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := NewStore()
+	f := New(SetStore(s), Clock(func() time.Time { return now }))
+	if _, err := f.Import(strings.NewReader(`<furls><furl><key>AAA</key><url>http://www.example.com</url><tag>a,b</tag></furl></furls>`), XML, ConflictFail); err == nil {
+		t.Error("expecting error importing invalid meta")
+	}
+	if _, err := f.Import(strings.NewReader(`<furls><furl><key>AAA</key><url>http://www.example.com</url><title>A</title><tag>a</tag></furl></furls>`), XML, ConflictFail); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	} else if meta, _ := s.(MetaStore).GetMeta("AAA"); !reflect.DeepEqual(meta, Meta{Title: "A", Tags: []string{"a"}, Created: now}) {
+		t.Errorf("expecting imported meta, got %v", meta)
+	}
+}
+
+func TestMetaSize(t *testing.T) {
+	var panics int
+	s := NewShardedStore(2, SaveMeta(func(string, Meta) {
+		panics++
+		panic("save failed")
+	}))
+	f := New(SetStore(s), URLValidator(HTTPURL))
+	destinations := make([]Destination, maxDestinations)
+	for n := range destinations {
+		destinations[n].URL = "http://www.example.com/" + strings.Repeat("a", maxURLLength-24)
+	}
+	if (&Meta{Destinations: destinations}).valid() {
+		t.Error("expecting oversized meta to be invalid")
+	}
+	r := httptest.NewRequest(http.MethodPost, "/AAA", strings.NewReader(`{"url":"http://www.example.com/","destinations":[{"url":"http://www.example.com/`+strings.Repeat("a", maxURLLength-24)+`"}`+strings.Repeat(`,{"url":"http://www.example.com/`+strings.Repeat("a", maxURLLength-24)+`"}`, maxDestinations-1)+`]}`))
+	r.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	f.ServeHTTP(w, r)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expecting response code 400, got %d", w.Code)
+	} else if _, ok := s.Get("AAA"); ok {
+		t.Error("expecting link not to be created")
+	}
+	for _, tx := range [...]func(func(Tx)){s.Tx, func(fn func(Tx)) { s.(KeyTxStore).KeyTx("AAA", fn) }} {
+		func() {
+			defer func() {
+				recover()
+			}()
+			tx(func(tx Tx) {
+				tx.Set("AAA", "http://www.example.com/")
+				tx.(MetaTx).SetMeta("AAA", Meta{Title: "A"})
+			})
+		}()
+	}
+	if panics != 2 {
+		t.Errorf("expecting 2 panics, got %d", panics)
+	}
+	done := make(chan struct{})
+	go func() {
+		s.Tx(func(tx Tx) {})
+		s.(KeyTxStore).KeyTx("AAA", func(tx Tx) {})
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Error("expecting store to be unlocked after a panic")
+	}
+}
+
+func TestMetaUnsupported(t *testing.T) {
+	s := struct{ Store }{NewStore()}
+	f := New(SetStore(s), URLValidator(HTTPURL))
+	for n, test := range [...]struct {
+		Body string
+		Code int
+	}{
+		{ // 1
+			Body: `{"key":"AAA","url":"http://www.example.com/","title":"A"}`,
+			Code: http.StatusOK,
+		},
+		{ // 2
+			Body: `{"key":"BBB","url":"http://www.example.com/","password":"secret"}`,
+			Code: http.StatusNotImplemented,
+		},
+		{ // 3
+			Body: `{"key":"CCC","url":"http://www.example.com/","maxUses":1}`,
+			Code: http.StatusNotImplemented,
+		},
+		{ // 4
+			Body: `{"key":"DDD","url":"http://www.example.com/","notAfter":"2030-01-01T00:00:00Z"}`,
+			Code: http.StatusNotImplemented,
+		},
+		{ // 5
+			Body: `{"url":"http://www.example.com/","rules":[{"device":"ios","url":"http://www.example.com/ios"}]}`,
+			Code: http.StatusNotImplemented,
+		},
+	} {
+		r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(test.Body))
+		r.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		f.ServeHTTP(w, r)
+		if w.Code != test.Code {
+			t.Errorf("test %d: expecting response code %d, got %d", n+1, test.Code, w.Code)
+		}
+	}
+	count := 0
+	s.Store.(Ranger).Range(func(string, string) bool {
+		count++
+		return true
+	})
+	if count != 1 {
+		t.Errorf("expecting 1 link to be created, got %d", count)
+	}
+	if _, err := f.Import(strings.NewReader(`{"key":"EEE","url":"http://www.example.com/","password":"secret"}`), JSONLines, ConflictFail); !errors.Is(err, ErrMetaUnsupported) {
+		t.Errorf("expecting error ErrMetaUnsupported, got %v", err)
+	} else if err := f.SetRules("AAA", []Rule{{Device: deviceIOS, URL: "http://www.example.com/ios"}}); !errors.Is(err, ErrMetaUnsupported) {
+		t.Errorf("expecting error ErrMetaUnsupported, got %v", err)
+	}
+}
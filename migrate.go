@@ -0,0 +1,112 @@
+package furl
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// The Migrate function copies all of the key:url pairs from the src Ranger to
+// the dst Store.
+//
+// Keys that already exist in dst with the same URL are skipped, which allows
+// an interrupted migration to be resumed by calling Migrate again. A key that
+// exists in dst with a different URL will stop the migration with an error
+// wrapping ErrKeyExists.
+//
+// If src implements MetaRanger, the Meta for each key will also be copied.
+//
+// Returns the number of key:url pairs that were set in dst.
+func Migrate(dst Store, src Ranger) (int, error) {
+	var (
+		count int
+		err   error
+	)
+
+	rangeMeta(src, func(key, url string, meta Meta) bool {
+		var set bool
+
+		if set, err = migrateKey(dst, key, url, newKeyURL(key, url, meta).Meta); set {
+			count++
+		}
+
+		return err == nil
+	})
+
+	return count, err
+}
+
+// The MigrateKey function copies a single key:url pair to the dst Store, and
+// can be used to copy writes made to a live source after the initial Migrate.
+//
+// Returns true if the key was set, false if it already existed with the same
+// URL, and an error wrapping ErrKeyExists if it existed with a different URL.
+func MigrateKey(dst Store, key, url string) (bool, error) {
+	return migrateKey(dst, key, url, nil)
+}
+
+func migrateKey(dst Store, key, url string, meta *Meta) (bool, error) {
+	var set bool
+
+	keyTx(dst, key, func(tx Tx) {
+		if set = create(tx, key, url); set {
+			setMeta(tx, key, meta)
+		}
+	})
+
+	if !set {
+		if existing, _ := dst.Get(key); existing != url {
+			return false, fmt.Errorf("key %s: %w", key, ErrKeyExists)
+		}
+	}
+
+	return set, nil
+}
+
+// The Verify function checks that every key:url pair in the src Ranger exists
+// in the dst Store with the same URL and, if src implements MetaRanger, the
+// same Meta.
+//
+// Returns the number of pairs verified. On a mismatch, the returned error will
+// wrap either ErrMissingKey, ErrURLMismatch, or ErrMetaMismatch.
+func Verify(dst Store, src Ranger) (int, error) {
+	var (
+		count int
+		err   error
+	)
+
+	_, checkMeta := src.(MetaRanger)
+
+	rangeMeta(src, func(key, url string, meta Meta) bool {
+		if got, ok := dst.Get(key); !ok {
+			err = fmt.Errorf("key %s: %w", key, ErrMissingKey)
+		} else if got != url {
+			err = fmt.Errorf("key %s: %w", key, ErrURLMismatch)
+		} else if got, _ := getMeta(dst, key); checkMeta && !sameMeta(got, meta) {
+			err = fmt.Errorf("key %s: %w", key, ErrMetaMismatch)
+		} else {
+			count++
+		}
+
+		return err == nil
+	})
+
+	return count, err
+}
+
+// sameMeta compares the Meta as encoded, so that times in different locations
+// are treated as the same.
+func sameMeta(a, b Meta) bool {
+	ja, errA := json.Marshal(a)
+	jb, errB := json.Marshal(b)
+
+	return errA == nil && errB == nil && bytes.Equal(ja, jb)
+}
+
+// Errors.
+var (
+	ErrMissingKey   = errors.New("missing key")
+	ErrURLMismatch  = errors.New("url mismatch")
+	ErrMetaMismatch = errors.New("meta mismatch")
+)
@@ -0,0 +1,56 @@
+package furl
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestMigrate(t *testing.T) {
+	src := NewStore(Data(map[string]string{
+		"AAA": "http://www.google.com",
+		"BBB": "http://www.example.com",
+		"CCC": "http://www.example.com/C",
+	})).(Ranger)
+	dst := NewShardedStore(2, Data(map[string]string{
+		"AAA": "http://www.google.com",
+	}))
+	if n, err := Migrate(dst, src); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	} else if n != 2 {
+		t.Errorf("expecting 2 keys migrated, got %d", n)
+	}
+	if n, err := Verify(dst, src); err != nil {
+		t.Errorf("unexpected error verifying: %s", err)
+	} else if n != 3 {
+		t.Errorf("expecting 3 keys verified, got %d", n)
+	}
+	if n, err := Migrate(dst, src); err != nil {
+		t.Errorf("unexpected error resuming: %s", err)
+	} else if n != 0 {
+		t.Errorf("expecting 0 keys migrated on resume, got %d", n)
+	}
+	if set, err := MigrateKey(dst, "DDD", "http://www.example.com/D"); err != nil {
+		t.Errorf("unexpected error migrating key: %s", err)
+	} else if !set {
+		t.Error("expecting key DDD to be set")
+	}
+	if _, err := MigrateKey(dst, "DDD", "http://www.example.com/E"); !errors.Is(err, ErrKeyExists) {
+		t.Errorf("expecting error %v, got %v", ErrKeyExists, err)
+	}
+	if _, err := Verify(NewStore(), src); !errors.Is(err, ErrMissingKey) {
+		t.Errorf("expecting error %v, got %v", ErrMissingKey, err)
+	}
+	if _, err := Verify(NewStore(Data(map[string]string{
+		"AAA": "http://www.google.com",
+		"BBB": "http://www.example.com/B",
+		"CCC": "http://www.example.com/C",
+	})), src); !errors.Is(err, ErrURLMismatch) {
+		t.Errorf("expecting error %v, got %v", ErrURLMismatch, err)
+	}
+	src.(Store).Tx(func(tx Tx) {
+		setMeta(tx, "AAA", &Meta{Title: "A"})
+	})
+	if _, err := Verify(dst, src); !errors.Is(err, ErrMetaMismatch) {
+		t.Errorf("expecting error %v, got %v", ErrMetaMismatch, err)
+	}
+}
@@ -0,0 +1,436 @@
+package furl
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/netip"
+	"os"
+	"strings"
+)
+
+const (
+	mmdbPointer   = 1
+	mmdbString    = 2
+	mmdbDouble    = 3
+	mmdbBytes     = 4
+	mmdbUint16    = 5
+	mmdbUint32    = 6
+	mmdbMap       = 7
+	mmdbInt32     = 8
+	mmdbUint64    = 9
+	mmdbUint128   = 10
+	mmdbArray     = 11
+	mmdbContainer = 12
+	mmdbEnd       = 13
+	mmdbBool      = 14
+	mmdbFloat     = 15
+
+	mmdbSeparator   = 16
+	mmdbMaxMetadata = 128 << 10
+	mmdbMaxDepth    = 32
+)
+
+var mmdbMetadataStart = []byte("\xab\xcd\xefMaxMind.com")
+
+// The MMDB type is a GeoIP database, in the MaxMind DB format, such as the
+// GeoLite2 Country and City databases, which is used to find the country of
+// an IP address.
+//
+// An MMDB is safe for concurrent use.
+type MMDB struct {
+	tree       []byte
+	section    []byte
+	nodeCount  uint
+	recordSize uint
+	ipVersion  uint
+	ipv4Start  uint
+}
+
+// OpenMMDB reads an MMDB from the file with the given filename.
+func OpenMMDB(filename string) (*MMDB, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("error opening geoip database: %w", err)
+	}
+
+	defer f.Close()
+
+	return LoadMMDB(f)
+}
+
+// LoadMMDB reads an MMDB from the given reader.
+func LoadMMDB(r io.Reader) (*MMDB, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("error reading geoip database: %w", err)
+	}
+
+	start := len(data) - mmdbMaxMetadata
+	if start < 0 {
+		start = 0
+	}
+
+	pos := bytes.LastIndex(data[start:], mmdbMetadataStart)
+	if pos < 0 {
+		return nil, ErrInvalidMMDB
+	}
+
+	metadata := data[start+pos+len(mmdbMetadataStart):]
+
+	var (
+		d    = mmdbDecoder{data: metadata}
+		m    = new(MMDB)
+		keys = map[string]*uint{
+			"node_count":  &m.nodeCount,
+			"record_size": &m.recordSize,
+			"ip_version":  &m.ipVersion,
+		}
+	)
+
+	typ, size, offset, err := d.control(0)
+	if err != nil {
+		return nil, err
+	} else if typ != mmdbMap {
+		return nil, ErrInvalidMMDB
+	}
+
+	for ; size > 0; size-- {
+		var key string
+
+		if key, offset, err = d.string(offset); err != nil {
+			return nil, err
+		}
+
+		if v, ok := keys[key]; ok {
+			if *v, offset, err = d.uint(offset); err != nil {
+				return nil, err
+			}
+		} else if offset, err = d.skip(offset, 0); err != nil {
+			return nil, err
+		}
+	}
+
+	if m.recordSize != 24 && m.recordSize != 28 && m.recordSize != 32 || m.ipVersion != 4 && m.ipVersion != 6 {
+		return nil, ErrInvalidMMDB
+	}
+
+	treeSize := m.nodeCount * m.recordSize / 4
+
+	if treeSize+mmdbSeparator > uint(start+pos) {
+		return nil, ErrInvalidMMDB
+	}
+
+	m.tree = data[:treeSize]
+	m.section = data[treeSize+mmdbSeparator : start+pos]
+
+	if m.ipVersion == 6 {
+		for i := 0; i < 96 && m.ipv4Start < m.nodeCount; i++ {
+			m.ipv4Start = m.record(m.ipv4Start, 0)
+		}
+	}
+
+	return m, nil
+}
+
+func (m *MMDB) record(node, bit uint) uint {
+	b := m.tree[node*m.recordSize/4:]
+
+	switch m.recordSize {
+	case 24:
+		b = b[bit*3:]
+
+		return uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+	case 28:
+		if bit == 0 {
+			return uint(b[3]&0xf0)<<20 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+		}
+
+		return uint(b[3]&0x0f)<<24 | uint(b[4])<<16 | uint(b[5])<<8 | uint(b[6])
+	}
+
+	return uint(binary.BigEndian.Uint32(b[bit*4:]))
+}
+
+// The Country method returns the ISO 3166-1 alpha-2 code, in upper case, of the
+// country of the given address, or an empty string if the country is not
+// known.
+//
+// The country is taken from the country of the record for the address, or
+// else from its registered country.
+func (m *MMDB) Country(addr netip.Addr) string {
+	offset, ok := m.lookup(addr)
+	if !ok {
+		return ""
+	}
+
+	d := mmdbDecoder{data: m.section}
+
+	for _, field := range [...]string{"country", "registered_country"} {
+		if country, err := d.path(offset, field, "iso_code"); err == nil && country != "" {
+			return strings.ToUpper(country)
+		}
+	}
+
+	return ""
+}
+
+func (m *MMDB) lookup(addr netip.Addr) (uint, bool) {
+	addr = addr.Unmap()
+
+	if !addr.IsValid() || addr.Is6() && m.ipVersion == 4 {
+		return 0, false
+	}
+
+	var (
+		ip   = addr.AsSlice()
+		node uint
+	)
+
+	if addr.Is4() && m.ipVersion == 6 {
+		node = m.ipv4Start
+	}
+
+	for i := uint(0); i < uint(len(ip))*8 && node < m.nodeCount; i++ {
+		node = m.record(node, uint(ip[i>>3]>>(7-i&7))&1)
+	}
+
+	if node <= m.nodeCount {
+		return 0, false
+	}
+
+	offset := node - m.nodeCount - mmdbSeparator
+	if offset >= uint(len(m.section)) {
+		return 0, false
+	}
+
+	return offset, true
+}
+
+type mmdbDecoder struct {
+	data []byte
+}
+
+func (d mmdbDecoder) bytes(offset, n uint) ([]byte, error) {
+	if offset+n > uint(len(d.data)) || offset+n < offset {
+		return nil, ErrInvalidMMDB
+	}
+
+	return d.data[offset : offset+n], nil
+}
+
+// control reads the control byte, and any extended type and size bytes, at
+// the offset, returning the type, size, and offset of the data that follows.
+//
+// For a pointer, the size is the offset that it points to.
+func (d mmdbDecoder) control(offset uint) (uint, uint, uint, error) {
+	b, err := d.bytes(offset, 1)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+
+	offset++
+
+	typ, size := uint(b[0]>>5), uint(b[0]&0x1f)
+
+	if typ == mmdbPointer {
+		n := size>>3 + 1
+
+		p, err := d.bytes(offset, n)
+		if err != nil {
+			return 0, 0, 0, err
+		}
+
+		pointer := size & 7
+
+		if n == 4 {
+			pointer = 0
+		}
+
+		for _, c := range p {
+			pointer = pointer<<8 | uint(c)
+		}
+
+		switch n {
+		case 2:
+			pointer += 2048
+		case 3:
+			pointer += 526336
+		}
+
+		return typ, pointer, offset + n, nil
+	} else if typ == 0 {
+		e, err := d.bytes(offset, 1)
+		if err != nil {
+			return 0, 0, 0, err
+		}
+
+		typ = 7 + uint(e[0])
+		offset++
+	}
+
+	if size >= 29 {
+		n := size - 28
+
+		s, err := d.bytes(offset, n)
+		if err != nil {
+			return 0, 0, 0, err
+		}
+
+		offset += n
+		size = 0
+
+		for _, c := range s {
+			size = size<<8 | uint(c)
+		}
+
+		size += [...]uint{29, 285, 65821}[n-1]
+	}
+
+	return typ, size, offset, nil
+}
+
+// resolve follows a pointer at the offset, returning the type, size, and data
+// offset of the value, and, for a pointer, the offset after the pointer.
+func (d mmdbDecoder) resolve(offset uint) (uint, uint, uint, uint, error) {
+	typ, size, next, err := d.control(offset)
+	if err != nil || typ != mmdbPointer {
+		return typ, size, next, 0, err
+	}
+
+	typ, size, data, err := d.control(size)
+	if err == nil && typ == mmdbPointer {
+		err = ErrInvalidMMDB
+	}
+
+	return typ, size, data, next, err
+}
+
+func (d mmdbDecoder) string(offset uint) (string, uint, error) {
+	typ, size, data, next, err := d.resolve(offset)
+	if err != nil {
+		return "", 0, err
+	} else if typ != mmdbString {
+		return "", 0, ErrInvalidMMDB
+	}
+
+	s, err := d.bytes(data, size)
+	if err != nil {
+		return "", 0, err
+	} else if next == 0 {
+		next = data + size
+	}
+
+	return string(s), next, nil
+}
+
+func (d mmdbDecoder) uint(offset uint) (uint, uint, error) {
+	typ, size, data, next, err := d.resolve(offset)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	switch typ {
+	case mmdbUint16, mmdbUint32, mmdbUint64:
+		if size > 8 {
+			return 0, 0, ErrInvalidMMDB
+		}
+	default:
+		return 0, 0, ErrInvalidMMDB
+	}
+
+	b, err := d.bytes(data, size)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var v uint64
+
+	for _, c := range b {
+		v = v<<8 | uint64(c)
+	}
+
+	if v > math.MaxUint32 {
+		return 0, 0, ErrInvalidMMDB
+	} else if next == 0 {
+		next = data + size
+	}
+
+	return uint(v), next, nil
+}
+
+// skip returns the offset after the value at the offset.
+func (d mmdbDecoder) skip(offset, depth uint) (uint, error) {
+	if depth > mmdbMaxDepth {
+		return 0, ErrInvalidMMDB
+	}
+
+	typ, size, next, err := d.control(offset)
+	if err != nil {
+		return 0, err
+	}
+
+	switch typ {
+	case mmdbPointer, mmdbBool, mmdbEnd:
+		return next, nil
+	case mmdbMap:
+		size *= 2
+
+		fallthrough
+	case mmdbArray:
+		for ; size > 0; size-- {
+			if next, err = d.skip(next, depth+1); err != nil {
+				return 0, err
+			}
+		}
+
+		return next, nil
+	}
+
+	if _, err := d.bytes(next, size); err != nil {
+		return 0, err
+	}
+
+	return next + size, nil
+}
+
+// path returns the string found by following the keys of nested maps from the
+// value at the offset.
+func (d mmdbDecoder) path(offset uint, keys ...string) (string, error) {
+	for _, key := range keys {
+		typ, size, data, _, err := d.resolve(offset)
+		if err != nil {
+			return "", err
+		} else if typ != mmdbMap {
+			return "", ErrInvalidMMDB
+		}
+
+		found := false
+
+		for offset = data; size > 0 && !found; size-- {
+			var k string
+
+			if k, offset, err = d.string(offset); err != nil {
+				return "", err
+			} else if found = k == key; !found {
+				if offset, err = d.skip(offset, 0); err != nil {
+					return "", err
+				}
+			}
+		}
+
+		if !found {
+			return "", nil
+		}
+	}
+
+	s, _, err := d.string(offset)
+
+	return s, err
+}
+
+// Errors.
+var ErrInvalidMMDB = errors.New("invalid geoip database")
@@ -0,0 +1,336 @@
+package furl
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+)
+
+type mmdbNetwork struct {
+	Prefix, Country, Registered string
+}
+
+var testNetworks = [...]mmdbNetwork{
+	{Prefix: "192.0.2.0/24", Country: "GB"},
+	{Prefix: "198.51.100.0/24", Country: "FR"},
+	{Prefix: "203.0.113.0/25", Country: "US"},
+	{Prefix: "203.0.113.128/25", Registered: "JP"},
+	{Prefix: "2001:db8::/32", Country: "DE"},
+	{Prefix: "2001:db8:1::/48", Country: "IE"},
+}
+
+func putControl(typ, size int) []byte {
+	var b []byte
+
+	if typ <= mmdbMap {
+		b = []byte{byte(typ << 5)}
+	} else {
+		b = []byte{0, byte(typ - 7)}
+	}
+
+	switch {
+	case size < 29:
+		b[0] |= byte(size)
+	case size < 285:
+		b[0] |= 29
+		b = append(b, byte(size-29))
+	case size < 65821:
+		b[0] |= 30
+		b = binary.BigEndian.AppendUint16(b, uint16(size-285))
+	default:
+		b[0] |= 31
+		b = append(b, byte((size-65821)>>16), byte((size-65821)>>8), byte(size-65821))
+	}
+
+	return b
+}
+
+func putString(s string) []byte {
+	return append(putControl(mmdbString, len(s)), s...)
+}
+
+func putUint(typ int, v uint64) []byte {
+	var b []byte
+
+	for ; v > 0; v >>= 8 {
+		b = append([]byte{byte(v)}, b...)
+	}
+
+	return append(putControl(typ, len(b)), b...)
+}
+
+func putPointer(p int) []byte {
+	return []byte{byte(mmdbPointer<<5 | p>>8&7), byte(p)}
+}
+
+// buildMMDB creates a MaxMind DB, with the given IP version and record size,
+// containing the given networks.
+func buildMMDB(ipVersion, recordSize int, networks []mmdbNetwork) []byte {
+	type child struct {
+		node, data int
+	}
+
+	var (
+		nodes   = [][2]child{{}}
+		section = putString("iso_code")
+	)
+
+	sort.SliceStable(networks, func(i, j int) bool {
+		return netip.MustParsePrefix(networks[i].Prefix).Bits() < netip.MustParsePrefix(networks[j].Prefix).Bits()
+	})
+
+	for _, network := range networks {
+		var (
+			prefix = netip.MustParsePrefix(network.Prefix)
+			ip     = prefix.Addr().AsSlice()
+			bits   = prefix.Bits()
+			data   = len(section)
+			record = append(putControl(mmdbMap, 2), putString("continent")...)
+		)
+
+		record = append(record, putControl(mmdbMap, 2)...)
+		record = append(record, putString("code")...)
+		record = append(record, putString("XX")...)
+		record = append(record, putString("geoname_id")...)
+		record = append(record, putUint(mmdbUint32, 6255148)...)
+
+		if network.Country != "" {
+			record = append(record, putString("country")...)
+		} else {
+			record = append(record, putString("registered_country")...)
+		}
+
+		record = append(record, putControl(mmdbMap, 1)...)
+		record = append(record, putPointer(0)...)
+		record = append(record, putString(network.Country+network.Registered)...)
+		section = append(section, record...)
+
+		if prefix.Addr().Is4() && ipVersion == 6 {
+			ip = append(make([]byte, 12), ip...)
+			bits += 96
+		}
+
+		node := 0
+
+		for i := 0; i < bits; i++ {
+			bit := ip[i>>3] >> (7 - i&7) & 1
+
+			if i == bits-1 {
+				nodes[node][bit] = child{data: data + 1}
+			} else if c := nodes[node][bit]; c.node == 0 {
+				nodes = append(nodes, [2]child{c, c})
+				nodes[node][bit] = child{node: len(nodes) - 1}
+				node = len(nodes) - 1
+			} else {
+				node = c.node
+			}
+		}
+	}
+
+	var db []byte
+
+	for _, n := range nodes {
+		var records [2]uint32
+
+		for bit, c := range n {
+			switch {
+			case c.node != 0:
+				records[bit] = uint32(c.node)
+			case c.data != 0:
+				records[bit] = uint32(len(nodes) + mmdbSeparator + c.data - 1)
+			default:
+				records[bit] = uint32(len(nodes))
+			}
+		}
+
+		switch recordSize {
+		case 24:
+			for _, r := range records {
+				db = append(db, byte(r>>16), byte(r>>8), byte(r))
+			}
+		case 28:
+			db = append(db, byte(records[0]>>16), byte(records[0]>>8), byte(records[0]), byte(records[0]>>20&0xf0|records[1]>>24&0x0f), byte(records[1]>>16), byte(records[1]>>8), byte(records[1]))
+		case 32:
+			db = binary.BigEndian.AppendUint32(db, records[0])
+			db = binary.BigEndian.AppendUint32(db, records[1])
+		}
+	}
+
+	db = append(db, make([]byte, mmdbSeparator)...)
+	db = append(db, section...)
+	db = append(db, mmdbMetadataStart...)
+	db = append(db, putControl(mmdbMap, 9)...)
+
+	for _, kv := range [...][2][]byte{
+		{putString("binary_format_major_version"), putUint(mmdbUint16, 2)},
+		{putString("binary_format_minor_version"), putUint(mmdbUint16, 0)},
+		{putString("build_epoch"), putUint(mmdbUint64, 1577934245)},
+		{putString("database_type"), putString("Furl-Test-Country")},
+		{putString("description"), append(append(putControl(mmdbMap, 1), putString("en")...), putString("Furl test database")...)},
+		{putString("ip_version"), putUint(mmdbUint16, uint64(ipVersion))},
+		{putString("languages"), append(putControl(mmdbArray, 1), putString("en")...)},
+		{putString("node_count"), putUint(mmdbUint32, uint64(len(nodes)))},
+		{putString("record_size"), putUint(mmdbUint16, uint64(recordSize))},
+	} {
+		db = append(db, kv[0]...)
+		db = append(db, kv[1]...)
+	}
+
+	return db
+}
+
+func TestMMDB(t *testing.T) {
+	fixture, err := OpenMMDB("testdata/geo.mmdb")
+	if err != nil {
+		t.Fatalf("unexpected error loading fixture: %s", err)
+	}
+	dbs := []*MMDB{fixture}
+	for _, ipVersion := range [...]int{4, 6} {
+		for _, recordSize := range [...]int{24, 28, 32} {
+			db, err := LoadMMDB(bytes.NewReader(buildMMDB(ipVersion, recordSize, testNetworks[:])))
+			if err != nil {
+				t.Fatalf("unexpected error loading database (v%d, %d bit): %s", ipVersion, recordSize, err)
+			}
+			dbs = append(dbs, db)
+		}
+	}
+	for n, test := range [...]struct {
+		Addr, Country string
+		IPv6          bool
+	}{
+		{"192.0.2.1", "GB", false},
+		{"192.0.2.255", "GB", false},
+		{"192.0.3.1", "", false},
+		{"198.51.100.7", "FR", false},
+		{"::ffff:198.51.100.7", "FR", false},
+		{"203.0.113.1", "US", false},
+		{"203.0.113.200", "JP", false},
+		{"10.0.0.1", "", false},
+		{"2001:db8::1", "DE", true},
+		{"2001:db8:1::1", "IE", true},
+		{"2001:db8:2::1", "DE", true},
+		{"2001:db9::1", "", true},
+	} {
+		for m, db := range dbs {
+			expected := test.Country
+			if test.IPv6 && db.ipVersion == 4 {
+				expected = ""
+			}
+			if country := db.Country(netip.MustParseAddr(test.Addr)); country != expected {
+				t.Errorf("test %d.%d: expecting country %q for %s, got %q", n+1, m+1, expected, test.Addr, country)
+			}
+		}
+	}
+}
+
+func TestMMDBInvalid(t *testing.T) {
+	db := buildMMDB(6, 24, testNetworks[:])
+	for n, data := range [...][]byte{
+		nil,
+		db[:len(db)-20],
+		bytes.Replace(db, mmdbMetadataStart, []byte("not metadata"), 1),
+		bytes.Replace(db, append(putString("record_size"), putUint(mmdbUint16, 24)...), append(putString("record_size"), putUint(mmdbUint16, 26)...), 1),
+		append(append(append(append(append(append(append(append([]byte{}, mmdbMetadataStart...), putControl(mmdbMap, 3)...), putString("node_count")...), putUint(mmdbUint32, 1000)...), putString("record_size")...), putUint(mmdbUint16, 24)...), putString("ip_version")...), putUint(mmdbUint16, 6)...),
+	} {
+		if _, err := LoadMMDB(bytes.NewReader(data)); !errors.Is(err, ErrInvalidMMDB) {
+			t.Errorf("test %d: expecting error ErrInvalidMMDB, got %v", n+1, err)
+		}
+	}
+	if _, err := OpenMMDB("testdata/missing.mmdb"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expecting error os.ErrNotExist, got %v", err)
+	}
+}
+
+func TestGeoRules(t *testing.T) {
+	db, _ := OpenMMDB("testdata/geo.mmdb")
+	f := New(URLValidator(HTTPURL), GeoIP(db), TrustedProxies(netip.MustParsePrefix("10.0.0.0/8"), netip.MustParsePrefix("::1/128")))
+	r := httptest.NewRequest(http.MethodPost, "/AAA", strings.NewReader(`{"url":"http://www.example.com/","rules":[{"country":"GB,ie","url":"http://www.example.co.uk/"},{"country":"FR","device":"mobile","url":"http://m.example.fr/"},{"country":"FR","url":"http://www.example.fr/"}]}`))
+	r.Header.Set("Content-Type", "application/json")
+	f.ServeHTTP(httptest.NewRecorder(), r)
+	for n, test := range [...]struct {
+		RemoteAddr, Forwarded, UserAgent, Location string
+	}{
+		{ // 1
+			RemoteAddr: "192.0.2.1:1234",
+			Location:   "http://www.example.co.uk/",
+		},
+		{ // 2
+			RemoteAddr: "[2001:db8:1::1]:1234",
+			Location:   "http://www.example.co.uk/",
+		},
+		{ // 3
+			RemoteAddr: "198.51.100.1:1234",
+			Location:   "http://www.example.fr/",
+		},
+		{ // 4
+			RemoteAddr: "198.51.100.1:1234",
+			UserAgent:  testAndroid,
+			Location:   "http://m.example.fr/",
+		},
+		{ // 5
+			RemoteAddr: "203.0.113.1:1234",
+			Location:   "http://www.example.com/",
+		},
+		{ // 6
+			RemoteAddr: "10.1.2.3:1234",
+			Forwarded:  "192.0.2.1",
+			Location:   "http://www.example.co.uk/",
+		},
+		{ // 7
+			RemoteAddr: "10.1.2.3:1234",
+			Forwarded:  "192.0.2.1, 198.51.100.1, 10.9.9.9",
+			Location:   "http://www.example.fr/",
+		},
+		{ // 8
+			RemoteAddr: "203.0.113.1:1234",
+			Forwarded:  "192.0.2.1",
+			Location:   "http://www.example.com/",
+		},
+		{ // 9
+			RemoteAddr: "[::1]:1234",
+			Forwarded:  "garbage, 10.0.0.1",
+			Location:   "http://www.example.com/",
+		},
+		{ // 10
+			RemoteAddr: "10.1.2.3:1234",
+			Forwarded:  "10.0.0.1",
+			Location:   "http://www.example.com/",
+		},
+	} {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/AAA", nil)
+		r.RemoteAddr = test.RemoteAddr
+		if test.Forwarded != "" {
+			r.Header.Set("X-Forwarded-For", test.Forwarded)
+		}
+		if test.UserAgent != "" {
+			r.Header.Set("User-Agent", test.UserAgent)
+		}
+		f.ServeHTTP(w, r)
+		if w.Code != http.StatusFound {
+			t.Errorf("test %d: expecting response code 302, got %d", n+1, w.Code)
+		} else if location := w.Header().Get("Location"); location != test.Location {
+			t.Errorf("test %d: expecting location %q, got %q", n+1, test.Location, location)
+		}
+	}
+	for n, country := range [...]string{"G", "GBR", "G1", "GB,", ",GB"} {
+		if err := f.SetRules("AAA", []Rule{{Country: country, URL: "http://www.example.com/"}}); !errors.Is(err, ErrInvalidRules) {
+			t.Errorf("test %d: expecting error ErrInvalidRules, got %v", n+1, err)
+		}
+	}
+	g := New(SetStore(f.store))
+	w := httptest.NewRecorder()
+	r = httptest.NewRequest(http.MethodGet, "/AAA", nil)
+	r.RemoteAddr = "192.0.2.1:1234"
+	g.ServeHTTP(w, r)
+	if location := w.Header().Get("Location"); location != "http://www.example.com/" {
+		t.Errorf("expecting location without a database to be %q, got %q", "http://www.example.com/", location)
+	}
+}
@@ -3,7 +3,10 @@ package furl
 import (
 	"math/rand"
 	"net/http"
+	"net/netip"
 	"net/url"
+	"strings"
+	"time"
 )
 
 // The Option type is used to specify optional params to the New function call
@@ -80,11 +83,225 @@ func RandomSource(source rand.Source) Option {
 	}
 }
 
+// The Clock Option allows the specifying of a custom source of the current
+// time, which is used to set the Created time of new links.
+func Clock(now func() time.Time) Option {
+	return func(f *Furl) {
+		f.now = now
+	}
+}
+
+// The Audit Option sets an AuditSink that will receive an AuditRecord for each
+// link that is created or changed by Furl.
+func Audit(sink AuditSink) Option {
+	return func(f *Furl) {
+		f.audit = sink
+	}
+}
+
+// The AuditUser Option sets the function used to determine the User of an
+// AuditRecord from the HTTP request that made the change. The default is the
+// BasicAuthUser function.
+func AuditUser(user func(*http.Request) string) Option {
+	return func(f *Furl) {
+		f.auditUser = user
+	}
+}
+
+// The Quarantine Option sets how long a deleted key is kept out of use, after
+// which the key can be reused for a new link. A zero duration, the default,
+// keeps deleted keys out of use until they are purged.
+func Quarantine(d time.Duration) Option {
+	return func(f *Furl) {
+		f.quarantine = d
+	}
+}
+
+// The Reserved Option sets a list of keys that cannot be used, either as a
+// suggested key or a generated key.
+//
+// Keys are checked both as given and in the canonical form set by the
+// Canonicalise Option, against the patterns converted to the same form.
+func Reserved(keys *ReservedKeys) Option {
+	return func(f *Furl) {
+		f.reserved = keys
+	}
+}
+
+// The Canonicalise Option sets a function that converts keys to a canonical
+// form, which is used to store and look up keys, so that keys which only
+// differ in ways that users are likely to mistype, such as case, refer to the
+// same link. The FoldCase, FoldUnicode, and FoldLookalikes functions can be
+// used for this.
+//
+// Keys are validated in the form they are given, and a key that differs from
+// its canonical form is kept as the Display key in the Meta of the link.
+//
+// NB: Keys already in the Store are not converted, so this Option should be
+// set before any links are created.
+func Canonicalise(fn func(key string) string) Option {
+	return func(f *Furl) {
+		f.canonicalise = fn
+	}
+}
+
+// The BaseURL Option sets the base URL that the links of this instance are
+// served from, such as https://example.com/s/, so that the Resolve method can
+// recognise its short URLs. It can be set multiple times for instances served
+// from more than one base URL, in which case the first is used to create the
+// short URLs encoded in QR codes.
+//
+// The host of the base URL is matched without regard to case, and the scheme is
+// ignored. Once a base URL has been set, with this Option or the Tenant Option,
+// short URLs that do not match any of the base URLs will not be resolved.
+func BaseURL(base string) Option {
+	return func(f *Furl) {
+		f.bases = append(f.bases, parseBaseURL(base, nil))
+	}
+}
+
+// The Tenant Option sets the base URL of another Furl instance, such as one
+// serving a different domain, so that the Resolve method can resolve short URLs
+// from that instance as well as its own.
+//
+// NB: The keys of short URLs for the tenant are validated and canonicalised
+// using the Options of the tenant.
+func Tenant(base string, tenant *Furl) Option {
+	return func(f *Furl) {
+		f.bases = append(f.bases, parseBaseURL(base, tenant))
+	}
+}
+
+// The PasswordThrottle Option sets how many incorrect passwords a client can try
+// for a password protected link before further attempts from that client are
+// delayed. Each further incorrect password doubles the delay, starting from one
+// second, up to the given maximum delay. While delayed, attempts are rejected
+// with a 429 Too Many Requests response.
+//
+// Attempts are counted as they are made, so that concurrent guesses are also
+// delayed, and the count for a client is forgotten once it has not tried the
+// password for a day.
+//
+// Clients are identified by their address, as set by the TrustedProxies
+// Option, so that one client cannot lock the users of a link out of it, though
+// clients sharing an address share their attempts.
+//
+// NB: As attempts are counted for each client, guesses spread across many
+// addresses are only limited by the number of addresses, so the passwords of
+// links should not be easy to guess.
+func PasswordThrottle(attempts uint, maxDelay time.Duration) Option {
+	return func(f *Furl) {
+		f.passwordFree = attempts
+		f.passwordMaxDelay = maxDelay
+	}
+}
+
+// The Interstitial Option sets all links to show a confirmation page, telling
+// the user that they are leaving this site for the host of the URL, instead of
+// redirecting, unless the URL is on one of the given trusted domains or their
+// subdomains. The domains are matched without regard to case.
+//
+// The page is produced by the function set with the InterstitialPage Option,
+// if set, or else by a minimal built-in template that links to the URL.
+//
+// NB: A link with the Interstitial flag set in its Meta always shows the page,
+// even if its URL is on a trusted domain.
+func Interstitial(trusted ...string) Option {
+	return func(f *Furl) {
+		f.interstitialAll = true
+
+		for _, domain := range trusted {
+			f.trustedDomains = append(f.trustedDomains, strings.ToLower(strings.Trim(domain, ".")))
+		}
+	}
+}
+
+// The InterstitialPage Option sets the function that writes the confirmation
+// page shown before leaving for the given URL, either for a link with the
+// Interstitial flag set in its Meta, or for all untrusted links when the
+// Interstitial Option is set.
+//
+// The function should write a page, with a 200 OK status, that links to the
+// URL, and should not send a Referer header to the URL.
+func InterstitialPage(page func(w http.ResponseWriter, r *http.Request, url string)) Option {
+	return func(f *Furl) {
+		f.interstitialPage = page
+	}
+}
+
+// The StickyDestinations Option sets the name of a cookie that is used to
+// remember which destination was chosen for a visitor to a link with multiple
+// destinations, so that they are sent to the same destination on each visit.
+// The cookie is set for the path of the link, and expires after the given
+// duration, or at the end of the browser session for a zero duration.
+//
+// NB: The cookie records the position of the destination in the list of
+// destinations of the link, so reordering the destinations will change which
+// destination a returning visitor is sent to.
+func StickyDestinations(cookie string, maxAge time.Duration) Option {
+	return func(f *Furl) {
+		f.stickyCookie = cookie
+		f.stickyMaxAge = maxAge
+	}
+}
+
+// The ServedBatch Option sets how many redirects to destinations are counted in
+// memory before the Served counts are written to the Store, so that each
+// redirect does not require a write. A batch size of 1 writes the count on each
+// redirect, and a batch size of 0 stops counting.
+//
+// NB: Counts that have not yet been written are lost if the FlushServed method
+// is not called before the Furl instance is discarded.
+func ServedBatch(redirects uint) Option {
+	return func(f *Furl) {
+		f.servedBatch = redirects
+	}
+}
+
+// The GeoIP Option sets the database used to find the country of the client
+// address of a request, for rules with a Country condition. See the OpenMMDB
+// function for loading a database.
+func GeoIP(db *MMDB) Option {
+	return func(f *Furl) {
+		f.geoIP = db
+	}
+}
+
+// The TrustedProxies Option sets the addresses of reverse proxies whose
+// X-Forwarded-For header is trusted to give the client address of a request,
+// such as for finding the country of the client.
+//
+// The header is read from right to left, skipping the addresses of any of the
+// trusted proxies, with the first other address being that of the client.
+//
+// NB: Without this Option, the X-Forwarded-For header is ignored, as it can be
+// set to any value by a client.
+func TrustedProxies(prefixes ...netip.Prefix) Option {
+	return func(f *Furl) {
+		f.trustedProxies = append(f.trustedProxies, prefixes...)
+	}
+}
+
 // The Index Option allows for custom error and success output.
 //
 // For a POST request with code http.StatusOK (200), the output will be the
-// generated or specified key. In all other times, the output is the error
-// string corresponding to the error code.
+// generated or specified key. For a GET request with code http.StatusOK (200),
+// the request is for a preview of a link, and the output will be the URL of the
+// link. In all other times, except as below, the output is the error string
+// corresponding to the error code.
+//
+// The interstitial page shown before following a link is not produced by the
+// Index function; see the InterstitialPage Option.
+//
+// For a GET request with code http.StatusForbidden (403), the link is not yet
+// active, and the output is the time, in RFC 3339 format, that it will become
+// active.
+//
+// For a GET request with code http.StatusUnauthorized (401), the link is
+// protected by a password, and the index should show a form that POSTs the
+// password to the path of the link. A POST request with the same code is for an
+// incorrect password, and with code http.StatusTooManyRequests (429) is for
+// too many incorrect passwords.
 //
 // NB: The index function won't be called for JSON, XML, or Text POST requests.
 func Index(index func(w http.ResponseWriter, r *http.Request, code int, output string)) Option {
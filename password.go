@@ -0,0 +1,328 @@
+package furl
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	passwordScheme     = "pbkdf2-sha256"
+	passwordIterations = 100000
+	passwordSaltLength = 16
+	passwordHashLength = 32
+	maxPasswordLength  = 1024
+
+	defaultPasswordAttempts = 5
+	defaultPasswordMaxDelay = 15 * time.Minute
+	passwordAttemptsExpiry  = 24 * time.Hour
+
+	passwordRequired  = "password required"
+	incorrectPassword = "incorrect password"
+	tooManyAttempts   = "too many attempts"
+)
+
+var passwordContentTypes = []string{"text/plain", "text/html"}
+
+// hashPassword creates a salted PBKDF2-SHA256 hash of the password, encoded as
+// the scheme, iteration count, salt, and hash, separated by $ characters.
+func hashPassword(password string) (string, error) {
+	salt := make([]byte, passwordSaltLength)
+
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("error generating salt: %w", err)
+	}
+
+	return encodePasswordHash(passwordIterations, salt, pbkdf2SHA256([]byte(password), salt, passwordIterations, passwordHashLength)), nil
+}
+
+func encodePasswordHash(iterations int, salt, hash []byte) string {
+	return passwordScheme + "$" + strconv.Itoa(iterations) + "$" + base64.RawStdEncoding.EncodeToString(salt) + "$" + base64.RawStdEncoding.EncodeToString(hash)
+}
+
+func decodePasswordHash(encoded string) (int, []byte, []byte, bool) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 4 || parts[0] != passwordScheme {
+		return 0, nil, nil, false
+	}
+
+	iterations, err := strconv.Atoi(parts[1])
+	if err != nil || iterations < 1 {
+		return 0, nil, nil, false
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return 0, nil, nil, false
+	}
+
+	hash, err := base64.RawStdEncoding.DecodeString(parts[3])
+	if err != nil || len(hash) == 0 {
+		return 0, nil, nil, false
+	}
+
+	return iterations, salt, hash, true
+}
+
+func validPasswordHash(encoded string) bool {
+	_, _, _, ok := decodePasswordHash(encoded)
+
+	return ok
+}
+
+func verifyPassword(encoded, password string) bool {
+	iterations, salt, hash, ok := decodePasswordHash(encoded)
+	if !ok {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare(hash, pbkdf2SHA256([]byte(password), salt, iterations, len(hash))) == 1
+}
+
+// pbkdf2SHA256 derives a key from the password, as per RFC 8018, using
+// HMAC-SHA256 as the pseudorandom function.
+func pbkdf2SHA256(password, salt []byte, iterations, keyLength int) []byte {
+	var (
+		prf = hmac.New(sha256.New, password)
+		key = make([]byte, 0, keyLength+sha256.Size)
+		u   = make([]byte, sha256.Size)
+		t   = make([]byte, sha256.Size)
+	)
+
+	for block := uint32(1); len(key) < keyLength; block++ {
+		prf.Reset()
+		prf.Write(salt)
+		binary.Write(prf, binary.BigEndian, block)
+
+		u = prf.Sum(u[:0])
+
+		copy(t, u)
+
+		for i := 1; i < iterations; i++ {
+			prf.Reset()
+			prf.Write(u)
+
+			u = prf.Sum(u[:0])
+
+			for j := range t {
+				t[j] ^= u[j]
+			}
+		}
+
+		key = append(key, t...)
+	}
+
+	return key[:keyLength]
+}
+
+// hidePassword removes the password hash from Meta that is to be shown to a
+// user.
+func hidePassword(meta *Meta) {
+	if meta != nil {
+		meta.Password = ""
+	}
+}
+
+// passwordClient identifies the attempts of a client at the password of a link.
+type passwordClient struct {
+	key  string
+	addr netip.Addr
+}
+
+type passwordAttempts struct {
+	failures    uint
+	until, last time.Time
+}
+
+// checkPassword verifies the password for the key, returning how long until
+// another attempt is allowed if the client of the request has tried too many
+// incorrect passwords.
+//
+// After the number of attempts set by the PasswordThrottle Option, each
+// incorrect password doubles the time until the next attempt is allowed, up to
+// the maximum delay.
+func (f *Furl) checkPassword(r *http.Request, key, encoded, password string) (time.Duration, error) {
+	client := passwordClient{key: key, addr: f.clientAddr(r)}
+
+	if wait, err := f.passwordAttempt(client); err != nil {
+		return wait, err
+	} else if !verifyPassword(encoded, password) {
+		return 0, ErrIncorrectPassword
+	}
+
+	f.passwordMu.Lock()
+	delete(f.passwordAttempts, client)
+	f.passwordMu.Unlock()
+
+	return 0, nil
+}
+
+// passwordAttempt counts an attempt by the client at the password for a link as
+// incorrect before it is verified, so that concurrent attempts are throttled as
+// if they had been made one after another. A correct password then clears the
+// count.
+//
+// The counts of clients that have not tried a password for a day, once any
+// delay has passed, are removed.
+func (f *Furl) passwordAttempt(client passwordClient) (time.Duration, error) {
+	f.passwordMu.Lock()
+	defer f.passwordMu.Unlock()
+
+	now := f.now()
+
+	if now.Sub(f.passwordSwept) > passwordAttemptsExpiry {
+		for k, a := range f.passwordAttempts {
+			if a.expired(now) {
+				delete(f.passwordAttempts, k)
+			}
+		}
+
+		f.passwordSwept = now
+	}
+
+	a, ok := f.passwordAttempts[client]
+	if !ok || a.expired(now) {
+		a = new(passwordAttempts)
+		f.passwordAttempts[client] = a
+	} else if wait := a.until.Sub(now); wait > 0 {
+		return wait, ErrTooManyAttempts
+	}
+
+	a.failures++
+	a.last = now
+
+	if a.failures >= f.passwordFree {
+		delay := f.passwordMaxDelay
+
+		if shift := a.failures - f.passwordFree; shift < 32 && time.Second<<shift < delay {
+			delay = time.Second << shift
+		}
+
+		a.until = now.Add(delay)
+	}
+
+	return 0, nil
+}
+
+func (a *passwordAttempts) expired(now time.Time) bool {
+	return now.Sub(a.last) > passwordAttemptsExpiry && !now.Before(a.until)
+}
+
+// unlocked checks that a request for a password protected link has supplied
+// the correct password, using Basic authentication, writing a response if it
+// has not.
+func (f *Furl) unlocked(w http.ResponseWriter, r *http.Request, key string) bool {
+	meta, _ := getMeta(f.store, key)
+	if meta.Password == "" {
+		return true
+	}
+
+	var (
+		wait time.Duration
+		err  = ErrPasswordRequired
+	)
+
+	if _, password, ok := r.BasicAuth(); ok {
+		if wait, err = f.checkPassword(r, key, meta.Password, password); err == nil {
+			return true
+		}
+	}
+
+	code := http.StatusUnauthorized
+
+	if errors.Is(err, ErrTooManyAttempts) {
+		code = http.StatusTooManyRequests
+
+		w.Header().Set("Retry-After", retryAfter(wait))
+	}
+
+	if f.index != nil && negotiate(r.Header.Get("Accept"), passwordContentTypes) == "text/html" {
+		f.index(w, r, code, err.Error())
+	} else {
+		w.Header().Set("WWW-Authenticate", `Basic realm="furl", charset="UTF-8"`)
+		http.Error(w, err.Error(), code)
+	}
+
+	return false
+}
+
+func retryAfter(wait time.Duration) string {
+	return strconv.FormatInt(int64((wait+time.Second-1)/time.Second), 10)
+}
+
+// unlock handles a POST request that submits the password for a protected
+// link, responding with the URL of the link when the password is correct.
+//
+// For a form submission, the response will be a redirect to the URL.
+func (f *Furl) unlock(w http.ResponseWriter, r *http.Request, contentType, key, password string) {
+	key = f.canonicalise(key)
+
+	url, ok := f.store.Get(key)
+	meta, _ := getMeta(f.store, key)
+
+	if !ok || meta.Deleted != nil {
+		f.writeResponse(w, r, http.StatusNotFound, contentType, "404 page not found")
+
+		return
+	} else if meta.Password != "" {
+		wait, err := f.checkPassword(r, key, meta.Password, password)
+		if errors.Is(err, ErrTooManyAttempts) {
+			w.Header().Set("Retry-After", retryAfter(wait))
+			f.writeResponse(w, r, http.StatusTooManyRequests, contentType, tooManyAttempts)
+
+			return
+		} else if err != nil {
+			f.writeResponse(w, r, http.StatusUnauthorized, contentType, incorrectPassword)
+
+			return
+		}
+	}
+
+	if err := activeErr(meta, f.now()); errors.Is(err, ErrNotYetActive) {
+		f.writeResponse(w, r, http.StatusForbidden, contentType, notYetActive)
+
+		return
+	} else if err != nil {
+		f.writeResponse(w, r, http.StatusGone, contentType, expired)
+
+		return
+	} else if !f.use(key) {
+		f.writeResponse(w, r, http.StatusGone, contentType, usedUp)
+
+		return
+	}
+
+	meta, _ = getMeta(f.store, key)
+
+	hidePassword(&meta)
+
+	data := newKeyURL(key, url, meta)
+
+	switch contentType {
+	case "text/json", "application/json":
+		json.NewEncoder(w).Encode(data)
+	case "text/xml", "application/xml":
+		xml.NewEncoder(w).EncodeElement(data, xmlStart)
+	default:
+		f.follow(w, r, key, url)
+	}
+}
+
+// Errors.
+var (
+	ErrPasswordRequired  = errors.New(passwordRequired)
+	ErrIncorrectPassword = errors.New(incorrectPassword)
+	ErrTooManyAttempts   = errors.New(tooManyAttempts)
+)
@@ -0,0 +1,361 @@
+package furl
+
+import (
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPBKDF2(t *testing.T) {
+	for n, test := range [...]struct {
+		Password, Salt string
+		Iterations     int
+		Key            string
+	}{
+		{ // 1
+			Password:   "password",
+			Salt:       "salt",
+			Iterations: 1,
+			Key:        "120fb6cffcf8b32c43e7225256c4f837a86548c92ccc35480805987cb70be17b",
+		},
+		{ // 2
+			Password:   "password",
+			Salt:       "salt",
+			Iterations: 4096,
+			Key:        "c5e478d59288c841aa530db6845c4c8d962893a001ce4e11a4963873aa98134a",
+		},
+		{ // 3
+			Password:   "passwordPASSWORDpassword",
+			Salt:       "saltSALTsaltSALTsaltSALTsaltSALTsalt",
+			Iterations: 4096,
+			Key:        "348c89dbcbd32b2f32d814b8116e84cf2b17347ebc1800181c4e2a1fb8dd53e1c635518c7dac47e9",
+		},
+	} {
+		key := hex.EncodeToString(pbkdf2SHA256([]byte(test.Password), []byte(test.Salt), test.Iterations, len(test.Key)/2))
+		if key != test.Key {
+			t.Errorf("test %d: expecting key %s, got %s", n+1, test.Key, key)
+		}
+	}
+}
+
+func TestPasswordHash(t *testing.T) {
+	hash, err := hashPassword("secret")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	} else if !strings.HasPrefix(hash, "pbkdf2-sha256$100000$") {
+		t.Errorf("unexpected hash format: %s", hash)
+	} else if !validPasswordHash(hash) {
+		t.Errorf("expecting hash to be valid: %s", hash)
+	} else if !verifyPassword(hash, "secret") {
+		t.Error("expecting password to verify")
+	} else if verifyPassword(hash, "Secret") {
+		t.Error("expecting incorrect password to fail")
+	} else if other, _ := hashPassword("secret"); other == hash {
+		t.Error("expecting hashes to be salted")
+	}
+	for n, hash := range [...]string{
+		"",
+		"secret",
+		"pbkdf2-sha1$1$c2FsdA$aGFzaA",
+		"pbkdf2-sha256$0$c2FsdA$aGFzaA",
+		"pbkdf2-sha256$1$!$aGFzaA",
+		"pbkdf2-sha256$1$c2FsdA$",
+	} {
+		if validPasswordHash(hash) {
+			t.Errorf("test %d: expecting hash %q to be invalid", n+1, hash)
+		}
+	}
+}
+
+func TestPassword(t *testing.T) {
+	now := testClock()
+	f := New(Clock(func() time.Time { return now }), PasswordThrottle(2, time.Minute))
+	r := httptest.NewRequest(http.MethodPost, "/AAA", strings.NewReader(`{"url":"http://www.example.com/","password":"secret"}`))
+	r.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	f.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expecting response code 200, got %d", w.Code)
+	} else if response := strings.TrimSpace(w.Body.String()); response != `{"key":"AAA","url":"http://www.example.com/","created":"2020-01-02T03:04:05Z"}` {
+		t.Errorf("unexpected response: %s", response)
+	} else if meta, _ := getMeta(f.store, "AAA"); !verifyPassword(meta.Password, "secret") {
+		t.Errorf("expecting stored password hash, got %q", meta.Password)
+	}
+	for n, test := range [...]struct {
+		Method, Path, Password, ContentType, Body string
+		Advance                                   time.Duration
+		Code                                      int
+		Response, Header, Value                   string
+	}{
+		{ // 1
+			Method: http.MethodGet,
+			Path:   "/AAA",
+			Code:   http.StatusUnauthorized,
+			Header: "WWW-Authenticate",
+			Value:  `Basic realm="furl", charset="UTF-8"`,
+		},
+		{ // 2
+			Method:   http.MethodGet,
+			Path:     "/AAA",
+			Password: "secret",
+			Code:     http.StatusFound,
+			Header:   "Location",
+			Value:    "http://www.example.com/",
+		},
+		{ // 3
+			Method:   http.MethodGet,
+			Path:     "/AAA+",
+			Password: "secret",
+			Code:     http.StatusOK,
+			Response: `{"key":"AAA","url":"http://www.example.com/","created":"2020-01-02T03:04:05Z"}`,
+		},
+		{ // 4
+			Method: http.MethodGet,
+			Path:   "/AAA+",
+			Code:   http.StatusUnauthorized,
+		},
+		{ // 5
+			Method:      http.MethodPost,
+			Path:        "/AAA",
+			ContentType: "application/json",
+			Body:        `{"password":"secret"}`,
+			Code:        http.StatusOK,
+			Response:    `{"key":"AAA","url":"http://www.example.com/","created":"2020-01-02T03:04:05Z"}`,
+		},
+		{ // 6
+			Method:      http.MethodPost,
+			Path:        "/AAA",
+			ContentType: "application/x-www-form-urlencoded",
+			Body:        "password=secret",
+			Code:        http.StatusSeeOther,
+			Header:      "Location",
+			Value:       "http://www.example.com/",
+		},
+		{ // 7
+			Method:      http.MethodPost,
+			Path:        "/AAA",
+			ContentType: "text/xml",
+			Body:        `<furl><password>wrong</password></furl>`,
+			Code:        http.StatusUnauthorized,
+			Response:    `<furl><error>incorrect password</error></furl>`,
+		},
+		{ // 8
+			Method:   http.MethodGet,
+			Path:     "/AAA",
+			Password: "wrong",
+			Code:     http.StatusUnauthorized,
+		},
+		{ // 9
+			Method:   http.MethodGet,
+			Path:     "/AAA",
+			Password: "secret",
+			Code:     http.StatusTooManyRequests,
+			Header:   "Retry-After",
+			Value:    "1",
+		},
+		{ // 10
+			Method:   http.MethodGet,
+			Path:     "/AAA",
+			Password: "wrong",
+			Advance:  time.Second,
+			Code:     http.StatusUnauthorized,
+		},
+		{ // 11
+			Method:      http.MethodPost,
+			Path:        "/AAA",
+			ContentType: "application/json",
+			Body:        `{"password":"secret"}`,
+			Code:        http.StatusTooManyRequests,
+			Header:      "Retry-After",
+			Value:       "2",
+		},
+		{ // 12
+			Method:   http.MethodGet,
+			Path:     "/AAA",
+			Password: "secret",
+			Advance:  2 * time.Second,
+			Code:     http.StatusFound,
+			Header:   "Cache-Control",
+			Value:    "no-store",
+		},
+		{ // 13
+			Method:   http.MethodGet,
+			Path:     "/AAA",
+			Password: "wrong",
+			Code:     http.StatusUnauthorized,
+		},
+		{ // 14
+			Method:      http.MethodPost,
+			Path:        "/BBB",
+			ContentType: "application/json",
+			Body:        `{"password":"secret"}`,
+			Code:        http.StatusNotFound,
+		},
+		{ // 15
+			Method:      http.MethodPost,
+			Path:        "/BBB",
+			ContentType: "application/json",
+			Body:        `{"url":"http://www.example.org/","password":"` + strings.Repeat("a", maxPasswordLength+1) + `"}`,
+			Code:        http.StatusBadRequest,
+		},
+	} {
+		now = now.Add(test.Advance)
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(test.Method, test.Path, strings.NewReader(test.Body))
+		if test.ContentType != "" {
+			r.Header.Set("Content-Type", test.ContentType)
+		}
+		if test.Password != "" {
+			r.SetBasicAuth("", test.Password)
+		}
+		f.ServeHTTP(w, r)
+		if w.Code != test.Code {
+			t.Errorf("test %d: expecting response code %d, got %d", n+1, test.Code, w.Code)
+		} else if test.Response != "" && strings.TrimSpace(w.Body.String()) != test.Response {
+			t.Errorf("test %d: expecting response %q, got %q", n+1, test.Response, strings.TrimSpace(w.Body.String()))
+		} else if value := w.Header().Get(test.Header); test.Header != "" && value != test.Value {
+			t.Errorf("test %d: expecting header %s to be %q, got %q", n+1, test.Header, test.Value, value)
+		}
+	}
+	if e := f.Resolve("AAA"); e[0].Error != passwordRequired || e[0].URL != "" {
+		t.Errorf("expecting resolve to require password, got %v", e[0])
+	}
+	var code int
+	f.index = func(w http.ResponseWriter, _ *http.Request, c int, _ string) {
+		code = c
+	}
+	r = httptest.NewRequest(http.MethodGet, "/AAA", nil)
+	r.Header.Set("Accept", "text/html,*/*;q=0.8")
+	f.ServeHTTP(httptest.NewRecorder(), r)
+	if code != http.StatusUnauthorized {
+		t.Errorf("expecting index to be called with code 401, got %d", code)
+	}
+}
+
+func TestPasswordFollow(t *testing.T) {
+	f := New()
+	for _, body := range [...]string{
+		`{"key":"AAA","url":"http://www.example.com/","password":"secret","interstitial":true}`,
+		`{"key":"BBB","url":"http://www.example.com/","password":"secret","destinations":[{"url":"http://a.example.com/"}]}`,
+		`{"key":"CCC","url":"http://www.example.com/","password":"secret","rules":[{"header":"X-Test","url":"http://b.example.com/"}]}`,
+	} {
+		r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+		f.ServeHTTP(httptest.NewRecorder(), r)
+	}
+	for n, test := range [...]struct {
+		Path, Header   string
+		Code           int
+		Location, Body string
+	}{
+		{ // 1
+			Path: "/AAA",
+			Code: http.StatusOK,
+			Body: `<a href="http://www.example.com/" rel="noreferrer">`,
+		},
+		{ // 2
+			Path:     "/BBB",
+			Code:     http.StatusSeeOther,
+			Location: "http://a.example.com/",
+		},
+		{ // 3
+			Path:     "/CCC",
+			Code:     http.StatusSeeOther,
+			Location: "http://www.example.com/",
+		},
+		{ // 4
+			Path:     "/CCC",
+			Header:   "1",
+			Code:     http.StatusSeeOther,
+			Location: "http://b.example.com/",
+		},
+	} {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, test.Path, strings.NewReader("password=secret"))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if test.Header != "" {
+			r.Header.Set("X-Test", test.Header)
+		}
+		f.ServeHTTP(w, r)
+		if w.Code != test.Code {
+			t.Errorf("test %d: expecting response code %d, got %d", n+1, test.Code, w.Code)
+		} else if location := w.Header().Get("Location"); location != test.Location {
+			t.Errorf("test %d: expecting location %q, got %q", n+1, test.Location, location)
+		} else if !strings.Contains(w.Body.String(), test.Body) {
+			t.Errorf("test %d: expecting body to contain %q, got %q", n+1, test.Body, w.Body.String())
+		}
+	}
+	f.FlushServed()
+	if meta, _ := getMeta(f.store, "BBB"); meta.Destinations[0].Served != 1 {
+		t.Errorf("expecting destination to have been served once, got %d", meta.Destinations[0].Served)
+	}
+}
+
+func TestPasswordThrottle(t *testing.T) {
+	var (
+		mu  sync.Mutex
+		now = testClock()
+	)
+	f := New(Clock(func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return now
+	}), PasswordThrottle(5, time.Minute))
+	r := httptest.NewRequest(http.MethodPost, "/AAA", strings.NewReader(`{"url":"http://www.example.com/","password":"secret"}`))
+	r.Header.Set("Content-Type", "application/json")
+	f.ServeHTTP(httptest.NewRecorder(), r)
+	var (
+		wg    sync.WaitGroup
+		codes = make(chan int, 20)
+	)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/AAA", nil)
+			r.SetBasicAuth("", "wrong")
+			f.ServeHTTP(w, r)
+			codes <- w.Code
+		}()
+	}
+	wg.Wait()
+	close(codes)
+	count := make(map[int]int)
+	for code := range codes {
+		count[code]++
+	}
+	if count[http.StatusUnauthorized] != 5 || count[http.StatusTooManyRequests] != 15 {
+		t.Errorf("expecting 5 incorrect and 15 throttled attempts, got %v", count)
+	}
+	w := httptest.NewRecorder()
+	r = httptest.NewRequest(http.MethodGet, "/AAA", nil)
+	r.RemoteAddr = "198.51.100.1:1234"
+	r.SetBasicAuth("", "wrong")
+	if f.ServeHTTP(w, r); w.Code != http.StatusUnauthorized {
+		t.Errorf("expecting attempts from another client not to be throttled, got response code %d", w.Code)
+	}
+	mu.Lock()
+	now = now.Add(passwordAttemptsExpiry + 2*time.Minute)
+	mu.Unlock()
+	f.passwordMu.Lock()
+	f.passwordAttempts[passwordClient{key: "BBB"}] = &passwordAttempts{failures: 1, last: testClock()}
+	f.passwordSwept = testClock()
+	f.passwordMu.Unlock()
+	if _, err := f.checkPassword(httptest.NewRequest(http.MethodGet, "/AAA", nil), "AAA", "", "wrong"); !errors.Is(err, ErrIncorrectPassword) {
+		t.Errorf("expecting expired attempts to be reset, got %v", err)
+	}
+	f.passwordMu.Lock()
+	defer f.passwordMu.Unlock()
+	if a, ok := f.passwordAttempts[passwordClient{key: "AAA", addr: netip.MustParseAddr("192.0.2.1")}]; !ok || a.failures != 1 {
+		t.Errorf("expecting a single failure to be counted, got %v", a)
+	} else if _, ok := f.passwordAttempts[passwordClient{key: "BBB"}]; ok {
+		t.Error("expecting expired attempts to be removed")
+	}
+}
@@ -0,0 +1,72 @@
+package furl
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"strings"
+)
+
+const previewSuffix = "+"
+
+var previewContentTypes = []string{"application/json", "text/json", "application/xml", "text/xml", "text/plain", "text/html"}
+
+// previewKey removes the preview suffix from the key, returning whether the
+// request is for a preview, either by the suffix or by a preview query param.
+func previewKey(r *http.Request, key string) (string, bool) {
+	if key, ok := trimPreview(key); ok {
+		return key, true
+	}
+
+	_, ok := r.URL.Query()["preview"]
+
+	return key, ok
+}
+
+func trimPreview(key string) (string, bool) {
+	if len(key) > len(previewSuffix) && strings.HasSuffix(key, previewSuffix) {
+		return strings.TrimSuffix(key, previewSuffix), true
+	}
+
+	return key, false
+}
+
+func (f *Furl) preview(w http.ResponseWriter, r *http.Request, key, url string) {
+	offers := previewContentTypes
+	if f.index == nil {
+		offers = offers[:len(offers)-1]
+	}
+
+	contentType := negotiate(r.Header.Get("Accept"), offers)
+	if contentType == "" {
+		http.Error(w, notAcceptable, http.StatusNotAcceptable)
+
+		return
+	} else if contentType == "text/html" {
+		f.index(w, r, http.StatusOK, url)
+
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+
+	if r.Method == http.MethodHead {
+		return
+	}
+
+	meta, _ := getMeta(f.store, key)
+
+	hidePassword(&meta)
+
+	data := newKeyURL(key, url, meta)
+
+	switch contentType {
+	case "application/json", "text/json":
+		json.NewEncoder(w).Encode(data)
+	case "application/xml", "text/xml":
+		xml.NewEncoder(w).EncodeElement(data, xmlStart)
+	default:
+		io.WriteString(w, url)
+	}
+}
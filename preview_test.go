@@ -0,0 +1,82 @@
+package furl
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestPreview(t *testing.T) {
+	f := New(Clock(testClock))
+	r := httptest.NewRequest(http.MethodPost, "/AAA", strings.NewReader(`{"url":"http://www.example.com/","title":"Example"}`))
+	r.Header.Set("Content-Type", "application/json")
+	f.ServeHTTP(httptest.NewRecorder(), r)
+	for n, test := range [...]struct {
+		Path, Accept, ContentType, Response string
+		Code                                int
+	}{
+		{ // 1
+			Path:        "/AAA+",
+			ContentType: "application/json",
+			Response:    `{"key":"AAA","url":"http://www.example.com/","title":"Example","created":"2020-01-02T03:04:05Z"}`,
+			Code:        http.StatusOK,
+		},
+		{ // 2
+			Path:        "/AAA?preview",
+			Accept:      "text/xml",
+			ContentType: "text/xml",
+			Response:    `<furl><key>AAA</key><url>http://www.example.com/</url><title>Example</title><created>2020-01-02T03:04:05Z</created></furl>`,
+			Code:        http.StatusOK,
+		},
+		{ // 3
+			Path:        "/AAA+",
+			Accept:      "text/plain",
+			ContentType: "text/plain",
+			Response:    "http://www.example.com/",
+			Code:        http.StatusOK,
+		},
+		{ // 4
+			Path:   "/AAA+",
+			Accept: "text/html",
+			Code:   http.StatusNotAcceptable,
+		},
+		{ // 5
+			Path: "/BBB+",
+			Code: http.StatusNotFound,
+		},
+		{ // 6
+			Path: "/AAA",
+			Code: http.StatusMovedPermanently,
+		},
+	} {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, test.Path, nil)
+		if test.Accept != "" {
+			r.Header.Set("Accept", test.Accept)
+		}
+		f.ServeHTTP(w, r)
+		if w.Code != test.Code {
+			t.Errorf("test %d: expecting response code %d, got %d", n+1, test.Code, w.Code)
+		} else if test.Code != http.StatusOK {
+			continue
+		} else if contentType := w.Header().Get("Content-Type"); contentType != test.ContentType {
+			t.Errorf("test %d: expecting content type %q, got %q", n+1, test.ContentType, contentType)
+		} else if response := strings.TrimSpace(w.Body.String()); response != test.Response {
+			t.Errorf("test %d: expecting response %q, got %q", n+1, test.Response, response)
+		}
+	}
+	f.index = func(w http.ResponseWriter, _ *http.Request, code int, output string) {
+		w.WriteHeader(code)
+		w.Write([]byte("<a>" + output + "</a>"))
+	}
+	w := httptest.NewRecorder()
+	r = httptest.NewRequest(http.MethodGet, "/AAA+", nil)
+	r.Header.Set("Accept", "text/html,*/*;q=0.8")
+	f.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Errorf("expecting response code 200, got %d", w.Code)
+	} else if response := w.Body.String(); response != "<a>http://www.example.com/</a>" {
+		t.Errorf("unexpected index response: %q", response)
+	}
+}
@@ -0,0 +1,125 @@
+package furl
+
+import (
+	"image/png"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const (
+	qrPNG = "png"
+	qrSVG = "svg"
+
+	defaultQRScale = 4
+	defaultQRQuiet = 4
+	maxQRSize      = 4096
+	maxQRQuiet     = 16
+
+	invalidQROptions = "invalid qr options"
+)
+
+var qrLevels = map[string]qrLevel{
+	"L": qrLow,
+	"M": qrMedium,
+	"Q": qrQuartile,
+	"H": qrHigh,
+}
+
+// qrKey removes a QR code image extension from the key, returning the image
+// format requested, either by the extension or by a qr query param.
+func qrKey(r *http.Request, key string) (string, string) {
+	for _, format := range [...]string{qrPNG, qrSVG} {
+		if ext := "." + format; len(key) > len(ext) && strings.HasSuffix(key, ext) {
+			return strings.TrimSuffix(key, ext), format
+		}
+	}
+
+	if q, ok := r.URL.Query()["qr"]; !ok {
+		return key, ""
+	} else if len(q) > 0 && q[0] == qrSVG {
+		return key, qrSVG
+	}
+
+	return key, qrPNG
+}
+
+func (f *Furl) qr(w http.ResponseWriter, r *http.Request, key, format string) {
+	var (
+		query      = r.URL.Query()
+		level      = qrMedium
+		quiet      = defaultQRQuiet
+		size       int
+		ok         = true
+		err        error
+		levelParam = strings.ToUpper(query.Get("ecc"))
+	)
+
+	if levelParam != "" {
+		level, ok = qrLevels[levelParam]
+	}
+
+	if q := query.Get("quiet"); ok && q != "" {
+		quiet, err = strconv.Atoi(q)
+		ok = err == nil && quiet >= 0 && quiet <= maxQRQuiet
+	}
+
+	if s := query.Get("size"); ok && s != "" {
+		size, err = strconv.Atoi(s)
+		ok = err == nil && size > 0 && size <= maxQRSize
+	}
+
+	if !ok {
+		http.Error(w, invalidQROptions, http.StatusBadRequest)
+
+		return
+	}
+
+	q, err := encodeQR([]byte(f.shortURL(r, key)), level)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+
+		return
+	}
+
+	scale := defaultQRScale
+	if size > 0 {
+		if scale = size / (q.size + quiet*2); scale < 1 {
+			scale = 1
+		}
+	}
+
+	if format == qrSVG {
+		w.Header().Set("Content-Type", "image/svg+xml")
+	} else {
+		w.Header().Set("Content-Type", "image/png")
+	}
+
+	if r.Method == http.MethodHead {
+		return
+	} else if format == qrSVG {
+		q.svg(w, scale, quiet)
+	} else {
+		png.Encode(w, q.image(scale, quiet))
+	}
+}
+
+// shortURL returns the short URL for a key, using the first base URL set with
+// the BaseURL Option, or else the host and path of the request.
+func (f *Furl) shortURL(r *http.Request, key string) string {
+	for _, base := range f.bases {
+		if base.tenant == nil && base.url != "" {
+			return base.url + url.PathEscape(key)
+		}
+	}
+
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+
+	dir, _ := pathKey(r.URL.EscapedPath())
+
+	return scheme + "://" + r.Host + strings.TrimSuffix(dir, "/") + "/" + url.PathEscape(key)
+}
@@ -0,0 +1,148 @@
+package furl
+
+import (
+	"bytes"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestQR(t *testing.T) {
+	f := New()
+	post(f, "AAA", "http://www.example.com/")
+	g := New(BaseURL("https://s.example.com/go"), SetStore(f.store))
+	for n, test := range [...]struct {
+		Furl                      *Furl
+		Method, Path, ContentType string
+		Data                      string
+		Level                     qrLevel
+		Scale, Quiet              int
+		Code                      int
+	}{
+		{ // 1
+			Furl:        f,
+			Method:      http.MethodGet,
+			Path:        "/AAA.png",
+			ContentType: "image/png",
+			Data:        "http://example.com/AAA",
+			Level:       qrMedium,
+			Scale:       4,
+			Quiet:       4,
+			Code:        http.StatusOK,
+		},
+		{ // 2
+			Furl:        f,
+			Method:      http.MethodGet,
+			Path:        "/AAA?qr&ecc=h&quiet=2&size=100",
+			ContentType: "image/png",
+			Data:        "http://example.com/AAA",
+			Level:       qrHigh,
+			Scale:       3,
+			Quiet:       2,
+			Code:        http.StatusOK,
+		},
+		{ // 3
+			Furl:        g,
+			Method:      http.MethodGet,
+			Path:        "/AAA.svg?ecc=L",
+			ContentType: "image/svg+xml",
+			Data:        "https://s.example.com/go/AAA",
+			Level:       qrLow,
+			Scale:       4,
+			Quiet:       4,
+			Code:        http.StatusOK,
+		},
+		{ // 4
+			Furl:        f,
+			Method:      http.MethodGet,
+			Path:        "/AAA?qr=svg&size=10&quiet=0",
+			ContentType: "image/svg+xml",
+			Data:        "http://example.com/AAA",
+			Level:       qrMedium,
+			Scale:       1,
+			Quiet:       0,
+			Code:        http.StatusOK,
+		},
+		{ // 5
+			Furl:        f,
+			Method:      http.MethodHead,
+			Path:        "/AAA.png",
+			ContentType: "image/png",
+			Code:        http.StatusOK,
+		},
+		{ // 6
+			Furl:   f,
+			Method: http.MethodGet,
+			Path:   "/AAA.png?ecc=X",
+			Code:   http.StatusBadRequest,
+		},
+		{ // 7
+			Furl:   f,
+			Method: http.MethodGet,
+			Path:   "/AAA.png?quiet=17",
+			Code:   http.StatusBadRequest,
+		},
+		{ // 8
+			Furl:   f,
+			Method: http.MethodGet,
+			Path:   "/AAA.png?size=0",
+			Code:   http.StatusBadRequest,
+		},
+		{ // 9
+			Furl:   f,
+			Method: http.MethodGet,
+			Path:   "/BBB.png",
+			Code:   http.StatusNotFound,
+		},
+		{ // 10
+			Furl:   f,
+			Method: http.MethodGet,
+			Path:   "/.png",
+			Code:   http.StatusNotFound,
+		},
+	} {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(test.Method, "http://example.com"+test.Path, nil)
+		test.Furl.ServeHTTP(w, r)
+		if w.Code != test.Code {
+			t.Errorf("test %d: expecting response code %d, got %d", n+1, test.Code, w.Code)
+		} else if test.Code != http.StatusOK {
+			continue
+		} else if contentType := w.Header().Get("Content-Type"); contentType != test.ContentType {
+			t.Errorf("test %d: expecting content type %q, got %q", n+1, test.ContentType, contentType)
+		} else if test.Method == http.MethodHead {
+			continue
+		}
+		q, _ := encodeQR([]byte(test.Data), test.Level)
+		var expected bytes.Buffer
+		if test.ContentType == "image/png" {
+			png.Encode(&expected, q.image(test.Scale, test.Quiet))
+		} else {
+			q.svg(&expected, test.Scale, test.Quiet)
+		}
+		if !bytes.Equal(w.Body.Bytes(), expected.Bytes()) {
+			t.Errorf("test %d: response does not match QR code for %q", n+1, test.Data)
+		}
+	}
+}
+
+func TestQRKey(t *testing.T) {
+	for n, test := range [...]struct {
+		Path, Key, Format string
+	}{
+		{"/AAA", "AAA", ""},
+		{"/AAA.png", "AAA", qrPNG},
+		{"/AAA.svg", "AAA", qrSVG},
+		{"/AAA.jpg", "AAA.jpg", ""},
+		{"/AAA?qr", "AAA", qrPNG},
+		{"/AAA?qr=svg", "AAA", qrSVG},
+		{"/.svg", ".svg", ""},
+	} {
+		r := httptest.NewRequest(http.MethodGet, test.Path, nil)
+		if key, format := qrKey(r, strings.TrimPrefix(r.URL.Path, "/")); key != test.Key || format != test.Format {
+			t.Errorf("test %d: expecting key %q and format %q, got %q and %q", n+1, test.Key, test.Format, key, format)
+		}
+	}
+}
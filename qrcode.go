@@ -0,0 +1,617 @@
+package furl
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+)
+
+// qrLevel is the error correction level of a QR code, which determines how much
+// of the code can be damaged, or obscured, while remaining readable.
+type qrLevel uint8
+
+const (
+	qrLow      qrLevel = iota // ~7% recoverable
+	qrMedium                  // ~15% recoverable
+	qrQuartile                // ~25% recoverable
+	qrHigh                    // ~30% recoverable
+)
+
+const (
+	qrMinVersion = 1
+	qrMaxVersion = 40
+	qrByteMode   = 0x4
+)
+
+var (
+	// The format bits for each qrLevel, which are not in level order.
+	qrFormatLevel = [...]uint{1, 0, 3, 2}
+
+	qrECCodewordsPerBlock = [...][qrMaxVersion + 1]int{
+		{0, 7, 10, 15, 20, 26, 18, 20, 24, 30, 18, 20, 24, 26, 30, 22, 24, 28, 30, 28, 28, 28, 28, 30, 30, 26, 28, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+		{0, 10, 16, 26, 18, 24, 16, 18, 22, 22, 26, 30, 22, 22, 24, 24, 28, 28, 26, 26, 26, 26, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28},
+		{0, 13, 22, 18, 26, 18, 24, 18, 22, 20, 24, 28, 26, 24, 20, 30, 24, 28, 28, 26, 30, 28, 30, 30, 30, 30, 28, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+		{0, 17, 28, 22, 16, 22, 28, 26, 26, 24, 28, 24, 28, 22, 24, 24, 30, 28, 28, 26, 28, 30, 24, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+	}
+	qrECBlocks = [...][qrMaxVersion + 1]int{
+		{0, 1, 1, 1, 1, 1, 2, 2, 2, 2, 4, 4, 4, 4, 4, 6, 6, 6, 6, 7, 8, 8, 9, 9, 10, 12, 12, 12, 13, 14, 15, 16, 17, 18, 19, 19, 20, 21, 22, 24, 25},
+		{0, 1, 1, 1, 2, 2, 4, 4, 4, 5, 5, 5, 8, 9, 9, 10, 10, 11, 13, 14, 16, 17, 17, 18, 20, 21, 23, 25, 26, 28, 29, 31, 33, 35, 37, 38, 40, 43, 45, 47, 49},
+		{0, 1, 1, 2, 2, 4, 4, 6, 6, 8, 8, 8, 10, 12, 16, 12, 17, 16, 18, 21, 20, 23, 23, 25, 27, 29, 34, 34, 35, 38, 40, 43, 45, 48, 51, 53, 56, 59, 62, 65, 68},
+		{0, 1, 1, 2, 4, 4, 4, 5, 6, 8, 8, 11, 11, 16, 16, 18, 16, 19, 21, 25, 25, 25, 34, 30, 32, 35, 37, 40, 42, 45, 48, 51, 54, 57, 60, 63, 66, 70, 74, 77, 81},
+	}
+
+	qrPalette = color.Palette{color.Gray{Y: 0xff}, color.Gray{Y: 0}}
+)
+
+// qrCode is a QR code symbol, as specified by ISO/IEC 18004, encoding its data
+// in byte mode.
+type qrCode struct {
+	version, size int
+	level         qrLevel
+	modules       []bool
+	function      []bool
+}
+
+// encodeQR creates the smallest QR code that can hold the data at the given
+// error correction level.
+func encodeQR(data []byte, level qrLevel) (*qrCode, error) {
+	version := qrMinVersion
+
+	for ; ; version++ {
+		if version > qrMaxVersion {
+			return nil, ErrQRTooLong
+		} else if 4+qrCountBits(version)+len(data)*8 <= qrDataCodewords(version, level)*8 {
+			break
+		}
+	}
+
+	size := version*4 + 17
+	q := &qrCode{
+		version:  version,
+		size:     size,
+		level:    level,
+		modules:  make([]bool, size*size),
+		function: make([]bool, size*size),
+	}
+
+	q.drawFunctionPatterns()
+	q.drawCodewords(q.addErrorCorrection(q.dataCodewords(data)))
+	q.applyBestMask()
+
+	return q, nil
+}
+
+func qrCountBits(version int) int {
+	if version < 10 {
+		return 8
+	}
+
+	return 16
+}
+
+// qrRawModules returns the number of modules available for data and error
+// correction codewords, after the function patterns have been placed.
+func qrRawModules(version int) int {
+	n := (16*version+128)*version + 64
+
+	if version >= 2 {
+		align := version/7 + 2
+		n -= (25*align-10)*align - 55
+
+		if version >= 7 {
+			n -= 36
+		}
+	}
+
+	return n
+}
+
+func qrDataCodewords(version int, level qrLevel) int {
+	return qrRawModules(version)/8 - qrECCodewordsPerBlock[level][version]*qrECBlocks[level][version]
+}
+
+// dataCodewords builds the data segment, with its terminator and padding.
+func (q *qrCode) dataCodewords(data []byte) []byte {
+	var (
+		capacity = qrDataCodewords(q.version, q.level)
+		b        qrBits
+	)
+
+	b.append(qrByteMode, 4)
+	b.append(uint(len(data)), qrCountBits(q.version))
+
+	for _, c := range data {
+		b.append(uint(c), 8)
+	}
+
+	for n := 0; n < 4 && b.length < capacity*8; n++ {
+		b.append(0, 1)
+	}
+
+	if r := b.length % 8; r != 0 {
+		b.append(0, 8-r)
+	}
+
+	for pad := byte(0xec); len(b.data) < capacity; pad ^= 0xec ^ 0x11 {
+		b.data = append(b.data, pad)
+	}
+
+	return b.data
+}
+
+type qrBits struct {
+	data   []byte
+	length int
+}
+
+func (b *qrBits) append(value uint, bits int) {
+	for i := bits - 1; i >= 0; i-- {
+		if b.length%8 == 0 {
+			b.data = append(b.data, 0)
+		}
+
+		b.data[len(b.data)-1] |= byte((value>>i)&1) << (7 - b.length%8)
+		b.length++
+	}
+}
+
+// addErrorCorrection splits the data into blocks, calculates the Reed-Solomon
+// codewords for each block, and interleaves the result.
+func (q *qrCode) addErrorCorrection(data []byte) []byte {
+	var (
+		numBlocks = qrECBlocks[q.level][q.version]
+		ecLen     = qrECCodewordsPerBlock[q.level][q.version]
+		raw       = qrRawModules(q.version) / 8
+		numShort  = numBlocks - raw%numBlocks
+		shortLen  = raw/numBlocks - ecLen
+		divisor   = rsDivisor(ecLen)
+		blocks    = make([][]byte, numBlocks)
+		ecBlocks  = make([][]byte, numBlocks)
+		codewords = make([]byte, 0, raw)
+		start     int
+	)
+
+	for n := range blocks {
+		length := shortLen
+
+		if n >= numShort {
+			length++
+		}
+
+		blocks[n] = data[start : start+length]
+		ecBlocks[n] = rsRemainder(blocks[n], divisor)
+		start += length
+	}
+
+	for i := 0; i <= shortLen; i++ {
+		for _, block := range blocks {
+			if i < len(block) {
+				codewords = append(codewords, block[i])
+			}
+		}
+	}
+
+	for i := 0; i < ecLen; i++ {
+		for _, block := range ecBlocks {
+			codewords = append(codewords, block[i])
+		}
+	}
+
+	return codewords
+}
+
+// rsDivisor returns the coefficients, highest power first and excluding the
+// leading term, of the Reed-Solomon generator polynomial of the given degree.
+func rsDivisor(degree int) []byte {
+	divisor := make([]byte, degree)
+	divisor[degree-1] = 1
+	root := byte(1)
+
+	for i := 0; i < degree; i++ {
+		for j := range divisor {
+			divisor[j] = gfMultiply(divisor[j], root)
+
+			if j+1 < degree {
+				divisor[j] ^= divisor[j+1]
+			}
+		}
+
+		root = gfMultiply(root, 2)
+	}
+
+	return divisor
+}
+
+func rsRemainder(data, divisor []byte) []byte {
+	remainder := make([]byte, len(divisor))
+
+	for _, b := range data {
+		factor := b ^ remainder[0]
+
+		copy(remainder, remainder[1:])
+		remainder[len(remainder)-1] = 0
+
+		for i, c := range divisor {
+			remainder[i] ^= gfMultiply(c, factor)
+		}
+	}
+
+	return remainder
+}
+
+// gfMultiply multiplies two elements of GF(2⁸), modulo the polynomial
+// x⁸ + x⁴ + x³ + x² + 1.
+func gfMultiply(x, y byte) byte {
+	var z uint
+
+	for i := 7; i >= 0; i-- {
+		z = (z << 1) ^ ((z >> 7) * 0x11d)
+		z ^= uint((y>>i)&1) * uint(x)
+	}
+
+	return byte(z)
+}
+
+func (q *qrCode) get(x, y int) bool {
+	return q.modules[y*q.size+x]
+}
+
+func (q *qrCode) set(x, y int, dark bool) {
+	q.modules[y*q.size+x] = dark
+	q.function[y*q.size+x] = true
+}
+
+func (q *qrCode) drawFunctionPatterns() {
+	for i := 0; i < q.size; i++ {
+		q.set(6, i, i%2 == 0)
+		q.set(i, 6, i%2 == 0)
+	}
+
+	q.drawFinder(3, 3)
+	q.drawFinder(q.size-4, 3)
+	q.drawFinder(3, q.size-4)
+
+	align := q.alignmentPositions()
+	last := len(align) - 1
+
+	for i, x := range align {
+		for j, y := range align {
+			if i == 0 && j == 0 || i == 0 && j == last || i == last && j == 0 {
+				continue
+			}
+
+			for dy := -2; dy <= 2; dy++ {
+				for dx := -2; dx <= 2; dx++ {
+					q.set(x+dx, y+dy, qrDistance(dx, dy) != 1)
+				}
+			}
+		}
+	}
+
+	q.drawFormat(0)
+	q.drawVersion()
+}
+
+func (q *qrCode) drawFinder(x, y int) {
+	for dy := -4; dy <= 4; dy++ {
+		for dx := -4; dx <= 4; dx++ {
+			if xx, yy := x+dx, y+dy; xx >= 0 && xx < q.size && yy >= 0 && yy < q.size {
+				dist := qrDistance(dx, dy)
+
+				q.set(xx, yy, dist != 2 && dist != 4)
+			}
+		}
+	}
+}
+
+func (q *qrCode) alignmentPositions() []int {
+	if q.version == 1 {
+		return nil
+	}
+
+	var (
+		num       = q.version/7 + 2
+		step      = (q.version*8 + num*3 + 5) / (num*4 - 4) * 2
+		positions = make([]int, num)
+	)
+
+	for i, pos := num-1, q.size-7; i > 0; i, pos = i-1, pos-step {
+		positions[i] = pos
+	}
+
+	positions[0] = 6
+
+	return positions
+}
+
+// drawFormat draws both copies of the format information, which holds the
+// error correction level and the mask, protected by a BCH code.
+func (q *qrCode) drawFormat(mask int) {
+	data := qrFormatLevel[q.level]<<3 | uint(mask)
+	rem := data
+
+	for i := 0; i < 10; i++ {
+		rem = (rem << 1) ^ ((rem >> 9) * 0x537)
+	}
+
+	bits := (data<<10 | rem) ^ 0x5412
+
+	for i := 0; i <= 5; i++ {
+		q.set(8, i, bit(bits, i))
+	}
+
+	q.set(8, 7, bit(bits, 6))
+	q.set(8, 8, bit(bits, 7))
+	q.set(7, 8, bit(bits, 8))
+
+	for i := 9; i < 15; i++ {
+		q.set(14-i, 8, bit(bits, i))
+	}
+
+	for i := 0; i < 8; i++ {
+		q.set(q.size-1-i, 8, bit(bits, i))
+	}
+
+	for i := 8; i < 15; i++ {
+		q.set(8, q.size-15+i, bit(bits, i))
+	}
+
+	q.set(8, q.size-8, true)
+}
+
+// drawVersion draws both copies of the version information, which is only
+// present in versions 7 and above.
+func (q *qrCode) drawVersion() {
+	if q.version < 7 {
+		return
+	}
+
+	rem := uint(q.version)
+
+	for i := 0; i < 12; i++ {
+		rem = (rem << 1) ^ ((rem >> 11) * 0x1f25)
+	}
+
+	bits := uint(q.version)<<12 | rem
+
+	for i := 0; i < 18; i++ {
+		a, b := q.size-11+i%3, i/3
+
+		q.set(a, b, bit(bits, i))
+		q.set(b, a, bit(bits, i))
+	}
+}
+
+// drawCodewords places the codewords in the zigzag pattern, in pairs of
+// columns from the right, skipping the function patterns.
+func (q *qrCode) drawCodewords(codewords []byte) {
+	var i int
+
+	for right := q.size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+
+		upward := (right+1)&2 == 0
+
+		for vert := 0; vert < q.size; vert++ {
+			y := vert
+
+			if upward {
+				y = q.size - 1 - vert
+			}
+
+			for j := 0; j < 2; j++ {
+				x := right - j
+
+				if !q.function[y*q.size+x] && i < len(codewords)*8 {
+					q.modules[y*q.size+x] = bit(uint(codewords[i>>3]), 7-i&7)
+					i++
+				}
+			}
+		}
+	}
+}
+
+func qrMask(mask, x, y int) bool {
+	switch mask {
+	case 0:
+		return (x+y)%2 == 0
+	case 1:
+		return y%2 == 0
+	case 2:
+		return x%3 == 0
+	case 3:
+		return (x+y)%3 == 0
+	case 4:
+		return (x/3+y/2)%2 == 0
+	case 5:
+		return x*y%2+x*y%3 == 0
+	case 6:
+		return (x*y%2+x*y%3)%2 == 0
+	default:
+		return ((x+y)%2+x*y%3)%2 == 0
+	}
+}
+
+func (q *qrCode) applyMask(mask int) {
+	for y := 0; y < q.size; y++ {
+		for x := 0; x < q.size; x++ {
+			if !q.function[y*q.size+x] && qrMask(mask, x, y) {
+				q.modules[y*q.size+x] = !q.modules[y*q.size+x]
+			}
+		}
+	}
+}
+
+// applyBestMask tries each of the eight masks, keeping the one that produces
+// the fewest features that make a code hard to read.
+func (q *qrCode) applyBestMask() {
+	best, bestPenalty := 0, -1
+
+	for mask := 0; mask < 8; mask++ {
+		q.applyMask(mask)
+		q.drawFormat(mask)
+
+		if p := q.penalty(); bestPenalty < 0 || p < bestPenalty {
+			best, bestPenalty = mask, p
+		}
+
+		q.applyMask(mask)
+	}
+
+	q.applyMask(best)
+	q.drawFormat(best)
+}
+
+var (
+	qrFinderLike    = [...]bool{true, false, true, true, true, false, true, false, false, false, false}
+	qrFinderLikeRev = [...]bool{false, false, false, false, true, false, true, true, true, false, true}
+)
+
+func (q *qrCode) penalty() int {
+	var penalty, dark int
+
+	for i := 0; i < q.size; i++ {
+		penalty += q.linePenalty(func(j int) bool { return q.get(j, i) })
+		penalty += q.linePenalty(func(j int) bool { return q.get(i, j) })
+	}
+
+	for y := 0; y < q.size; y++ {
+		for x := 0; x < q.size; x++ {
+			c := q.get(x, y)
+
+			if c {
+				dark++
+			}
+
+			if x+1 < q.size && y+1 < q.size && c == q.get(x+1, y) && c == q.get(x, y+1) && c == q.get(x+1, y+1) {
+				penalty += 3
+			}
+		}
+	}
+
+	total := q.size * q.size
+
+	return penalty + ((abs(dark*20-total*10)+total-1)/total-1)*10
+}
+
+// linePenalty scores a row or column for runs of five or more modules of the
+// same colour, and for patterns that look like a finder.
+func (q *qrCode) linePenalty(get func(int) bool) int {
+	var penalty, run int
+
+	for j := 0; j < q.size; j++ {
+		if j > 0 && get(j) == get(j-1) {
+			run++
+		} else {
+			run = 1
+		}
+
+		if run == 5 {
+			penalty += 3
+		} else if run > 5 {
+			penalty++
+		}
+	}
+
+	for j := 0; j+len(qrFinderLike) <= q.size; j++ {
+		like, likeRev := true, true
+
+		for k := range qrFinderLike {
+			c := get(j + k)
+			like = like && c == qrFinderLike[k]
+			likeRev = likeRev && c == qrFinderLikeRev[k]
+		}
+
+		if like || likeRev {
+			penalty += 40
+		}
+	}
+
+	return penalty
+}
+
+// image returns the QR code as an image, with each module scale pixels wide,
+// surrounded by a light border, the quiet zone, quiet modules wide.
+func (q *qrCode) image(scale, quiet int) image.Image {
+	size := (q.size + quiet*2) * scale
+	img := image.NewPaletted(image.Rect(0, 0, size, size), qrPalette)
+
+	for y := 0; y < q.size; y++ {
+		for x := 0; x < q.size; x++ {
+			if !q.get(x, y) {
+				continue
+			}
+
+			for py := (y + quiet) * scale; py < (y+quiet+1)*scale; py++ {
+				start := img.PixOffset((x+quiet)*scale, py)
+
+				for px := start; px < start+scale; px++ {
+					img.Pix[px] = 1
+				}
+			}
+		}
+	}
+
+	return img
+}
+
+// svg writes the QR code as an SVG image, with each module scale pixels wide,
+// surrounded by a light border, the quiet zone, quiet modules wide.
+func (q *qrCode) svg(w io.Writer, scale, quiet int) error {
+	size := q.size + quiet*2
+
+	if _, err := fmt.Fprintf(w, "<svg xmlns=\"http://www.w3.org/2000/svg\" width=\"%[1]d\" height=\"%[1]d\" viewBox=\"0 0 %[2]d %[2]d\" shape-rendering=\"crispEdges\"><rect width=\"%[2]d\" height=\"%[2]d\" fill=\"#fff\"/><path fill=\"#000\" d=\"", size*scale, size); err != nil {
+		return err
+	}
+
+	for y := 0; y < q.size; y++ {
+		for x := 0; x < q.size; x++ {
+			if !q.get(x, y) {
+				continue
+			}
+
+			start := x
+
+			for x+1 < q.size && q.get(x+1, y) {
+				x++
+			}
+
+			if _, err := fmt.Fprintf(w, "M%d,%dh%dv1h-%dz", start+quiet, y+quiet, x-start+1, x-start+1); err != nil {
+				return err
+			}
+		}
+	}
+
+	_, err := io.WriteString(w, "\"/></svg>")
+
+	return err
+}
+
+func bit(x uint, i int) bool {
+	return (x>>i)&1 != 0
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+
+	return x
+}
+
+// qrDistance returns the distance of a module from the centre of a finder or
+// alignment pattern, which determines the ring that it is part of.
+func qrDistance(dx, dy int) int {
+	if dx, dy = abs(dx), abs(dy); dx > dy {
+		return dx
+	}
+
+	return dy
+}
+
+// Errors.
+var ErrQRTooLong = errors.New("data too long for qr code")
@@ -0,0 +1,258 @@
+package furl
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"strings"
+	"testing"
+)
+
+// readQR decodes a qrCode, returning its level, mask, and byte mode data after
+// checking the error correction codewords.
+func readQR(t *testing.T, q *qrCode) (qrLevel, int, []byte) {
+	t.Helper()
+
+	var format uint
+
+	for i := 0; i <= 5; i++ {
+		if q.get(8, i) {
+			format |= 1 << i
+		}
+	}
+
+	for i, p := range [...][2]int{{8, 7}, {8, 8}, {7, 8}} {
+		if q.get(p[0], p[1]) {
+			format |= 1 << (6 + i)
+		}
+	}
+
+	for i := 9; i < 15; i++ {
+		if q.get(14-i, 8) {
+			format |= 1 << i
+		}
+	}
+
+	format ^= 0x5412
+
+	var second uint
+
+	for i := 0; i < 8; i++ {
+		if q.get(q.size-1-i, 8) {
+			second |= 1 << i
+		}
+	}
+
+	for i := 8; i < 15; i++ {
+		if q.get(8, q.size-15+i) {
+			second |= 1 << i
+		}
+	}
+
+	if second^0x5412 != format {
+		t.Fatalf("format copies differ: %015b != %015b", format, second^0x5412)
+	}
+
+	var level qrLevel
+
+	for l, f := range qrFormatLevel {
+		if f == format>>13 {
+			level = qrLevel(l)
+		}
+	}
+
+	mask := int(format>>10) & 7
+
+	var (
+		raw = make([]byte, qrRawModules(q.version)/8)
+		i   int
+	)
+
+	for right := q.size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+
+		for vert := 0; vert < q.size; vert++ {
+			y := vert
+
+			if (right+1)&2 == 0 {
+				y = q.size - 1 - vert
+			}
+
+			for x := right; x > right-2; x-- {
+				if q.function[y*q.size+x] || i >= len(raw)*8 {
+					continue
+				}
+
+				if q.get(x, y) != qrMask(mask, x, y) {
+					raw[i>>3] |= 1 << (7 - i&7)
+				}
+
+				i++
+			}
+		}
+	}
+
+	var (
+		numBlocks = qrECBlocks[level][q.version]
+		ecLen     = qrECCodewordsPerBlock[level][q.version]
+		numShort  = numBlocks - len(raw)%numBlocks
+		shortLen  = len(raw)/numBlocks - ecLen
+		blocks    = make([][]byte, numBlocks)
+		pos       int
+	)
+
+	for n := 0; n <= shortLen; n++ {
+		for b := range blocks {
+			if n < shortLen || b >= numShort {
+				blocks[b] = append(blocks[b], raw[pos])
+				pos++
+			}
+		}
+	}
+
+	for n := 0; n < ecLen; n++ {
+		for b := range blocks {
+			blocks[b] = append(blocks[b], raw[pos])
+			pos++
+		}
+	}
+
+	var data []byte
+
+	for b, block := range blocks {
+		for n, root := 0, byte(1); n < ecLen; n, root = n+1, gfMultiply(root, 2) {
+			var syndrome byte
+
+			for _, c := range block {
+				syndrome = gfMultiply(syndrome, root) ^ c
+			}
+
+			if syndrome != 0 {
+				t.Fatalf("block %d: non-zero syndrome %d", b, n)
+			}
+		}
+
+		data = append(data, block[:len(block)-ecLen]...)
+	}
+
+	if data[0]>>4 != qrByteMode {
+		t.Fatalf("expecting byte mode, got %d", data[0]>>4)
+	}
+
+	var (
+		count  = qrCountBits(q.version)
+		length int
+	)
+
+	for n := 0; n < count/8+1; n++ {
+		length = length<<8 | int(data[n])
+	}
+
+	length = length >> 4 & (1<<count - 1)
+
+	out := make([]byte, length)
+
+	for n := range out {
+		out[n] = data[n+count/8]<<4 | data[n+count/8+1]>>4
+	}
+
+	return level, mask, out
+}
+
+func TestQRCode(t *testing.T) {
+	for n, test := range [...]struct {
+		Data    string
+		Level   qrLevel
+		Version int
+	}{
+		{ // 1
+			Data:    "http://a.b/c",
+			Level:   qrLow,
+			Version: 1,
+		},
+		{ // 2
+			Data:    "https://www.example.com/AAAAAAAA",
+			Level:   qrMedium,
+			Version: 3,
+		},
+		{ // 3
+			Data:    "https://www.example.com/" + strings.Repeat("A", 100),
+			Level:   qrQuartile,
+			Version: 9,
+		},
+		{ // 4
+			Data:    "https://www.example.com/" + strings.Repeat("B", 300),
+			Level:   qrHigh,
+			Version: 19,
+		},
+		{ // 5
+			Data:    strings.Repeat("C", 2953),
+			Level:   qrLow,
+			Version: 40,
+		},
+	} {
+		q, err := encodeQR([]byte(test.Data), test.Level)
+		if err != nil {
+			t.Errorf("test %d: unexpected error: %s", n+1, err)
+
+			continue
+		} else if q.version != test.Version {
+			t.Errorf("test %d: expecting version %d, got %d", n+1, test.Version, q.version)
+		} else if q.size != test.Version*4+17 {
+			t.Errorf("test %d: expecting size %d, got %d", n+1, test.Version*4+17, q.size)
+		}
+
+		for _, p := range [...][2]int{{0, 0}, {q.size - 7, 0}, {0, q.size - 7}} {
+			for d := 0; d < 7; d++ {
+				if !q.get(p[0]+d, p[1]) || !q.get(p[0], p[1]+d) || !q.get(p[0]+6, p[1]+d) || !q.get(p[0]+d, p[1]+6) {
+					t.Errorf("test %d: finder pattern at %v has a light outer module", n+1, p)
+				}
+			}
+		}
+
+		level, _, data := readQR(t, q)
+		if level != test.Level {
+			t.Errorf("test %d: expecting level %d, got %d", n+1, test.Level, level)
+		} else if string(data) != test.Data {
+			t.Errorf("test %d: expecting data %q, got %q", n+1, test.Data, data)
+		}
+	}
+
+	if _, err := encodeQR(make([]byte, 2954), qrLow); !errors.Is(err, ErrQRTooLong) {
+		t.Errorf("expecting error ErrQRTooLong, got %v", err)
+	}
+}
+
+func TestQRCodeOutput(t *testing.T) {
+	q, _ := encodeQR([]byte("http://a.b/c"), qrLow)
+	img := q.image(2, 4)
+	if b := img.Bounds(); b != image.Rect(0, 0, 58, 58) {
+		t.Errorf("expecting image bounds of 58x58, got %v", b)
+	}
+	for _, p := range [...]struct {
+		X, Y int
+		Y8   uint8
+	}{
+		{0, 0, 0xff},
+		{7, 7, 0xff},
+		{8, 8, 0},
+		{9, 9, 0},
+		{10, 10, 0xff},
+	} {
+		if r, _, _, _ := img.At(p.X, p.Y).RGBA(); uint8(r>>8) != p.Y8 {
+			t.Errorf("expecting pixel (%d, %d) to be %d, got %d", p.X, p.Y, p.Y8, r>>8)
+		}
+	}
+	var buf bytes.Buffer
+	if err := q.svg(&buf, 2, 4); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	svg := buf.String()
+	if !strings.HasPrefix(svg, `<svg xmlns="http://www.w3.org/2000/svg" width="58" height="58" viewBox="0 0 29 29" shape-rendering="crispEdges"><rect width="29" height="29" fill="#fff"/><path fill="#000" d="M4,4h7v1h-7z`) {
+		t.Errorf("unexpected svg start: %s", svg[:200])
+	} else if !strings.HasSuffix(svg, `"/></svg>`) {
+		t.Errorf("unexpected svg end: %s", svg[len(svg)-20:])
+	}
+}
@@ -0,0 +1,456 @@
+package furl
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultRedisTimeout = 5 * time.Second
+	maxIdleRedisConns   = 16
+	redisScanCount      = "100"
+)
+
+// The RedisStore type is an implementation of the Store interface that stores
+// keys and URLs in a Redis server, communicating using the RESP protocol.
+//
+// The RedisStore implements the KeyTxStore and Ranger interfaces, and its Tx
+// implements the CreateTx interface, using SET with the NX option to create
+// keys atomically, allowing multiple Furl instances to share a Redis server.
+//
+// NB: The RedisStore does not implement the MetaStore interface, and so does
+// not store link metadata.
+type RedisStore struct {
+	addr, prefix     string
+	password         string
+	db               int
+	ttl, timeout     time.Duration
+	errorHandler     func(error)
+	dial             func(network, addr string) (net.Conn, error)
+	mu               sync.Mutex
+	idle             []*redisConn
+	scanMatchPattern string
+}
+
+// The RedisOption type is used to specify optional params to the
+// NewRedisStore function call.
+type RedisOption func(*RedisStore)
+
+// The RedisPrefix RedisOption sets a prefix that is added to each key stored
+// in Redis, allowing the Redis server to be shared with other data.
+func RedisPrefix(prefix string) RedisOption {
+	return func(r *RedisStore) {
+		r.prefix = prefix
+	}
+}
+
+// The RedisTTL RedisOption sets a time-to-live on each key stored in Redis,
+// after which the link will expire and be removed by the Redis server.
+//
+// A TTL of zero, the default, means links will not expire.
+func RedisTTL(ttl time.Duration) RedisOption {
+	return func(r *RedisStore) {
+		r.ttl = ttl
+	}
+}
+
+// The RedisAuth RedisOption sets the password that will be sent with the AUTH
+// command when connecting to the Redis server.
+func RedisAuth(password string) RedisOption {
+	return func(r *RedisStore) {
+		r.password = password
+	}
+}
+
+// The RedisDB RedisOption sets the database number that will be selected with
+// the SELECT command when connecting to the Redis server.
+func RedisDB(db int) RedisOption {
+	return func(r *RedisStore) {
+		r.db = db
+	}
+}
+
+// The RedisTimeout RedisOption sets the timeout for connecting to, and for
+// each command sent to, the Redis server. The default is 5 seconds.
+func RedisTimeout(timeout time.Duration) RedisOption {
+	return func(r *RedisStore) {
+		r.timeout = timeout
+	}
+}
+
+// The RedisErrorHandler RedisOption sets a function that will be called with
+// any error that occurs while communicating with the Redis server.
+//
+// As the Store interface does not allow for errors to be returned, when an
+// error occurs a Get will report that the key does not exist, a Create will
+// report that the key already exists, and a Set will be lost.
+//
+// By default, the error handler will panic, which the net/http server will
+// recover from, closing the connection to the client.
+func RedisErrorHandler(fn func(error)) RedisOption {
+	return func(r *RedisStore) {
+		r.errorHandler = fn
+	}
+}
+
+func panicOnError(err error) {
+	panic(err)
+}
+
+// NewRedisStore creates a new RedisStore that will connect to the Redis server
+// at the given address, using TCP.
+//
+// Connections are made as they are needed and are reused between requests.
+func NewRedisStore(addr string, opts ...RedisOption) *RedisStore {
+	r := &RedisStore{
+		addr:         addr,
+		timeout:      defaultRedisTimeout,
+		errorHandler: panicOnError,
+	}
+
+	for _, o := range opts {
+		o(r)
+	}
+
+	r.dial = (&net.Dialer{Timeout: r.timeout}).Dial
+	r.scanMatchPattern = redisEscapePattern(r.prefix) + "*"
+
+	return r
+}
+
+// The Get method satisfies the Store interface.
+func (r *RedisStore) Get(key string) (string, bool) {
+	reply, err := r.do("GET", r.prefix+key)
+	if err != nil {
+		r.errorHandler(err)
+
+		return "", false
+	}
+
+	url, ok := reply.(string)
+
+	return url, ok
+}
+
+// The Tx method satisfies the Store interface. As the RedisStore has no locks
+// of its own, the Tx passed to the function relies on the CreateTx interface
+// to create keys atomically.
+func (r *RedisStore) Tx(fn func(tx Tx)) {
+	fn(redisTx{r})
+}
+
+// The KeyTx method satisfies the KeyTxStore interface.
+func (r *RedisStore) KeyTx(_ string, fn func(tx Tx)) {
+	fn(redisTx{r})
+}
+
+// The Range method satisfies the Ranger interface, using the SCAN command to
+// iterate over the keys with the configured prefix.
+//
+// NB: As per the SCAN command, keys added or removed during the iteration may
+// or may not be included.
+func (r *RedisStore) Range(fn func(key, url string) bool) {
+	cursor := "0"
+
+	for {
+		reply, err := r.do("SCAN", cursor, "MATCH", r.scanMatchPattern, "COUNT", redisScanCount)
+		if err != nil {
+			r.errorHandler(err)
+
+			return
+		}
+
+		results, ok := reply.([]interface{})
+		if !ok || len(results) != 2 {
+			r.errorHandler(fmt.Errorf("%w: invalid SCAN reply", ErrRedisProtocol))
+
+			return
+		}
+
+		keys, _ := results[1].([]interface{})
+
+		for _, k := range keys {
+			key, _ := k.(string)
+
+			if url, ok := r.Get(strings.TrimPrefix(key, r.prefix)); ok && !fn(strings.TrimPrefix(key, r.prefix), url) {
+				return
+			}
+		}
+
+		if cursor, _ = results[0].(string); cursor == "0" || cursor == "" {
+			return
+		}
+	}
+}
+
+func (r *RedisStore) set(key, url string, nx bool) bool {
+	args := []string{"SET", r.prefix + key, url}
+
+	if nx {
+		args = append(args, "NX")
+	}
+
+	if r.ttl > 0 {
+		args = append(args, "PX", strconv.FormatInt(r.ttl.Milliseconds(), 10))
+	}
+
+	reply, err := r.do(args...)
+	if err != nil {
+		r.errorHandler(err)
+
+		return false
+	}
+
+	return reply == "OK"
+}
+
+// The Close method closes any idle connections to the Redis server.
+func (r *RedisStore) Close() error {
+	r.mu.Lock()
+	idle := r.idle
+	r.idle = nil
+	r.mu.Unlock()
+
+	for _, c := range idle {
+		c.Close()
+	}
+
+	return nil
+}
+
+type redisTx struct {
+	*RedisStore
+}
+
+func (r redisTx) Has(key string) bool {
+	reply, err := r.do("EXISTS", r.prefix+key)
+	if err != nil {
+		r.errorHandler(err)
+
+		return true
+	}
+
+	return reply != int64(0)
+}
+
+func (r redisTx) Set(key, url string) {
+	r.set(key, url, false)
+}
+
+func (r redisTx) Create(key, url string) bool {
+	return r.set(key, url, true)
+}
+
+type redisConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+	w    *bufio.Writer
+}
+
+func (c *redisConn) Close() error {
+	return c.conn.Close()
+}
+
+func (r *RedisStore) do(args ...string) (interface{}, error) {
+	c, err := r.conn()
+	if err != nil {
+		return nil, err
+	}
+
+	reply, err := c.do(r.timeout, args...)
+	if err != nil {
+		c.Close()
+
+		return nil, err
+	}
+
+	r.mu.Lock()
+	if len(r.idle) < maxIdleRedisConns {
+		r.idle = append(r.idle, c)
+		c = nil
+	}
+	r.mu.Unlock()
+
+	if c != nil {
+		c.Close()
+	}
+
+	if rerr, ok := reply.(redisError); ok {
+		return nil, rerr
+	}
+
+	return reply, nil
+}
+
+func (r *RedisStore) conn() (*redisConn, error) {
+	r.mu.Lock()
+	if l := len(r.idle); l > 0 {
+		c := r.idle[l-1]
+		r.idle = r.idle[:l-1]
+		r.mu.Unlock()
+
+		return c, nil
+	}
+	r.mu.Unlock()
+
+	nc, err := r.dial("tcp", r.addr)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &redisConn{
+		conn: nc,
+		r:    bufio.NewReader(nc),
+		w:    bufio.NewWriter(nc),
+	}
+
+	if r.password != "" {
+		if err := c.expectOK(r.timeout, "AUTH", r.password); err != nil {
+			c.Close()
+
+			return nil, err
+		}
+	}
+
+	if r.db != 0 {
+		if err := c.expectOK(r.timeout, "SELECT", strconv.Itoa(r.db)); err != nil {
+			c.Close()
+
+			return nil, err
+		}
+	}
+
+	return c, nil
+}
+
+func (c *redisConn) expectOK(timeout time.Duration, args ...string) error {
+	reply, err := c.do(timeout, args...)
+	if err != nil {
+		return err
+	} else if rerr, ok := reply.(redisError); ok {
+		return rerr
+	} else if reply != "OK" {
+		return fmt.Errorf("%w: unexpected reply to %s", ErrRedisProtocol, args[0])
+	}
+
+	return nil
+}
+
+func (c *redisConn) do(timeout time.Duration, args ...string) (interface{}, error) {
+	if timeout > 0 {
+		c.conn.SetDeadline(time.Now().Add(timeout))
+	}
+
+	fmt.Fprintf(c.w, "*%d\r\n", len(args))
+
+	for _, arg := range args {
+		fmt.Fprintf(c.w, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+
+	if err := c.w.Flush(); err != nil {
+		return nil, err
+	}
+
+	return c.readReply()
+}
+
+type redisError string
+
+func (r redisError) Error() string {
+	return "redis: " + string(r)
+}
+
+func (c *redisConn) readLine() (string, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return "", err
+	} else if !strings.HasSuffix(line, "\r\n") {
+		return "", fmt.Errorf("%w: invalid line ending", ErrRedisProtocol)
+	}
+
+	return line[:len(line)-2], nil
+}
+
+// readReply reads a RESP reply, returning a string for simple and bulk
+// strings, nil for null bulk strings and arrays, int64 for integers,
+// redisError for errors, and []interface{} for arrays.
+func (c *redisConn) readReply() (interface{}, error) {
+	line, err := c.readLine()
+	if err != nil {
+		return nil, err
+	} else if line == "" {
+		return nil, fmt.Errorf("%w: empty reply", ErrRedisProtocol)
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return redisError(line[1:]), nil
+	case ':':
+		n, err := strconv.ParseInt(line[1:], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid integer", ErrRedisProtocol)
+		}
+
+		return n, nil
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid bulk string length", ErrRedisProtocol)
+		} else if n < 0 {
+			return nil, nil
+		}
+
+		buf := make([]byte, n+2)
+
+		if _, err := io.ReadFull(c.r, buf); err != nil {
+			return nil, err
+		}
+
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid array length", ErrRedisProtocol)
+		} else if n < 0 {
+			return nil, nil
+		}
+
+		arr := make([]interface{}, n)
+
+		for i := range arr {
+			if arr[i], err = c.readReply(); err != nil {
+				return nil, err
+			}
+		}
+
+		return arr, nil
+	}
+
+	return nil, fmt.Errorf("%w: unknown reply type %q", ErrRedisProtocol, line[0])
+}
+
+func redisEscapePattern(s string) string {
+	var sb strings.Builder
+
+	for _, c := range s {
+		if strings.ContainsRune(`*?[]\^`, c) {
+			sb.WriteByte('\\')
+		}
+
+		sb.WriteRune(c)
+	}
+
+	return sb.String()
+}
+
+// Errors.
+var ErrRedisProtocol = errors.New("redis protocol error")
@@ -0,0 +1,225 @@
+package furl
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type redisServer struct {
+	net.Listener
+	password string
+	mu       sync.Mutex
+	data     map[string]string
+	expires  map[string]time.Time
+}
+
+func newRedisServer(t *testing.T, password string) *redisServer {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error listening: %s", err)
+	}
+	r := &redisServer{
+		Listener: l,
+		password: password,
+		data:     make(map[string]string),
+		expires:  make(map[string]time.Time),
+	}
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go r.handle(c)
+		}
+	}()
+	return r
+}
+
+func (r *redisServer) handle(c net.Conn) {
+	defer c.Close()
+	br := bufio.NewReader(c)
+	authed := r.password == ""
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			return
+		}
+		n, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+		args := make([]string, n)
+		for i := range args {
+			line, err := br.ReadString('\n')
+			if err != nil {
+				return
+			}
+			l, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+			buf := make([]byte, l+2)
+			if _, err := io.ReadFull(br, buf); err != nil {
+				return
+			}
+			args[i] = string(buf[:l])
+		}
+		cmd := strings.ToUpper(args[0])
+		if !authed && cmd != "AUTH" {
+			io.WriteString(c, "-NOAUTH Authentication required.\r\n")
+			continue
+		}
+		switch cmd {
+		case "AUTH":
+			if args[1] == r.password {
+				authed = true
+				io.WriteString(c, "+OK\r\n")
+			} else {
+				io.WriteString(c, "-WRONGPASS invalid password\r\n")
+			}
+		case "SELECT":
+			io.WriteString(c, "+OK\r\n")
+		case "GET":
+			if url, ok := r.get(args[1]); ok {
+				fmt.Fprintf(c, "$%d\r\n%s\r\n", len(url), url)
+			} else {
+				io.WriteString(c, "$-1\r\n")
+			}
+		case "EXISTS":
+			if _, ok := r.get(args[1]); ok {
+				io.WriteString(c, ":1\r\n")
+			} else {
+				io.WriteString(c, ":0\r\n")
+			}
+		case "SET":
+			var (
+				nx  bool
+				ttl time.Duration
+			)
+			for i := 3; i < len(args); i++ {
+				switch strings.ToUpper(args[i]) {
+				case "NX":
+					nx = true
+				case "PX":
+					i++
+					ms, _ := strconv.Atoi(args[i])
+					ttl = time.Duration(ms) * time.Millisecond
+				}
+			}
+			if r.set(args[1], args[2], nx, ttl) {
+				io.WriteString(c, "+OK\r\n")
+			} else {
+				io.WriteString(c, "$-1\r\n")
+			}
+		case "SCAN":
+			keys := r.scan(args[3])
+			fmt.Fprintf(c, "*2\r\n$1\r\n0\r\n*%d\r\n", len(keys))
+			for _, key := range keys {
+				fmt.Fprintf(c, "$%d\r\n%s\r\n", len(key), key)
+			}
+		default:
+			io.WriteString(c, "-ERR unknown command\r\n")
+		}
+	}
+}
+
+func (r *redisServer) get(key string) (string, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if e, ok := r.expires[key]; ok && time.Now().After(e) {
+		delete(r.data, key)
+		delete(r.expires, key)
+	}
+	url, ok := r.data[key]
+	return url, ok
+}
+
+func (r *redisServer) set(key, url string, nx bool, ttl time.Duration) bool {
+	if _, ok := r.get(key); ok && nx {
+		return false
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.data[key] = url
+	if ttl > 0 {
+		r.expires[key] = time.Now().Add(ttl)
+	}
+	return true
+}
+
+func (r *redisServer) scan(pattern string) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var keys []string
+	for key := range r.data {
+		if ok, _ := path.Match(pattern, key); ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func TestRedisStore(t *testing.T) {
+	srv := newRedisServer(t, "PASSWORD")
+	defer srv.Close()
+	srv.data["other"] = "not a link"
+	s := NewRedisStore(srv.Addr().String(), RedisAuth("PASSWORD"), RedisDB(1), RedisPrefix("furl:"))
+	defer s.Close()
+	f := New(SetStore(s))
+	for n, key := range [...]string{"AAA", "BBB"} {
+		url := "http://www.example.com/" + key
+		if post(f, key, url) != http.StatusOK {
+			t.Errorf("test %d: expecting key %q to be created", n+1, key)
+		} else if got, ok := s.Get(key); !ok || got != url {
+			t.Errorf("test %d: expecting key %q to have url %q, got %q", n+1, key, url, got)
+		}
+	}
+	if post(f, "AAA", "http://www.example.com/other") != http.StatusMethodNotAllowed {
+		t.Error("expecting existing key not to be created")
+	} else if got, _ := s.Get("AAA"); got != "http://www.example.com/AAA" {
+		t.Errorf("expecting existing key to be unchanged, got %q", got)
+	}
+	if _, ok := srv.get("furl:AAA"); !ok {
+		t.Error("expecting key to be stored with prefix")
+	}
+	if post(f, "", "http://www.example.com/generated") != http.StatusOK {
+		t.Error("expecting generated key to be created")
+	}
+	keys := make(map[string]string)
+	s.Range(func(key, url string) bool {
+		keys[key] = url
+		return true
+	})
+	if len(keys) != 3 || keys["BBB"] != "http://www.example.com/BBB" {
+		t.Errorf("expecting Range to return the 3 prefixed keys, got %v", keys)
+	}
+	var redisErr error
+	bad := NewRedisStore(srv.Addr().String(), RedisAuth("WRONG"), RedisErrorHandler(func(err error) {
+		redisErr = err
+	}))
+	if _, ok := bad.Get("AAA"); ok || redisErr == nil {
+		t.Error("expecting authentication error")
+	}
+}
+
+func TestRedisStoreTTL(t *testing.T) {
+	srv := newRedisServer(t, "")
+	defer srv.Close()
+	s := NewRedisStore(srv.Addr().String(), RedisTTL(50*time.Millisecond))
+	defer s.Close()
+	if post(New(SetStore(s)), "AAA", "http://www.example.com/") != http.StatusOK {
+		t.Fatal("expecting key to be created")
+	} else if _, ok := s.Get("AAA"); !ok {
+		t.Fatal("expecting key to exist")
+	}
+	time.Sleep(60 * time.Millisecond)
+	if _, ok := s.Get("AAA"); ok {
+		t.Error("expecting key to have expired")
+	}
+}
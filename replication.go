@@ -0,0 +1,691 @@
+package furl
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultLogSize    = 10000
+	heartbeatInterval = 30 * time.Second
+	minRetryDelay     = time.Second
+	maxRetryDelay     = 30 * time.Second
+
+	unauthorised    = "unauthorised"
+	readOnlyReplica = "read-only replica"
+)
+
+type change struct {
+	Epoch   string `json:"epoch,omitempty"`
+	Seq     uint64 `json:"seq,omitempty"`
+	Reset   bool   `json:"reset,omitempty"`
+	Key     string `json:"key,omitempty"`
+	URL     string `json:"url,omitempty"`
+	Meta    *Meta  `json:"meta,omitempty"`
+	Deleted bool   `json:"deleted,omitempty"`
+}
+
+// The Primary type wraps a Store, recording each key that is set so that the
+// changes can be streamed to Replicas.
+//
+// The Primary implements the Store, KeyTxStore, MetaStore, MetaRanger,
+// HistoryStore and Snapshotter interfaces, and should be used with SetStore in
+// place of the wrapped Store.
+//
+// The wrapped Store must implement the Ranger interface so that new replicas
+// can be sent the full set of data; if it also implements Snapshotter the
+// replicas will receive a consistent snapshot.
+type Primary struct {
+	Store
+	token   string
+	epoch   string
+	logSize int
+
+	mu     sync.Mutex
+	seq    uint64
+	first  uint64
+	log    []change
+	notify chan struct{}
+}
+
+// The PrimaryOption type is used to specify optional params to the NewPrimary
+// function call.
+type PrimaryOption func(*Primary)
+
+// The LogSize PrimaryOption sets the number of changes that the Primary will
+// keep in memory for replicas that are catching up. A replica that has fallen
+// further behind will receive the full data set.
+func LogSize(size int) PrimaryOption {
+	return func(p *Primary) {
+		p.logSize = size
+	}
+}
+
+// NewPrimary wraps the given Store to create a replication Primary. The change
+// stream, served by the Primary's ServeHTTP method, will require that requests
+// provide the token as a Bearer token in the Authorization header.
+//
+// Will return ErrTokenRequired if the token is blank.
+func NewPrimary(s Store, token string, opts ...PrimaryOption) (*Primary, error) {
+	if token == "" {
+		return nil, ErrTokenRequired
+	}
+
+	var epoch [12]byte
+
+	rand.Read(epoch[:])
+
+	p := &Primary{
+		Store:   s,
+		token:   token,
+		epoch:   base64.RawURLEncoding.EncodeToString(epoch[:]),
+		logSize: defaultLogSize,
+		first:   1,
+		notify:  make(chan struct{}),
+	}
+
+	for _, o := range opts {
+		o(p)
+	}
+
+	return p, nil
+}
+
+type primaryTx struct {
+	tx      Tx
+	changes *[]change
+}
+
+func (p primaryTx) Has(key string) bool {
+	return p.tx.Has(key)
+}
+
+func (p primaryTx) Set(key, url string) {
+	p.tx.Set(key, url)
+
+	*p.changes = append(*p.changes, change{Key: key, URL: url})
+}
+
+func (p primaryTx) Create(key, url string) bool {
+	if !create(p.tx, key, url) {
+		return false
+	}
+
+	*p.changes = append(*p.changes, change{Key: key, URL: url})
+
+	return true
+}
+
+func (p primaryTx) GetMeta(key string) (Meta, bool) {
+	return getMeta(p.tx, key)
+}
+
+func (p primaryTx) SetMeta(key string, meta Meta) {
+	setMeta(p.tx, key, &meta)
+
+	if l := len(*p.changes); l > 0 && (*p.changes)[l-1].Key == key && !(*p.changes)[l-1].Deleted {
+		(*p.changes)[l-1].Meta = &meta // send with the URL in a single change
+	} else {
+		*p.changes = append(*p.changes, change{Key: key, Meta: &meta})
+	}
+}
+
+func (p primaryTx) Delete(key string) {
+	if deleteKey(p.tx, key) {
+		*p.changes = append(*p.changes, change{Key: key, Deleted: true})
+	}
+}
+
+// record adds the changes to the log, once the Tx they were made in has
+// returned. The URL and Meta of each change are read back from the Store, so
+// that the log holds what the Store kept, in the order that it is recorded,
+// even when the Tx failed or a later Tx on the same key was recorded first.
+func (p *Primary) record(changes []change) {
+	if len(changes) == 0 {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, c := range changes {
+		if !c.Deleted {
+			url, ok := p.Store.Get(c.Key)
+			meta, hasMeta := getMeta(p.Store, c.Key)
+
+			switch {
+			case !ok:
+				c = change{Key: c.Key, Deleted: true}
+			case c.URL != "":
+				c.URL, c.Meta = url, nil
+
+				if hasMeta {
+					c.Meta = &meta
+				}
+			default:
+				c.Meta = &meta
+			}
+		}
+
+		p.seq++
+
+		if len(p.log) >= p.logSize && p.logSize > 1 {
+			drop := len(p.log) - p.logSize/2
+
+			p.log = append(p.log[:0], p.log[drop:]...)
+			p.first += uint64(drop)
+		}
+
+		c.Seq = p.seq
+		p.log = append(p.log, c)
+	}
+
+	close(p.notify)
+
+	p.notify = make(chan struct{})
+}
+
+// The Tx method satisfies the Store interface.
+func (p *Primary) Tx(fn func(tx Tx)) {
+	var changes []change
+
+	p.Store.Tx(func(tx Tx) {
+		changes = changes[:0]
+
+		fn(primaryTx{tx: tx, changes: &changes})
+	})
+	p.record(changes)
+}
+
+// The KeyTx method satisfies the KeyTxStore interface.
+func (p *Primary) KeyTx(key string, fn func(tx Tx)) {
+	var changes []change
+
+	keyTx(p.Store, key, func(tx Tx) {
+		changes = changes[:0]
+
+		fn(primaryTx{tx: tx, changes: &changes})
+	})
+	p.record(changes)
+}
+
+// The Range method satisfies the Ranger interface. It will not iterate over
+// anything if the wrapped Store does not implement Ranger.
+func (p *Primary) Range(fn func(key, url string) bool) {
+	if r, ok := p.Store.(Ranger); ok {
+		r.Range(fn)
+	}
+}
+
+// The RangeMeta method satisfies the MetaRanger interface.
+func (p *Primary) RangeMeta(fn func(key, url string, meta Meta) bool) {
+	if r, ok := p.Store.(Ranger); ok {
+		rangeMeta(r, fn)
+	}
+}
+
+// The GetMeta method satisfies the MetaStore interface.
+func (p *Primary) GetMeta(key string) (Meta, bool) {
+	return getMeta(p.Store, key)
+}
+
+// The History method satisfies the HistoryStore interface. It will return no
+// revisions if the wrapped Store does not implement HistoryStore.
+func (p *Primary) History(key string) []Revision {
+	history, _ := getHistory(p.Store, key)
+
+	return history
+}
+
+// The Snapshot method satisfies the Snapshotter interface. If the wrapped
+// Store does not implement Snapshotter, the snapshot will be made using its
+// Range method.
+func (p *Primary) Snapshot() Ranger {
+	if s, ok := p.Store.(Snapshotter); ok {
+		return s.Snapshot()
+	}
+
+	snap := newSnapshot(0)
+
+	p.RangeMeta(func(key, url string, meta Meta) bool {
+		snap.urls[key] = url
+
+		if !meta.isZero() {
+			snap.meta[key] = meta
+		}
+
+		return true
+	})
+
+	return snap
+}
+
+func (p *Primary) since(from uint64) ([]change, chan struct{}, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if from+1 < p.first {
+		return nil, nil, false
+	}
+
+	changes := append([]change(nil), p.log[from+1-p.first:]...)
+
+	return changes, p.notify, true
+}
+
+func authorised(r *http.Request, token string) bool {
+	auth := r.Header.Get("Authorization")
+
+	return strings.HasPrefix(auth, "Bearer ") && subtle.ConstantTimeCompare([]byte(auth[7:]), []byte(token)) == 1
+}
+
+// The ServeHTTP method satisfies the http.Handler interface and serves the
+// change stream to replicas.
+//
+// The stream is requested with a GET request, with the epoch and seq query
+// params specifying the position the replica has reached. The response is a
+// stream of JSON objects, one per line, that continues until the client
+// disconnects.
+//
+// The first line contains the epoch of the Primary and the seq the stream
+// starts from. If the replica cannot catch up from its position, because the
+// epoch is different or the seq is too old, this line will also have reset set
+// to true and will be followed by the full data set, as key:url objects, and
+// then an object with just the seq of the data set. After that, each line will
+// contain the seq, key, and either the url or the meta of a change.
+func (p *Primary) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !authorised(r, p.token) {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, unauthorised, http.StatusUnauthorized)
+
+		return
+	} else if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+
+		return
+	}
+
+	from, err := strconv.ParseUint(r.URL.Query().Get("seq"), 10, 64)
+
+	p.mu.Lock()
+	seq, first := p.seq, p.first
+	p.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/jsonl")
+
+	e := json.NewEncoder(w)
+
+	if err != nil || r.URL.Query().Get("epoch") != p.epoch || from > seq || from+1 < first {
+		e.Encode(change{Epoch: p.epoch, Seq: seq, Reset: true})
+
+		rangeMeta(p.Snapshot(), func(key, url string, meta Meta) bool {
+			ku := newKeyURL(key, url, meta)
+
+			return e.Encode(change{Key: key, URL: url, Meta: ku.Meta}) == nil
+		})
+
+		e.Encode(change{Seq: seq})
+
+		from = seq
+	} else {
+		e.Encode(change{Epoch: p.epoch, Seq: from})
+	}
+
+	flush(w)
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		changes, notify, ok := p.since(from)
+		if !ok {
+			return
+		}
+
+		for _, c := range changes {
+			if e.Encode(c) != nil {
+				return
+			}
+
+			from = c.Seq
+		}
+
+		flush(w)
+
+		select {
+		case <-notify:
+		case <-heartbeat.C:
+			if _, err := io.WriteString(w, "\n"); err != nil {
+				return
+			}
+
+			flush(w)
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func flush(w http.ResponseWriter) {
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// The Replica type follows the change stream of a Primary, storing the
+// changes in a local Store.
+//
+// The Replica implements the Store interface, serving Get requests from the
+// local Store, and should be used with SetStore. To keep the data consistent
+// with the Primary, POST requests should not be made to the Furl instance
+// directly, instead the Handler method should be used to wrap the Furl
+// instance, which will either forward or reject them.
+type Replica struct {
+	local   Store
+	primary string
+	token   string
+	client  *http.Client
+	forward http.Handler
+	save    func(epoch string, seq uint64)
+
+	mu    sync.RWMutex
+	epoch string
+	seq   uint64
+}
+
+// The ReplicaOption type is used to specify optional params to the NewReplica
+// function call.
+type ReplicaOption func(*Replica)
+
+// The Position ReplicaOption sets the position in the change stream of the
+// Primary that the Replica starts from. This should be the position last
+// passed to the function set by the SavePosition ReplicaOption, allowing a
+// restarted Replica to catch up without receiving the full data set.
+func Position(epoch string, seq uint64) ReplicaOption {
+	return func(r *Replica) {
+		r.epoch = epoch
+		r.seq = seq
+	}
+}
+
+// The SavePosition ReplicaOption sets a function that will be called with the
+// new position in the change stream each time the Replica has stored changes.
+func SavePosition(save func(epoch string, seq uint64)) ReplicaOption {
+	return func(r *Replica) {
+		r.save = save
+	}
+}
+
+// The Forward ReplicaOption sets the URL of the Primary's Furl instance, to
+// which the handler returned by the Handler method will forward POST requests.
+func Forward(u *url.URL) ReplicaOption {
+	return func(r *Replica) {
+		r.forward = httputil.NewSingleHostReverseProxy(u)
+	}
+}
+
+// The Client ReplicaOption sets the http.Client used to request the change
+// stream from the Primary.
+func Client(client *http.Client) ReplicaOption {
+	return func(r *Replica) {
+		r.client = client
+	}
+}
+
+// NewReplica creates a Replica that stores the changes from the change stream
+// at the primary URL in the local Store. The token will be sent to the Primary
+// as a Bearer token.
+//
+// The Run method must be called to start following the change stream.
+func NewReplica(local Store, primary, token string, opts ...ReplicaOption) *Replica {
+	r := &Replica{
+		local:   local,
+		primary: primary,
+		token:   token,
+		client:  http.DefaultClient,
+		save:    func(string, uint64) {},
+	}
+
+	for _, o := range opts {
+		o(r)
+	}
+
+	return r
+}
+
+// The Get method satisfies the Store interface, and retrieves the URL from the
+// local Store.
+func (r *Replica) Get(key string) (string, bool) {
+	return r.local.Get(key)
+}
+
+// The GetMeta method satisfies the MetaStore interface, and retrieves the Meta
+// from the local Store.
+func (r *Replica) GetMeta(key string) (Meta, bool) {
+	return getMeta(r.local, key)
+}
+
+// The History method satisfies the HistoryStore interface, and retrieves the
+// revisions from the local Store.
+func (r *Replica) History(key string) []Revision {
+	history, _ := getHistory(r.local, key)
+
+	return history
+}
+
+// The Tx method satisfies the Store interface.
+//
+// NB: Changes made with this method will be made only to the local Store, and
+// may be overwritten by the Primary.
+func (r *Replica) Tx(fn func(tx Tx)) {
+	r.local.Tx(fn)
+}
+
+// The Position method returns the current position of the Replica in the
+// change stream of the Primary.
+func (r *Replica) Position() (string, uint64) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.epoch, r.seq
+}
+
+// The Handler method wraps the given handler, normally the Furl instance using
+// the Replica as its Store, so that POST requests are forwarded to the Primary
+// when the Forward ReplicaOption has been set, or are rejected with 405 Method
+// Not Allowed when it has not.
+func (r *Replica) Handler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPost {
+			h.ServeHTTP(w, req)
+		} else if r.forward != nil {
+			r.forward.ServeHTTP(w, req)
+		} else {
+			w.Header().Set("Allow", optionsGetHead)
+			http.Error(w, readOnlyReplica, http.StatusMethodNotAllowed)
+		}
+	})
+}
+
+// The Run method follows the change stream of the Primary until the context is
+// cancelled, reconnecting when the stream is interrupted.
+//
+// Will return ErrUnauthorised if the Primary rejects the token, otherwise
+// will return the context error.
+func (r *Replica) Run(ctx context.Context) error {
+	delay := minRetryDelay
+
+	for {
+		caughtUp, err := r.follow(ctx)
+		if errors.Is(err, ErrUnauthorised) {
+			return err
+		} else if caughtUp {
+			delay = minRetryDelay
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+
+		if delay *= 2; delay > maxRetryDelay {
+			delay = maxRetryDelay
+		}
+	}
+}
+
+func (r *Replica) follow(ctx context.Context) (bool, error) {
+	epoch, seq := r.Position()
+
+	u, err := url.Parse(r.primary)
+	if err != nil {
+		return false, err
+	}
+
+	q := u.Query()
+	q.Set("epoch", epoch)
+	q.Set("seq", strconv.FormatUint(seq, 10))
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return false, err
+	}
+
+	if r.token != "" {
+		req.Header.Set("Authorization", "Bearer "+r.token)
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return false, err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		return false, ErrUnauthorised
+	} else if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("%w: %s", ErrReplication, resp.Status)
+	}
+
+	d := json.NewDecoder(resp.Body)
+
+	var header change
+
+	if err := d.Decode(&header); err != nil {
+		return false, err
+	} else if header.Reset {
+		if err := r.reset(d, header); err != nil {
+			return false, err
+		}
+	} else if header.Epoch != epoch || header.Seq != seq {
+		return false, fmt.Errorf("%w: unexpected stream position", ErrReplication)
+	}
+
+	for {
+		var c change
+
+		if err := d.Decode(&c); err != nil {
+			return true, err
+		}
+
+		r.set(c)
+		r.setPosition(header.Epoch, c.Seq)
+	}
+}
+
+// reset stores the full data set sent by the Primary, removing any keys from
+// the local Store that are not in it.
+func (r *Replica) reset(d *json.Decoder, header change) error {
+	keys := make(map[string]struct{})
+
+	for {
+		var c change
+
+		if err := d.Decode(&c); err != nil {
+			return err
+		} else if c.Key == "" {
+			if c.Seq != header.Seq {
+				return fmt.Errorf("%w: unexpected end of data set", ErrReplication)
+			}
+
+			r.prune(keys)
+			r.setPosition(header.Epoch, c.Seq)
+
+			return nil
+		}
+
+		keys[c.Key] = struct{}{}
+
+		r.set(c)
+	}
+}
+
+func (r *Replica) prune(keys map[string]struct{}) {
+	local, ok := r.local.(Ranger)
+	if !ok {
+		return
+	}
+
+	var remove []string
+
+	local.Range(func(key, _ string) bool {
+		if _, ok := keys[key]; !ok {
+			remove = append(remove, key)
+		}
+
+		return true
+	})
+
+	for _, key := range remove {
+		keyTx(r.local, key, func(tx Tx) {
+			deleteKey(tx, key)
+		})
+	}
+}
+
+func (r *Replica) set(c change) {
+	keyTx(r.local, c.Key, func(tx Tx) {
+		if c.Deleted {
+			deleteKey(tx, c.Key)
+
+			return
+		} else if c.URL != "" {
+			tx.Set(c.Key, c.URL)
+		}
+
+		setMeta(tx, c.Key, c.Meta)
+	})
+}
+
+func (r *Replica) setPosition(epoch string, seq uint64) {
+	r.mu.Lock()
+	r.epoch = epoch
+	r.seq = seq
+	r.mu.Unlock()
+
+	r.save(epoch, seq)
+}
+
+// Errors.
+var (
+	ErrUnauthorised  = errors.New(unauthorised)
+	ErrReplication   = errors.New("replication error")
+	ErrTokenRequired = errors.New("token required")
+)
@@ -0,0 +1,169 @@
+package furl
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func waitFor(t *testing.T, s Store, key, url string) {
+	t.Helper()
+	for i := 0; i < 100; i++ {
+		if got, _ := s.Get(key); got == url {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("timed out waiting for key %q to have url %q", key, url)
+}
+
+func TestReplication(t *testing.T) {
+	primary, err := NewPrimary(NewStore(Data(map[string]string{
+		"AAA": "http://www.google.com",
+	})), "TOKEN", LogSize(4))
+	if err != nil {
+		t.Fatalf("unexpected error creating primary: %s", err)
+	}
+	pf := New(SetStore(primary))
+	stream := httptest.NewServer(primary)
+	defer stream.Close()
+	public := httptest.NewServer(pf)
+	defer public.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := NewReplica(NewStore(), stream.URL, "BAD").Run(ctx); !errors.Is(err, ErrUnauthorised) {
+		t.Fatalf("expecting error %v, got %v", ErrUnauthorised, err)
+	}
+
+	var (
+		positions  = make(chan uint64, 100)
+		local      = NewStore()
+		forward, _ = url.Parse(public.URL)
+	)
+	replica := NewReplica(local, stream.URL, "TOKEN", Forward(forward), SavePosition(func(_ string, seq uint64) {
+		positions <- seq
+	}))
+	done := make(chan error)
+	go func() {
+		done <- replica.Run(ctx)
+	}()
+	waitFor(t, replica, "AAA", "http://www.google.com")
+	rh := replica.Handler(New(SetStore(replica)))
+	if code := post(rh, "BBB", "http://www.example.com/B"); code != http.StatusOK {
+		t.Errorf("expecting forwarded POST to return 200, got %d", code)
+	}
+	waitFor(t, replica, "BBB", "http://www.example.com/B")
+	if code := post(pf, "CCC", "http://www.example.com/C"); code != http.StatusOK {
+		t.Errorf("expecting POST to return 200, got %d", code)
+	}
+	waitFor(t, replica, "CCC", "http://www.example.com/C")
+	if _, ok := replica.GetMeta("CCC"); !ok {
+		t.Error("expecting replica to have meta for key CCC")
+	}
+	w := httptest.NewRecorder()
+	rh.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/CCC", nil))
+	if w.Code != http.StatusMovedPermanently || w.Header().Get("Location") != "http://www.example.com/C" {
+		t.Errorf("expecting replica to redirect to %q, got %d %q", "http://www.example.com/C", w.Code, w.Header().Get("Location"))
+	}
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("expecting error %v, got %v", context.Canceled, err)
+	}
+	epoch, seq := replica.Position()
+	if seq != 2 {
+		t.Errorf("expecting replica to be at seq 2, got %d", seq)
+	}
+	close(positions)
+	var saved uint64
+	for saved = range positions {
+	}
+	if saved != seq {
+		t.Errorf("expecting saved position to be %d, got %d", seq, saved)
+	}
+
+	post(pf, "DDD", "http://www.example.com/D")
+	post(pf, "EEE", "http://www.example.com/E")
+
+	local.Tx(func(tx Tx) {
+		tx.Set("ZZZ", "http://www.example.com/Z")
+	})
+	ctx, cancel = context.WithCancel(context.Background())
+	restarted := NewReplica(local, stream.URL, "TOKEN", Position(epoch, seq))
+	go func() {
+		done <- restarted.Run(ctx)
+	}()
+	waitFor(t, restarted, "EEE", "http://www.example.com/E")
+	if _, ok := restarted.Get("ZZZ"); !ok {
+		t.Error("expecting restarted replica to have caught up without a reset")
+	}
+	if code := post(restarted.Handler(New(SetStore(restarted))), "FFF", "http://www.example.com/F"); code != http.StatusMethodNotAllowed {
+		t.Errorf("expecting POST to replica without forwarding to return 405, got %d", code)
+	}
+	cancel()
+	<-done
+
+	for i := 0; i < 5; i++ {
+		post(pf, "", "http://www.example.com/generated")
+	}
+	behind := NewStore(Data(map[string]string{"STALE": "http://www.example.com/stale"}))
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	go NewReplica(behind, stream.URL, "TOKEN", Position(epoch, seq)).Run(ctx)
+	waitFor(t, behind, "EEE", "http://www.example.com/E")
+	var count int
+	behind.(Ranger).Range(func(_, _ string) bool {
+		count++
+		return true
+	})
+	if count != 10 {
+		t.Errorf("expecting replica that has fallen behind to receive all 10 keys, got %d", count)
+	} else if _, ok := behind.Get("STALE"); ok {
+		t.Error("expecting reset to remove key not held by primary")
+	}
+}
+
+func testPrimary(t *testing.T, s Store) *Primary {
+	t.Helper()
+	p, err := NewPrimary(s, "TOKEN")
+	if err != nil {
+		t.Fatalf("unexpected error creating primary: %s", err)
+	}
+	return p
+}
+
+func TestPrimaryToken(t *testing.T) {
+	if _, err := NewPrimary(NewStore(), ""); !errors.Is(err, ErrTokenRequired) {
+		t.Errorf("expecting error %v, got %v", ErrTokenRequired, err)
+	}
+}
+
+func TestPrimaryFailedTx(t *testing.T) {
+	btree, err := OpenBTreeStore(filepath.Join(t.TempDir(), "furl.btree"), BTreeErrorHandler(func(error) {}))
+	if err != nil {
+		t.Fatalf("unexpected error opening btree: %s", err)
+	}
+	defer btree.Close()
+	p := testPrimary(t, btree)
+	p.Tx(func(tx Tx) {
+		tx.Set("AAA", "http://www.example.com/")
+		tx.Set(strings.Repeat("B", btreePageSize), "http://www.example.com/")
+	})
+	p.Tx(func(tx Tx) {
+		tx.Set("CCC", "http://www.example.com/C")
+	})
+	changes, _, _ := p.since(0)
+	for _, c := range changes {
+		if c.Key == "AAA" && !c.Deleted {
+			t.Errorf("expecting change from failed tx not to be sent, got %v", c)
+		}
+	}
+	if l := len(changes); l == 0 || changes[l-1].Key != "CCC" || changes[l-1].URL != "http://www.example.com/C" {
+		t.Errorf("expecting last change to set CCC, got %v", changes)
+	}
+}
@@ -0,0 +1,218 @@
+package furl
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+const keyReserved = "key reserved"
+
+// The ReservedKeys type is a list of keys that cannot be used for links, such
+// as the paths of other services on the same host, or offensive words.
+//
+// Each entry in the list is a pattern which can match keys in the following
+// ways:
+//
+//	admin   - Matches the key admin exactly.
+//	static* - Matches any key starting with static.
+//	~login  - Matches the key login in any case, such as Login or LOGIN.
+//	~api*   - Matches any key starting with api in any case, such as APIv2.
+//
+// A ReservedKeys is safe for concurrent use, and patterns can be added while
+// it is in use by Furl.
+type ReservedKeys struct {
+	mu           sync.RWMutex
+	patterns     []string
+	exact        map[string]struct{}
+	folded       map[string]struct{}
+	prefix       []string
+	foldedPrefix []string
+	canonical    []canonicalReserved
+}
+
+type canonicalReserved struct {
+	keys         *ReservedKeys
+	canonicalise func(string) string
+}
+
+// NewReservedKeys creates a ReservedKeys list containing the given patterns.
+//
+// Will return an error wrapping ErrInvalidPattern if any of the patterns would
+// match every key.
+func NewReservedKeys(patterns ...string) (*ReservedKeys, error) {
+	r := newReservedKeys()
+
+	if err := r.Add(patterns...); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func newReservedKeys() *ReservedKeys {
+	return &ReservedKeys{
+		exact:  make(map[string]struct{}),
+		folded: make(map[string]struct{}),
+	}
+}
+
+// LoadReservedKeys reads a ReservedKeys list from the given reader, which
+// should contain one pattern per line.
+//
+// Blank lines, and lines starting with a #, are ignored, as is any surrounding
+// whitespace.
+func LoadReservedKeys(rd io.Reader) (*ReservedKeys, error) {
+	var (
+		r = newReservedKeys()
+		s = bufio.NewScanner(rd)
+	)
+
+	for line := 1; s.Scan(); line++ {
+		pattern := strings.TrimSpace(s.Text())
+
+		if pattern == "" || strings.HasPrefix(pattern, "#") {
+			continue
+		} else if err := r.Add(pattern); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+	}
+
+	if err := s.Err(); err != nil {
+		return nil, fmt.Errorf("error reading reserved keys: %w", err)
+	}
+
+	return r, nil
+}
+
+// The Add method adds patterns to the ReservedKeys list.
+//
+// Will return an error wrapping ErrInvalidPattern, and add none of the
+// patterns, if any of the patterns would match every key, such as an empty
+// pattern or a bare *.
+func (r *ReservedKeys) Add(patterns ...string) error {
+	for _, pattern := range patterns {
+		if strings.Trim(pattern, "~*") == "" {
+			return fmt.Errorf("%q: %w", pattern, ErrInvalidPattern)
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.add(patterns)
+
+	for _, c := range r.canonical {
+		c.keys.add(canonicalPatterns(patterns, c.canonicalise))
+	}
+
+	return nil
+}
+
+func (r *ReservedKeys) add(patterns []string) {
+	r.patterns = append(r.patterns, patterns...)
+
+	for _, pattern := range patterns {
+		fold := strings.HasPrefix(pattern, "~")
+		if fold {
+			pattern = strings.ToLower(pattern[1:])
+		}
+
+		switch prefix := strings.TrimSuffix(pattern, "*"); {
+		case prefix != pattern && fold:
+			r.foldedPrefix = append(r.foldedPrefix, prefix)
+		case prefix != pattern:
+			r.prefix = append(r.prefix, prefix)
+		case fold:
+			r.folded[pattern] = struct{}{}
+		default:
+			r.exact[pattern] = struct{}{}
+		}
+	}
+}
+
+// The Reserved method returns true if the key matches any of the patterns in
+// the ReservedKeys list.
+func (r *ReservedKeys) Reserved(key string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if _, ok := r.exact[key]; ok {
+		return true
+	}
+
+	lower := strings.ToLower(key)
+
+	if _, ok := r.folded[lower]; ok {
+		return true
+	}
+
+	for _, prefix := range r.prefix {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+
+	for _, prefix := range r.foldedPrefix {
+		if strings.HasPrefix(lower, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// canonicalised returns a new list containing the patterns converted to
+// canonical form by the given function, which is kept up to date with any
+// patterns later added to the list.
+func (r *ReservedKeys) canonicalised(canonicalise func(string) string) *ReservedKeys {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	c := newReservedKeys()
+
+	c.add(canonicalPatterns(r.patterns, canonicalise))
+
+	r.canonical = append(r.canonical, canonicalReserved{keys: c, canonicalise: canonicalise})
+
+	return c
+}
+
+func canonicalPatterns(patterns []string, canonicalise func(string) string) []string {
+	canonical := make([]string, 0, len(patterns))
+
+	for _, pattern := range patterns {
+		fold, prefix := "", ""
+
+		if strings.HasPrefix(pattern, "~") {
+			fold, pattern = "~", pattern[1:]
+		}
+
+		if strings.HasSuffix(pattern, "*") {
+			prefix, pattern = "*", pattern[:len(pattern)-1]
+		}
+
+		canonical = append(canonical, fold+canonicalise(pattern)+prefix)
+	}
+
+	return canonical
+}
+
+// reservedKey returns true if the key, either as given or in its canonical
+// form, is reserved.
+func (f *Furl) reservedKey(key string) bool {
+	if f.reserved == nil {
+		return false
+	}
+
+	return f.reserved.Reserved(key) || f.reservedCanonical.Reserved(f.canonicalise(key))
+}
+
+// Errors.
+var (
+	ErrKeyReserved    = errors.New(keyReserved)
+	ErrInvalidPattern = errors.New("invalid reserved key pattern")
+)
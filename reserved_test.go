@@ -0,0 +1,124 @@
+package furl
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestReservedKeys(t *testing.T) {
+	r, err := LoadReservedKeys(strings.NewReader("# reserved\nadmin\n\n  static*\n~login\n~api*\n"))
+	if err != nil {
+		t.Fatalf("unexpected error loading reserved keys: %s", err)
+	}
+	for n, test := range [...]struct {
+		Key      string
+		Reserved bool
+	}{
+		{ // 1
+			Key:      "admin",
+			Reserved: true,
+		},
+		{ // 2
+			Key: "Admin",
+		},
+		{ // 3
+			Key:      "static",
+			Reserved: true,
+		},
+		{ // 4
+			Key:      "static-files",
+			Reserved: true,
+		},
+		{ // 5
+			Key: "Static",
+		},
+		{ // 6
+			Key:      "LogIn",
+			Reserved: true,
+		},
+		{ // 7
+			Key: "login2",
+		},
+		{ // 8
+			Key:      "APIv2",
+			Reserved: true,
+		},
+		{ // 9
+			Key: "my-api",
+		},
+	} {
+		if reserved := r.Reserved(test.Key); reserved != test.Reserved {
+			t.Errorf("test %d: expecting reserved to be %v, got %v", n+1, test.Reserved, reserved)
+		}
+	}
+	if _, err := LoadReservedKeys(strings.NewReader("admin\n~*\n")); !errors.Is(err, ErrInvalidPattern) {
+		t.Errorf("expecting error %v, got %v", ErrInvalidPattern, err)
+	}
+	for n, pattern := range [...]string{"", "*", "~", "~*"} {
+		if _, err := NewReservedKeys("admin", pattern); !errors.Is(err, ErrInvalidPattern) {
+			t.Errorf("test %d: expecting error %v, got %v", n+1, ErrInvalidPattern, err)
+		} else if err := r.Add("other", pattern); !errors.Is(err, ErrInvalidPattern) {
+			t.Errorf("test %d: expecting error %v, got %v", n+1, ErrInvalidPattern, err)
+		} else if r.Reserved("other") {
+			t.Errorf("test %d: expecting no patterns to be added", n+1)
+		}
+	}
+}
+
+func TestReservedPost(t *testing.T) {
+	keys, _ := NewReservedKeys("~admin")
+	f := New(Reserved(keys))
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/ADMIN", strings.NewReader(`{"url":"http://www.example.com/"}`))
+	r.Header.Set("Content-Type", "application/json")
+	f.ServeHTTP(w, r)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("expecting response code 403, got %d", w.Code)
+	} else if response := w.Body.String(); response != `{"error":"key reserved"}` {
+		t.Errorf("unexpected response: %q", response)
+	}
+	if _, err := f.Import(strings.NewReader(`{"key":"admin","url":"http://www.example.com/"}`), JSONLines, ConflictFail); !errors.Is(err, ErrKeyReserved) {
+		t.Errorf("expecting error %v, got %v", ErrKeyReserved, err)
+	}
+	var all []string
+	for _, c := range "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789-_" {
+		all = append(all, string(c)+"*")
+	}
+	keys, _ = NewReservedKeys(all...)
+	if code := post(New(Reserved(keys), KeyLength(2040), CollisionRetries(1)), "", "http://www.example.com/"); code != http.StatusInternalServerError {
+		t.Errorf("expecting generated keys to be reserved, got response code %d", code)
+	}
+}
+
+func TestReservedCanonical(t *testing.T) {
+	keys, err := NewReservedKeys("admin", "Static*")
+	if err != nil {
+		t.Fatalf("unexpected error creating reserved keys: %s", err)
+	}
+	f := New(Reserved(keys), Canonicalise(FoldLookalikes))
+	for n, test := range [...]struct {
+		Key  string
+		Code int
+	}{
+		{Key: "ADMIN", Code: http.StatusForbidden},        // 1
+		{Key: "AdM1n", Code: http.StatusForbidden},        // 2
+		{Key: "static", Code: http.StatusForbidden},       // 3
+		{Key: "STAT1Cfile", Code: http.StatusForbidden},   // 4
+		{Key: "Login", Code: http.StatusOK},               // 5
+		{Key: "LOGIN", Code: http.StatusMethodNotAllowed}, // 6
+	} {
+		if code := post(f, test.Key, "http://www.example.com/"); code != test.Code {
+			t.Errorf("test %d: expecting response code %d, got %d", n+1, test.Code, code)
+		}
+	}
+	keys.Add("New*")
+	if code := post(f, "NEWS", "http://www.example.com/"); code != http.StatusForbidden {
+		t.Errorf("expecting added pattern to be reserved, got response code %d", code)
+	}
+	if _, ok := f.store.Get("admin"); ok {
+		t.Error("expecting reserved key not to be created")
+	}
+}
@@ -0,0 +1,360 @@
+package furl
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"golang.org/x/text/language"
+)
+
+const (
+	maxRules = 32
+
+	deviceIOS     = "ios"
+	deviceAndroid = "android"
+	deviceMobile  = "mobile"
+	deviceDesktop = "desktop"
+
+	invalidRules = "invalid rules"
+)
+
+var rulesContentTypes = []string{"application/json", "text/json", "application/xml", "text/xml"}
+
+// The Rule type is a targeting rule for a link, which sends requests that match
+// all of its conditions to its URL instead of the URL of the link.
+//
+// The Device condition matches the device of the User-Agent of the request,
+// and is one of ios, android, mobile, which matches any mobile device, or
+// desktop.
+//
+// The Language condition matches the most preferred language of the
+// Accept-Language header of the request, such that a language of en matches
+// en-GB, but a language of en-GB does not match en-US.
+//
+// The Header condition matches a request that has the named header, and, if a
+// Value is given, whose value contains it, without regard to case.
+//
+// The Country condition matches the country of the client address of the
+// request, as found in the database set with the GeoIP Option, and is a comma
+// separated list of ISO 3166-1 alpha-2 codes, such as GB,IE. Without a
+// database, or for an address with an unknown country, it matches no requests.
+//
+// A Rule must have at least one condition.
+type Rule struct {
+	Device   string `json:"device,omitempty" xml:"device,omitempty"`
+	Language string `json:"language,omitempty" xml:"language,omitempty"`
+	Header   string `json:"header,omitempty" xml:"header,omitempty"`
+	Value    string `json:"value,omitempty" xml:"value,omitempty"`
+	Country  string `json:"country,omitempty" xml:"country,omitempty"`
+	URL      string `json:"url" xml:"url"`
+}
+
+func (f *Furl) validRules(rules []Rule) bool {
+	for _, rule := range rules {
+		if !f.validURL(rule.URL) || rule.Device == "" && rule.Language == "" && rule.Header == "" && rule.Country == "" || rule.Value != "" && rule.Header == "" {
+			return false
+		}
+
+		switch rule.Device {
+		case "", deviceIOS, deviceAndroid, deviceMobile, deviceDesktop:
+		default:
+			return false
+		}
+
+		if rule.Language != "" {
+			if _, err := language.Parse(rule.Language); err != nil {
+				return false
+			}
+		}
+
+		if rule.Header != "" && strings.ContainsAny(rule.Header, " \t\r\n:") {
+			return false
+		}
+
+		if rule.Country != "" && !validCountries(rule.Country) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func validCountries(countries string) bool {
+	for _, country := range strings.Split(countries, ",") {
+		if len(country) != 2 {
+			return false
+		}
+
+		for _, c := range country {
+			if (c < 'A' || c > 'Z') && (c < 'a' || c > 'z') {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+func matchCountry(countries, country string) bool {
+	if country == "" {
+		return false
+	}
+
+	for _, c := range strings.Split(countries, ",") {
+		if strings.EqualFold(c, country) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (rule Rule) matches(r *http.Request, country string) bool {
+	if rule.Country != "" && !matchCountry(rule.Country, country) {
+		return false
+	} else if rule.Device != "" && !matchDevice(rule.Device, r.Header.Get("User-Agent")) {
+		return false
+	} else if rule.Language != "" && !matchLanguage(rule.Language, r.Header.Get("Accept-Language")) {
+		return false
+	} else if rule.Header != "" {
+		values, ok := r.Header[http.CanonicalHeaderKey(rule.Header)]
+		if !ok || rule.Value != "" && !strings.Contains(strings.ToLower(strings.Join(values, ", ")), strings.ToLower(rule.Value)) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func matchDevice(device, userAgent string) bool {
+	switch device {
+	case deviceIOS:
+		return isIOS(userAgent)
+	case deviceAndroid:
+		return strings.Contains(userAgent, "Android")
+	case deviceMobile:
+		return isMobile(userAgent)
+	case deviceDesktop:
+		return !isMobile(userAgent)
+	}
+
+	return false
+}
+
+func isIOS(userAgent string) bool {
+	return strings.Contains(userAgent, "iPhone") || strings.Contains(userAgent, "iPad") || strings.Contains(userAgent, "iPod")
+}
+
+func isMobile(userAgent string) bool {
+	return isIOS(userAgent) || strings.Contains(userAgent, "Android") || strings.Contains(userAgent, "Mobile")
+}
+
+func matchLanguage(lang, acceptLanguage string) bool {
+	tags, _, err := language.ParseAcceptLanguage(acceptLanguage)
+	if err != nil || len(tags) == 0 {
+		return false
+	}
+
+	rule := language.Make(lang)
+
+	for tag := tags[0]; ; tag = tag.Parent() {
+		if tag == rule {
+			return true
+		} else if tag.IsRoot() {
+			break
+		}
+	}
+
+	base, _ := tags[0].Base()
+
+	return rule == language.Make(base.String())
+}
+
+// ruleDestination returns the URL of the first of the rules that matches the
+// request, setting the Vary header to the request headers that the rules use.
+func (f *Furl) ruleDestination(w http.ResponseWriter, r *http.Request, rules []Rule) (string, bool) {
+	var (
+		vary    []string
+		country string
+		located bool
+	)
+
+	for _, rule := range rules {
+		if rule.Country != "" && !located {
+			country = f.country(r)
+			located = true
+		}
+
+		if rule.Device != "" {
+			vary = appendVary(vary, "User-Agent")
+		}
+
+		if rule.Language != "" {
+			vary = appendVary(vary, "Accept-Language")
+		}
+
+		if rule.Header != "" {
+			vary = appendVary(vary, http.CanonicalHeaderKey(rule.Header))
+		}
+	}
+
+	if len(vary) > 0 {
+		w.Header().Set("Vary", strings.Join(vary, ", "))
+	}
+
+	for _, rule := range rules {
+		if rule.matches(r, country) {
+			return rule.URL, true
+		}
+	}
+
+	return "", false
+}
+
+func appendVary(vary []string, header string) []string {
+	for _, v := range vary {
+		if v == header {
+			return vary
+		}
+	}
+
+	return append(vary, header)
+}
+
+// The SetRules method replaces the targeting rules of a link, which are
+// checked, in order, before following the link. An empty list of rules
+// removes all of the rules from the link.
+//
+// The Store must implement the MetaStore interface for the rules to be stored,
+// otherwise ErrMetaUnsupported is returned.
+func (f *Furl) SetRules(key string, rules []Rule) error {
+	return f.setRules(actor{source: SourceAdmin}, key, rules)
+}
+
+func (f *Furl) setRules(a actor, key string, rules []Rule) error {
+	if len(rules) > maxRules || !f.validRules(rules) {
+		return ErrInvalidRules
+	} else if len(rules) > 0 && !storesMeta(f.store) {
+		return ErrMetaUnsupported
+	} else if len(rules) == 0 {
+		rules = nil
+	}
+
+	var err error
+
+	key = f.canonicalise(key)
+
+	f.keyTx(a, key, func(tx Tx) {
+		meta, _ := getMeta(tx, key)
+		if !tx.Has(key) || meta.Deleted != nil {
+			err = fmt.Errorf("key %s: %w", key, ErrMissingKey)
+
+			return
+		}
+
+		if meta.Rules = rules; !meta.valid() {
+			err = ErrInvalidRules
+
+			return
+		}
+
+		setMeta(tx, key, &meta)
+	})
+
+	return err
+}
+
+type xmlRules struct {
+	XMLName xml.Name `xml:"rules"`
+	Rules   []Rule   `xml:"rule"`
+}
+
+func (a admin) rules(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		a.getRules(w, r)
+	case http.MethodPost:
+		a.postRules(w, r)
+	default:
+		w.Header().Set("Allow", "GET, HEAD, POST")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+	}
+}
+
+func (a admin) getRules(w http.ResponseWriter, r *http.Request) {
+	key := a.canonicalise(r.FormValue("key"))
+
+	meta, _ := getMeta(a.store, key)
+	if _, ok := a.store.Get(key); !ok || meta.Deleted != nil {
+		http.NotFound(w, r)
+
+		return
+	}
+
+	contentType := negotiate(r.Header.Get("Accept"), rulesContentTypes)
+	if contentType == "" {
+		http.Error(w, notAcceptable, http.StatusNotAcceptable)
+
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+
+	if r.Method == http.MethodHead {
+		return
+	} else if meta.Rules == nil {
+		meta.Rules = []Rule{}
+	}
+
+	switch contentType {
+	case "application/json", "text/json":
+		json.NewEncoder(w).Encode(meta.Rules)
+	default:
+		xml.NewEncoder(w).Encode(xmlRules{Rules: meta.Rules})
+	}
+}
+
+func (a admin) postRules(w http.ResponseWriter, r *http.Request) {
+	var (
+		rules []Rule
+		err   error
+	)
+
+	switch r.Header.Get("Content-Type") {
+	case "application/json", "text/json":
+		err = json.NewDecoder(r.Body).Decode(&rules)
+	case "application/xml", "text/xml":
+		var x xmlRules
+
+		err = xml.NewDecoder(r.Body).Decode(&x)
+		rules = x.Rules
+	default:
+		http.Error(w, unrecognisedContentType, http.StatusUnsupportedMediaType)
+
+		return
+	}
+
+	if err != nil {
+		http.Error(w, failedReadRequest, http.StatusBadRequest)
+
+		return
+	}
+
+	switch err := a.setRules(actor{SourceAdmin, r}, r.FormValue("key"), rules); {
+	case err == nil:
+		w.WriteHeader(http.StatusNoContent)
+	case errors.Is(err, ErrInvalidRules):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, ErrMetaUnsupported):
+		http.Error(w, err.Error(), http.StatusNotImplemented)
+	default:
+		http.Error(w, err.Error(), http.StatusNotFound)
+	}
+}
+
+// Errors.
+var ErrInvalidRules = errors.New(invalidRules)
@@ -0,0 +1,207 @@
+package furl
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const (
+	testIPhone  = "Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.0 Mobile/15E148 Safari/604.1"
+	testAndroid = "Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Mobile Safari/537.36"
+	testDesktop = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36"
+)
+
+func TestRules(t *testing.T) {
+	f := New(URLValidator(HTTPURL))
+	r := httptest.NewRequest(http.MethodPost, "/AAA", strings.NewReader(`{"url":"http://www.example.com/","rules":[{"device":"ios","url":"https://apps.apple.com/app"},{"device":"android","url":"https://play.google.com/app"},{"language":"fr","url":"http://www.example.com/fr"},{"header":"x-beta","value":"YES","url":"http://beta.example.com/"}]}`))
+	r.Header.Set("Content-Type", "application/json")
+	f.ServeHTTP(httptest.NewRecorder(), r)
+	for n, test := range [...]struct {
+		Headers  map[string]string
+		Code     int
+		Location string
+	}{
+		{ // 1
+			Headers:  map[string]string{"User-Agent": testIPhone, "Accept-Language": "fr-FR"},
+			Code:     http.StatusFound,
+			Location: "https://apps.apple.com/app",
+		},
+		{ // 2
+			Headers:  map[string]string{"User-Agent": testAndroid},
+			Code:     http.StatusFound,
+			Location: "https://play.google.com/app",
+		},
+		{ // 3
+			Headers:  map[string]string{"User-Agent": testDesktop},
+			Code:     http.StatusFound,
+			Location: "http://www.example.com/",
+		},
+		{ // 4
+			Headers:  map[string]string{"User-Agent": testDesktop, "Accept-Language": "fr-CA, en;q=0.8"},
+			Code:     http.StatusFound,
+			Location: "http://www.example.com/fr",
+		},
+		{ // 5
+			Headers:  map[string]string{"User-Agent": testDesktop, "Accept-Language": "en-GB, fr;q=0.8"},
+			Code:     http.StatusFound,
+			Location: "http://www.example.com/",
+		},
+		{ // 6
+			Headers:  map[string]string{"X-Beta": "yes please"},
+			Code:     http.StatusFound,
+			Location: "http://beta.example.com/",
+		},
+		{ // 7
+			Headers:  map[string]string{"X-Beta": "no"},
+			Code:     http.StatusFound,
+			Location: "http://www.example.com/",
+		},
+	} {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/AAA", nil)
+		for k, v := range test.Headers {
+			r.Header.Set(k, v)
+		}
+		f.ServeHTTP(w, r)
+		if w.Code != test.Code {
+			t.Errorf("test %d: expecting response code %d, got %d", n+1, test.Code, w.Code)
+		} else if location := w.Header().Get("Location"); location != test.Location {
+			t.Errorf("test %d: expecting location %q, got %q", n+1, test.Location, location)
+		} else if vary := w.Header().Get("Vary"); vary != "User-Agent, Accept-Language, X-Beta" {
+			t.Errorf("test %d: unexpected Vary header: %q", n+1, vary)
+		}
+	}
+	for n, rules := range [...][]Rule{
+		{{URL: "http://www.example.com/"}},
+		{{Device: "tablet", URL: "http://www.example.com/"}},
+		{{Language: "not a language", URL: "http://www.example.com/"}},
+		{{Header: "X Beta", URL: "http://www.example.com/"}},
+		{{Value: "yes", URL: "http://www.example.com/"}},
+		{{Device: "ios", URL: "ftp://www.example.com/"}},
+		make([]Rule, maxRules+1),
+		func() []Rule {
+			rules := make([]Rule, maxRules)
+			for n := range rules {
+				rules[n] = Rule{Device: deviceIOS, URL: "http://www.example.com/" + strings.Repeat("a", maxURLLength-24)}
+			}
+			return rules
+		}(),
+	} {
+		if err := f.SetRules("AAA", rules); !errors.Is(err, ErrInvalidRules) {
+			t.Errorf("test %d: expecting error ErrInvalidRules, got %v", n+1, err)
+		}
+	}
+	if err := f.SetRules("BBB", []Rule{{Device: "ios", URL: "http://www.example.com/"}}); !errors.Is(err, ErrMissingKey) {
+		t.Errorf("expecting error ErrMissingKey, got %v", err)
+	}
+}
+
+func TestAdminRules(t *testing.T) {
+	f := New(URLValidator(HTTPURL))
+	post(f, "AAA", "http://www.example.com/")
+	admin := f.Admin()
+	for n, test := range [...]struct {
+		Method, Path, ContentType, Accept, Body string
+		Code                                    int
+		Response                                string
+	}{
+		{ // 1
+			Method:   http.MethodGet,
+			Path:     "/rules?key=AAA",
+			Code:     http.StatusOK,
+			Response: `[]`,
+		},
+		{ // 2
+			Method:      http.MethodPost,
+			Path:        "/rules?key=AAA",
+			ContentType: "application/json",
+			Body:        `[{"device":"mobile","url":"http://m.example.com/"}]`,
+			Code:        http.StatusNoContent,
+		},
+		{ // 3
+			Method:   http.MethodGet,
+			Path:     "/rules?key=AAA",
+			Code:     http.StatusOK,
+			Response: `[{"device":"mobile","url":"http://m.example.com/"}]`,
+		},
+		{ // 4
+			Method:      http.MethodPost,
+			Path:        "/rules?key=AAA",
+			ContentType: "text/xml",
+			Body:        `<rules><rule><language>de</language><url>http://www.example.de/</url></rule><rule><device>desktop</device><url>http://www.example.com/desktop</url></rule></rules>`,
+			Code:        http.StatusNoContent,
+		},
+		{ // 5
+			Method:   http.MethodGet,
+			Path:     "/rules?key=AAA",
+			Accept:   "text/xml",
+			Code:     http.StatusOK,
+			Response: `<rules><rule><language>de</language><url>http://www.example.de/</url></rule><rule><device>desktop</device><url>http://www.example.com/desktop</url></rule></rules>`,
+		},
+		{ // 6
+			Method:      http.MethodPost,
+			Path:        "/rules?key=AAA",
+			ContentType: "application/json",
+			Body:        `[{"url":"http://m.example.com/"}]`,
+			Code:        http.StatusBadRequest,
+		},
+		{ // 7
+			Method:      http.MethodPost,
+			Path:        "/rules?key=BBB",
+			ContentType: "application/json",
+			Body:        `[]`,
+			Code:        http.StatusNotFound,
+		},
+		{ // 8
+			Method: http.MethodGet,
+			Path:   "/rules?key=BBB",
+			Code:   http.StatusNotFound,
+		},
+		{ // 9
+			Method:      http.MethodPost,
+			Path:        "/rules?key=AAA",
+			ContentType: "text/plain",
+			Body:        `[]`,
+			Code:        http.StatusUnsupportedMediaType,
+		},
+		{ // 10
+			Method: http.MethodDelete,
+			Path:   "/rules?key=AAA",
+			Code:   http.StatusMethodNotAllowed,
+		},
+		{ // 11
+			Method:      http.MethodPost,
+			Path:        "/rules?key=AAA",
+			ContentType: "application/json",
+			Body:        `[]`,
+			Code:        http.StatusNoContent,
+		},
+		{ // 12
+			Method:   http.MethodGet,
+			Path:     "/rules?key=AAA",
+			Code:     http.StatusOK,
+			Response: `[]`,
+		},
+	} {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(test.Method, test.Path, strings.NewReader(test.Body))
+		if test.ContentType != "" {
+			r.Header.Set("Content-Type", test.ContentType)
+		}
+		if test.Accept != "" {
+			r.Header.Set("Accept", test.Accept)
+		}
+		admin.ServeHTTP(w, r)
+		if w.Code != test.Code {
+			t.Errorf("test %d: expecting response code %d, got %d", n+1, test.Code, w.Code)
+		} else if response := strings.TrimSpace(w.Body.String()); test.Response != "" && response != test.Response {
+			t.Errorf("test %d: expecting response %s, got %s", n+1, test.Response, response)
+		}
+	}
+	if meta, _ := getMeta(f.store, "AAA"); meta.Rules != nil {
+		t.Errorf("expecting rules to be removed, got %v", meta.Rules)
+	}
+}
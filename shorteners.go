@@ -0,0 +1,528 @@
+package furl
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// The ImportReport type is returned by the methods that import data from other
+// URL shorteners.
+//
+// Imported is the number of links that were added to the Store.
+//
+// Renamed lists the links that could not keep their original key, either
+// because the KeyValidator rejected it or because the key already existed in
+// the Store with a different URL. These links were stored with a newly
+// generated key.
+//
+// Invalid lists the original keys of links that were not imported as the
+// URLValidator rejected their URL.
+type ImportReport struct {
+	Imported int
+	Renamed  []Renamed
+	Invalid  []string
+}
+
+// The Renamed type records the original key of an imported link and the key it
+// was stored with.
+type Renamed struct {
+	Old, New string
+}
+
+var (
+	bitlyKeyColumns   = []string{"bitlink", "link", "short url", "short link", "shorturl", "id"}
+	bitlyURLColumns   = []string{"long url", "longurl", "destination", "destination url", "url"}
+	yourlsKeyColumns  = []string{"keyword"}
+	yourlsURLColumns  = []string{"url"}
+	yourlsSQLColumns  = []string{"keyword", "url", "title", "timestamp", "ip", "clicks"}
+	sqlStatements     = []string{"INSERT", "CREATE", "DROP", "SET", "LOCK", "USE", "BEGIN", "START"}
+	errMissingColumns = errors.New("could not find key and url columns")
+)
+
+// The ImportBitly method imports links from a bit.ly style CSV export.
+//
+// The CSV data must have a header line, from which the short link column
+// (bitlink, link, short_url, etc.) and the destination column (long_url,
+// destination, url, etc.) are determined. The key is taken from the final path
+// element of the short link.
+func (f *Furl) ImportBitly(r io.Reader) (*ImportReport, error) {
+	data, err := readShortenerCSV(r, bitlyKeyColumns, bitlyURLColumns)
+	if err != nil {
+		return nil, err
+	}
+
+	return f.importForeign(data)
+}
+
+// The ImportYOURLS method imports links from an export of the yourls_url table
+// of a YOURLS instance.
+//
+// The export may either be a CSV file, with a header line containing keyword
+// and url columns, or an SQL dump containing INSERT statements for the table.
+// The input is treated as an SQL dump when it starts, after any whitespace,
+// with an SQL comment or statement.
+func (f *Furl) ImportYOURLS(r io.Reader) (*ImportReport, error) {
+	var buf bytes.Buffer
+
+	if _, err := io.Copy(&buf, r); err != nil {
+		return nil, err
+	}
+
+	var (
+		data []keyURL
+		err  error
+	)
+
+	if isSQL(buf.Bytes()) {
+		data, err = readYOURLSSQL(buf.String())
+	} else {
+		data, err = readShortenerCSV(&buf, yourlsKeyColumns, yourlsURLColumns)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return f.importForeign(data)
+}
+
+type shlinkURL struct {
+	ShortCode string `json:"shortCode"`
+	LongURL   string `json:"longUrl"`
+}
+
+// The ImportShlink method imports links from a Shlink JSON export.
+//
+// The JSON may be either the response from the Shlink short-urls API, a list of
+// such responses, or a plain list of short URL objects; in each case the
+// shortCode and longUrl fields are used.
+func (f *Furl) ImportShlink(r io.Reader) (*ImportReport, error) {
+	var (
+		data []keyURL
+		d    = json.NewDecoder(r)
+	)
+
+	for {
+		var raw json.RawMessage
+
+		if err := d.Decode(&raw); errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		urls, err := readShlink(raw)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, u := range urls {
+			data = append(data, keyURL{Key: u.ShortCode, URL: u.LongURL})
+		}
+	}
+
+	return f.importForeign(data)
+}
+
+func readShlink(raw json.RawMessage) ([]shlinkURL, error) {
+	if raw = bytes.TrimSpace(raw); len(raw) > 0 && raw[0] == '[' {
+		var (
+			list []json.RawMessage
+			urls []shlinkURL
+		)
+
+		if err := json.Unmarshal(raw, &list); err != nil {
+			return nil, err
+		}
+
+		for _, r := range list {
+			u, err := readShlink(r)
+			if err != nil {
+				return nil, err
+			}
+
+			urls = append(urls, u...)
+		}
+
+		return urls, nil
+	}
+
+	var obj struct {
+		shlinkURL
+		ShortURLs *struct {
+			Data []shlinkURL `json:"data"`
+		} `json:"shortUrls"`
+		Data []shlinkURL `json:"data"`
+	}
+
+	if err := json.Unmarshal(raw, &obj); err != nil {
+		return nil, err
+	} else if obj.ShortCode != "" || obj.LongURL != "" {
+		return []shlinkURL{obj.shlinkURL}, nil
+	} else if obj.ShortURLs != nil {
+		return obj.ShortURLs.Data, nil
+	}
+
+	return obj.Data, nil
+}
+
+func (f *Furl) importForeign(data []keyURL) (*ImportReport, error) {
+	report := new(ImportReport)
+
+	for _, d := range data {
+		if !f.validURL(d.URL) {
+			report.Invalid = append(report.Invalid, d.Key)
+
+			continue
+		}
+
+		var set, exists bool
+
+		meta := &Meta{Created: f.now().UTC()}
+
+		if d.Key != "" && d.Key != "." && d.Key != ".." && f.validKey(d.Key) {
+			key, meta := f.canonical(d.Key, meta)
+
+			f.keyTx(actor{source: SourceImport}, key, func(tx Tx) {
+				if set = f.create(tx, key, d.URL); set {
+					setMeta(tx, key, meta)
+				}
+			})
+
+			if !set {
+				url, _ := f.store.Get(key)
+				exists = url == d.URL
+			}
+		}
+
+		if exists {
+			continue
+		} else if !set {
+			key, ok := f.generateKey(actor{source: SourceImport}, d.URL, meta)
+			if !ok {
+				return report, fmt.Errorf("key %s: %s", d.Key, failedKeyGeneration)
+			}
+
+			report.Renamed = append(report.Renamed, Renamed{Old: d.Key, New: key})
+		}
+
+		report.Imported++
+	}
+
+	return report, nil
+}
+
+func readShortenerCSV(r io.Reader, keyColumns, urlColumns []string) ([]keyURL, error) {
+	c := csv.NewReader(r)
+	c.FieldsPerRecord = -1
+
+	header, err := c.Read()
+	if err != nil {
+		return nil, err
+	}
+
+	keyCol, urlCol := findColumn(header, keyColumns), findColumn(header, urlColumns)
+	if keyCol == -1 || urlCol == -1 {
+		return nil, errMissingColumns
+	}
+
+	var data []keyURL
+
+	for {
+		record, err := c.Read()
+		if errors.Is(err, io.EOF) {
+			return data, nil
+		} else if err != nil {
+			return nil, err
+		} else if keyCol >= len(record) || urlCol >= len(record) {
+			line, _ := c.FieldPos(0)
+
+			return nil, fmt.Errorf("line %d: %w", line, csv.ErrFieldCount)
+		}
+
+		data = append(data, keyURL{Key: shortKey(record[keyCol]), URL: strings.TrimSpace(record[urlCol])})
+	}
+}
+
+func findColumn(header, names []string) int {
+	for _, name := range names {
+		for n, h := range header {
+			if strings.ToLower(strings.TrimSpace(strings.ReplaceAll(h, "_", " "))) == name {
+				return n
+			}
+		}
+	}
+
+	return -1
+}
+
+func shortKey(link string) string {
+	link = strings.TrimSpace(link)
+
+	if !strings.Contains(link, "://") && strings.Contains(link, "/") {
+		link = "//" + link
+	}
+
+	u, err := url.Parse(link)
+	if err != nil || u.Host == "" {
+		return link
+	}
+
+	return path.Base("/" + u.Path)
+}
+
+// isSQL determines whether the input starts with an SQL comment or one of the
+// statements that are found at the start of an SQL dump.
+func isSQL(input []byte) bool {
+	if len(input) > 64 {
+		input = input[:64]
+	}
+
+	p := sqlParser{data: string(input)}
+
+	p.space()
+
+	if p.keyword("--") || p.keyword("/*") || p.keyword("#") {
+		return true
+	}
+
+	for _, keyword := range sqlStatements {
+		if start := p.pos; p.keyword(keyword) {
+			if p.pos == len(p.data) || strings.IndexByte(" \t\r\n", p.data[p.pos]) != -1 {
+				return true
+			}
+
+			p.pos = start
+		}
+	}
+
+	return false
+}
+
+func readYOURLSSQL(dump string) ([]keyURL, error) {
+	var data []keyURL
+
+	p := sqlParser{data: dump}
+
+	for p.next("INSERT INTO") {
+		table := p.identifier()
+		if !strings.HasSuffix(table, "url") {
+			continue
+		}
+
+		columns := yourlsSQLColumns
+
+		p.space()
+
+		if p.accept('(') {
+			columns = nil
+
+			for {
+				p.space()
+
+				columns = append(columns, p.identifier())
+
+				p.space()
+
+				if p.accept(')') {
+					break
+				} else if !p.accept(',') {
+					return nil, p.error("invalid column list")
+				}
+			}
+		}
+
+		keyCol, urlCol := findColumn(columns, yourlsKeyColumns), findColumn(columns, yourlsURLColumns)
+		if keyCol == -1 || urlCol == -1 {
+			return nil, errMissingColumns
+		}
+
+		p.space()
+
+		if !p.keyword("VALUES") {
+			return nil, p.error("expecting VALUES")
+		}
+
+		for {
+			p.space()
+
+			if !p.accept('(') {
+				return nil, p.error("expecting (")
+			}
+
+			values, err := p.values()
+			if err != nil {
+				return nil, err
+			} else if keyCol >= len(values) || urlCol >= len(values) {
+				return nil, p.error("too few values")
+			}
+
+			data = append(data, keyURL{Key: values[keyCol], URL: values[urlCol]})
+
+			p.space()
+
+			if !p.accept(',') {
+				break
+			}
+		}
+	}
+
+	return data, nil
+}
+
+type sqlParser struct {
+	data string
+	pos  int
+}
+
+func (s *sqlParser) error(msg string) error {
+	return fmt.Errorf("sql offset %d: %s", s.pos, msg)
+}
+
+// next advances past the next occurrence of the keyword, which must be upper
+// case, matched without regard to ASCII case.
+func (s *sqlParser) next(keyword string) bool {
+	for ; len(s.data)-s.pos >= len(keyword); s.pos++ {
+		if s.keyword(keyword) {
+			return true
+		}
+	}
+
+	s.pos = len(s.data)
+
+	return false
+}
+
+func (s *sqlParser) space() {
+	for s.pos < len(s.data) && strings.IndexByte(" \t\r\n", s.data[s.pos]) != -1 {
+		s.pos++
+	}
+}
+
+func (s *sqlParser) accept(c byte) bool {
+	if s.pos < len(s.data) && s.data[s.pos] == c {
+		s.pos++
+
+		return true
+	}
+
+	return false
+}
+
+// keyword advances past the keyword, which must be upper case, if it is next
+// in the data, matched without regard to ASCII case.
+func (s *sqlParser) keyword(keyword string) bool {
+	if len(s.data)-s.pos < len(keyword) {
+		return false
+	}
+
+	for n := 0; n < len(keyword); n++ {
+		if c := s.data[s.pos+n]; c != keyword[n] && (c < 'a' || c > 'z' || c-'a'+'A' != keyword[n]) {
+			return false
+		}
+	}
+
+	s.pos += len(keyword)
+
+	return true
+}
+
+func (s *sqlParser) identifier() string {
+	s.space()
+
+	var name string
+
+	for {
+		if s.accept('`') {
+			end := strings.IndexByte(s.data[s.pos:], '`')
+			if end == -1 {
+				end = len(s.data) - s.pos
+			}
+
+			name = s.data[s.pos : s.pos+end]
+			s.pos += end + 1
+		} else {
+			start := s.pos
+
+			for s.pos < len(s.data) && strings.IndexByte(" \t\r\n(),;.`", s.data[s.pos]) == -1 {
+				s.pos++
+			}
+
+			name = s.data[start:s.pos]
+		}
+
+		if !s.accept('.') {
+			return name
+		}
+	}
+}
+
+func (s *sqlParser) values() ([]string, error) {
+	var values []string
+
+	for {
+		s.space()
+
+		if s.accept('\'') {
+			var sb strings.Builder
+
+			for {
+				if s.pos >= len(s.data) {
+					return nil, s.error("unterminated string")
+				}
+
+				c := s.data[s.pos]
+				s.pos++
+
+				if c == '\\' && s.pos < len(s.data) {
+					c = s.data[s.pos]
+					s.pos++
+
+					switch c {
+					case '0':
+						c = 0
+					case 'n':
+						c = '\n'
+					case 'r':
+						c = '\r'
+					case 't':
+						c = '\t'
+					case 'Z':
+						c = 26
+					}
+				} else if c == '\'' {
+					if !s.accept('\'') {
+						break
+					}
+				}
+
+				sb.WriteByte(c)
+			}
+
+			values = append(values, sb.String())
+		} else {
+			start := s.pos
+
+			for s.pos < len(s.data) && s.data[s.pos] != ',' && s.data[s.pos] != ')' {
+				s.pos++
+			}
+
+			values = append(values, strings.TrimSpace(s.data[start:s.pos]))
+		}
+
+		s.space()
+
+		if s.accept(')') {
+			return values, nil
+		} else if !s.accept(',') {
+			return nil, s.error("invalid value list")
+		}
+	}
+}
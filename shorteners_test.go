@@ -0,0 +1,92 @@
+package furl
+
+import (
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func testForeignImport(t *testing.T, name string, fn func(*Furl, io.Reader) (*ImportReport, error), input string, expected ImportReport, urls map[string]string) {
+	t.Helper()
+	rs := nonrand{0, 1}
+	s := NewStore(Data(map[string]string{
+		"exists": "http://www.example.com/exists",
+		"taken":  "http://www.example.com/taken",
+	}))
+	report, err := fn(New(SetStore(s), RandomSource(&rs), KeyLength(1), URLValidator(HTTPURL), KeyValidator(func(key string) bool {
+		return key != "bad"
+	})), strings.NewReader(input))
+	if err != nil {
+		t.Errorf("%s: unexpected error: %s", name, err)
+		return
+	} else if !reflect.DeepEqual(*report, expected) {
+		t.Errorf("%s: expecting report %v, got %v", name, expected, *report)
+	}
+	for key, url := range urls {
+		if got, _ := s.Get(key); got != url {
+			t.Errorf("%s: expecting key %q to have url %q, got %q", name, key, url, got)
+		}
+	}
+}
+
+var foreignReport = ImportReport{
+	Imported: 4,
+	Renamed: []Renamed{
+		{Old: "bad", New: "AA"},
+		{Old: "taken", New: "AQ"},
+	},
+	Invalid: []string{"ftp"},
+}
+
+var foreignURLs = map[string]string{
+	"abc":    "http://www.example.com/abc",
+	"def":    "https://www.example.com/def?a=b",
+	"AA":     "http://www.example.com/bad",
+	"AQ":     "http://www.example.com/other",
+	"exists": "http://www.example.com/exists",
+	"taken":  "http://www.example.com/taken",
+}
+
+func TestImportBitly(t *testing.T) {
+	testForeignImport(t, "bitly", (*Furl).ImportBitly, `Title,Bitlink,Long URL,Created
+ABC,https://bit.ly/abc,http://www.example.com/abc,2020-01-01
+DEF,bit.ly/def,"https://www.example.com/def?a=b",2020-01-02
+Bad,bit.ly/bad,http://www.example.com/bad,2020-01-03
+Exists,bit.ly/exists,http://www.example.com/exists,2020-01-04
+Taken,bit.ly/taken,http://www.example.com/other,2020-01-05
+FTP,bit.ly/ftp,ftp://www.example.com/,2020-01-06
+`, foreignReport, foreignURLs)
+}
+
+func TestImportYOURLSCSV(t *testing.T) {
+	testForeignImport(t, "yourls csv", (*Furl).ImportYOURLS, `"keyword","url","title","timestamp","ip","clicks"
+"abc","http://www.example.com/abc","INSERT INTO ABC","2020-01-01 00:00:00","127.0.0.1","1"
+"def","https://www.example.com/def?a=b","DEF","2020-01-01 00:00:00","127.0.0.1","2"
+"bad","http://www.example.com/bad","Bad","2020-01-01 00:00:00","127.0.0.1","3"
+"exists","http://www.example.com/exists","Exists","2020-01-01 00:00:00","127.0.0.1","4"
+"taken","http://www.example.com/other","Taken","2020-01-01 00:00:00","127.0.0.1","5"
+"ftp","ftp://www.example.com/","FTP","2020-01-01 00:00:00","127.0.0.1","6"
+`, foreignReport, foreignURLs)
+}
+
+func TestImportYOURLSSQL(t *testing.T) {
+	testForeignImport(t, "yourls sql", (*Furl).ImportYOURLS, "-- MySQL dump\n"+
+		"INSERT INTO `yourls_options` VALUES (1,'version','1.9');\n"+
+		"INSERT INTO `yourls_options` VALUES (2,'ſſſſſſſſ','ﬃﬃﬃﬃ');\n"+
+		"INSERT INTO `yourls`.`yourls_url` (`keyword`, `url`, `title`, `timestamp`, `ip`, `clicks`) VALUES ('abc','http://www.example.com/abc','It\\'s ABC','2020-01-01 00:00:00','127.0.0.1',1),\n"+
+		"('def','https://www.example.com/def?a=b','D,E)F','2020-01-01 00:00:00','127.0.0.1',2);\n"+
+		"insert into yourls_url values ('bad','http://www.example.com/bad','Bad','2020-01-01 00:00:00','127.0.0.1',3),('exists','http://www.example.com/exists','','2020-01-01 00:00:00','127.0.0.1',4);\n"+
+		"INSERT INTO `yourls_url` (`url`, `keyword`) VALUES ('http://www.example.com/other', 'taken'), ('ftp://www.example.com/', 'ftp');\n",
+		foreignReport, foreignURLs)
+}
+
+func TestImportShlink(t *testing.T) {
+	testForeignImport(t, "shlink", (*Furl).ImportShlink, `{"shortUrls":{"data":[
+	{"shortCode":"abc","shortUrl":"https://s.test/abc","longUrl":"http://www.example.com/abc","visitsCount":1},
+	{"shortCode":"def","shortUrl":"https://s.test/def","longUrl":"https://www.example.com/def?a=b","visitsCount":2}
+],"pagination":{"currentPage":1,"pagesCount":2}}}
+[{"shortCode":"bad","longUrl":"http://www.example.com/bad"},{"shortCode":"exists","longUrl":"http://www.example.com/exists"}]
+[{"shortUrls":{"data":[{"shortCode":"taken","longUrl":"http://www.example.com/other"},{"shortCode":"ftp","longUrl":"ftp://www.example.com/"}]}}]
+`, foreignReport, foreignURLs)
+}
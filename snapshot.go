@@ -0,0 +1,50 @@
+package furl
+
+import (
+	"errors"
+	"io"
+)
+
+// The Snapshot method writes a consistent, point-in-time image of the Store to
+// the Writer, using the JSONLines Format. Writes to the Store can continue
+// while the snapshot is being written.
+//
+// The Store must implement the Snapshotter interface, otherwise
+// ErrSnapshotUnsupported will be returned.
+func (f *Furl) Snapshot(w io.Writer) error {
+	s, ok := f.store.(Snapshotter)
+	if !ok {
+		return ErrSnapshotUnsupported
+	}
+
+	return ExportWithPasswords(w, s.Snapshot(), JSONLines)
+}
+
+// The ReadSnapshot function reads a snapshot, as written by the Snapshot
+// method, and returns the key:url map and the key:Meta map, which can be used
+// with the Data and MetaData StoreOptions to start a Furl instance from the
+// snapshot.
+//
+// NB: Neither the keys, URLs, or Meta are checked to be valid.
+func ReadSnapshot(r io.Reader) (map[string]string, map[string]Meta, error) {
+	records, err := readJSONLines(r)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	data := make(map[string]string, len(records))
+	meta := make(map[string]Meta)
+
+	for _, ku := range records {
+		data[ku.Key] = ku.URL
+
+		if ku.Meta != nil {
+			meta[ku.Key] = *ku.Meta
+		}
+	}
+
+	return data, meta, nil
+}
+
+// Errors.
+var ErrSnapshotUnsupported = errors.New("store does not support snapshots")
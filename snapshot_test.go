@@ -0,0 +1,62 @@
+package furl
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type noSnapshotStore struct {
+	Store
+}
+
+func TestSnapshot(t *testing.T) {
+	data := map[string]string{
+		"AAA": "http://www.google.com",
+		"BBB": "http://www.example.com",
+	}
+	for n, s := range [...]Store{
+		NewStore(Data(map[string]string{
+			"AAA": "http://www.google.com",
+			"BBB": "http://www.example.com",
+		})),
+		NewShardedStore(2, Data(map[string]string{
+			"AAA": "http://www.google.com",
+			"BBB": "http://www.example.com",
+		})),
+	} {
+		snap := s.(Snapshotter).Snapshot()
+		s.Tx(func(tx Tx) {
+			tx.Set("CCC", "http://www.example.com/C")
+		})
+		var sb strings.Builder
+		if err := Export(&sb, snap, JSONLines); err != nil {
+			t.Errorf("test %d: unexpected error: %s", n+1, err)
+		} else if restored, _, err := ReadSnapshot(strings.NewReader(sb.String())); err != nil {
+			t.Errorf("test %d: unexpected error restoring: %s", n+1, err)
+		} else if !reflect.DeepEqual(restored, data) {
+			t.Errorf("test %d: expecting snapshot %v, got %v", n+1, data, restored)
+		}
+		w := httptest.NewRecorder()
+		New(SetStore(s)).Admin().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/snapshot", nil))
+		if w.Code != http.StatusOK {
+			t.Errorf("test %d: expecting response code 200, got %d", n+1, w.Code)
+		} else if restored, _, err := ReadSnapshot(w.Body); err != nil {
+			t.Errorf("test %d: unexpected error restoring: %s", n+1, err)
+		} else if len(restored) != 3 || restored["CCC"] != "http://www.example.com/C" {
+			t.Errorf("test %d: expecting snapshot to contain new key, got %v", n+1, restored)
+		}
+	}
+	w := httptest.NewRecorder()
+	New(SetStore(noSnapshotStore{NewStore()})).Admin().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/snapshot", nil))
+	if w.Code != http.StatusNotImplemented {
+		t.Errorf("expecting response code 501, got %d", w.Code)
+	}
+	w = httptest.NewRecorder()
+	New().Admin().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/snapshot", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expecting response code 405, got %d", w.Code)
+	}
+}
@@ -1,6 +1,14 @@
 package furl
 
-import "sync"
+import (
+	"hash/maphash"
+	"sync"
+)
+
+const (
+	defaultShards = 32
+	maxHistory    = 100
+)
 
 // The Store interface allows for setting a custom storage solution to Furl,
 // such as a database or keystore.
@@ -23,12 +31,128 @@ type Store interface {
 // The Set method will be called at most one time per Store.Tx call, and will
 // be used to set the uniquely generated or passed key and its corresponding
 // URL. The implementation of this method can be used to provide a more
-// permanent storage for the key:url store.
+// permanent storage for the key:url store. The methods of the optional
+// extensions to the Tx interface, such as MetaTx and DeleteTx, may also be
+// called in the same Store.Tx call, but only for that same key.
 type Tx interface {
 	Has(key string) bool
 	Set(key, url string)
 }
 
+// The CreateTx interface is an optional extension to the Tx interface that
+// allows a Tx to atomically set a key only if it does not already exist, which
+// is useful for Stores that cannot otherwise protect a key between calls to
+// Has and Set, such as those backed by an external database.
+//
+// The Create method should set the key to the URL and return true if the key
+// does not exist, and should return false, leaving the existing URL unchanged,
+// if it does.
+//
+// When a Tx implements this interface, Furl will use the Create method instead
+// of calling Has followed by Set.
+type CreateTx interface {
+	Tx
+	Create(key, url string) bool
+}
+
+func create(tx Tx, key, url string) bool {
+	if c, ok := tx.(CreateTx); ok {
+		return c.Create(key, url)
+	} else if tx.Has(key) {
+		return false
+	}
+	tx.Set(key, url)
+	return true
+}
+
+// The DeleteTx interface is an optional extension to the Tx interface that
+// allows a key to be removed from the Store.
+//
+// The Delete method should remove the key, along with its URL, Meta, and any
+// history, so that the key no longer exists.
+type DeleteTx interface {
+	Tx
+	Delete(key string)
+}
+
+func deleteKey(tx Tx, key string) bool {
+	if d, ok := tx.(DeleteTx); ok {
+		d.Delete(key)
+		return true
+	}
+	return false
+}
+
+// The KeyTxStore interface is an optional extension to the Store interface
+// that allows a Store to provide a writing context that only needs to protect
+// a single key.
+//
+// When a Store implements this interface, Furl will use the KeyTx method
+// instead of the Tx method, calling it separately for each key that it needs
+// to check and set. This allows a Store to lock only the part of the store
+// that the key resides in, instead of the entire store.
+//
+// The Tx passed to the function should only be used with the key passed to the
+// KeyTx method.
+type KeyTxStore interface {
+	Store
+	KeyTx(key string, fn func(tx Tx))
+}
+
+// The Ranger interface is an optional extension to the Store interface that
+// allows all of the keys and URLs held in a Store to be iterated over.
+//
+// The Range method should call the passed function for each key:url pair,
+// stopping when the function returns false.
+type Ranger interface {
+	Range(fn func(key, url string) bool)
+}
+
+// The Snapshotter interface is an optional extension to the Store interface
+// that allows a Store to produce a consistent, point-in-time copy of its data.
+//
+// The Snapshot method should return a Ranger over the key:url pairs as they
+// were at the time of the call, unaffected by any later writes to the Store.
+type Snapshotter interface {
+	Snapshot() Ranger
+}
+
+type snapshot struct {
+	urls map[string]string
+	meta map[string]Meta
+}
+
+func newSnapshot(size int) snapshot {
+	return snapshot{
+		urls: make(map[string]string, size),
+		meta: make(map[string]Meta),
+	}
+}
+
+func (s snapshot) Range(fn func(key, url string) bool) {
+	for key, url := range s.urls {
+		if !fn(key, url) {
+			return
+		}
+	}
+}
+
+func (s snapshot) RangeMeta(fn func(key, url string, meta Meta) bool) {
+	for key, url := range s.urls {
+		if !fn(key, url, s.meta[key]) {
+			return
+		}
+	}
+}
+
+func keyTx(s Store, key string, fn func(tx Tx)) {
+	if ks, ok := s.(KeyTxStore); ok {
+		ks.KeyTx(key, fn)
+	} else {
+		s.Tx(fn)
+	}
+}
+
 // The StoreOption type is used to specify optional params to the NewStore
 // function call.
 type StoreOption func(*mapStore)
@@ -44,6 +168,25 @@ func Data(data map[string]string) StoreOption {
 	}
 }
 
+// The MetaData StoreOption is used to set the initial map of keys -> Meta. As
+// with the Data StoreOption, the passed map should not be accessed by anything
+// other than Furl until Furl is no longer in use.
+func MetaData(meta map[string]Meta) StoreOption {
+	return func(m *mapStore) {
+		m.meta = meta
+	}
+}
+
+// The HistoryData StoreOption is used to set the initial map of keys -> their
+// previous revisions, oldest first, not including the current URL and Meta. As
+// with the Data StoreOption, the passed map should not be accessed by anything
+// other than Furl until Furl is no longer in use.
+func HistoryData(history map[string][]Revision) StoreOption {
+	return func(m *mapStore) {
+		m.history = history
+	}
+}
+
 // The Save StoreOption is used to set a function that stores the keys and urls
 // outside of Furl. For example, could be used to write to a file that be later
 // loaded to provide the data for a future instance of Furl.
@@ -53,19 +196,56 @@ func Save(save func(key, url string)) StoreOption {
 	}
 }
 
+// The SaveMeta StoreOption is used to set a function that stores the Meta for
+// each key outside of Furl, in the same way as the Save StoreOption.
+//
+// The function will be called after the function set by the Save StoreOption
+// has been called with the key. When a key is set without Meta, only the Save
+// function will be called and any previously saved Meta should be discarded.
+func SaveMeta(save func(key string, meta Meta)) StoreOption {
+	return func(m *mapStore) {
+		m.saveMeta = save
+	}
+}
+
+// The SaveDelete StoreOption is used to set a function that records the
+// removal of a key outside of Furl, in the same way as the Save StoreOption.
+func SaveDelete(save func(key string)) StoreOption {
+	return func(m *mapStore) {
+		m.saveDelete = save
+	}
+}
+
 func noSave(_, _ string) {}
 
-// NewStore creates a map based implementation of the Store interface, with the
-// following defaults that can be changed by adding StoreOption params:
+func noSaveMeta(_ string, _ Meta) {}
+
+func noSaveDelete(_ string) {}
+
+// NewStore creates a map based implementation of the Store interface, which
+// also implements the MetaStore, MetaRanger, HistoryStore and Snapshotter
+// interfaces, with the following defaults that can be changed by adding
+// StoreOption params:
 //
 // urls: By default, the Store is created with an empty map. This can be changed
 // with the Data StoreOption.
 //
+// meta: By default, the Store is created with no Meta. This can be changed
+// with the MetaData StoreOption.
+//
+// history: By default, the Store is created with no previous revisions. This
+// can be changed with the HistoryData StoreOption. Only the most recent 100
+// previous revisions of each key are kept.
+//
 // save: By default, there is no permanent storage of the key:url map. This can
-// be changed by the Save StoreOption.
+// be changed by the Save, SaveMeta, and SaveDelete StoreOptions.
+//
+// The Tx of the Store implements the MetaTx and DeleteTx interfaces.
 func NewStore(opts ...StoreOption) Store {
 	m := &mapStore{
-		save: noSave,
+		save:       noSave,
+		saveMeta:   noSaveMeta,
+		saveDelete: noSaveDelete,
 	}
 	for _, o := range opts {
 		o(m)
@@ -73,13 +253,32 @@ func NewStore(opts ...StoreOption) Store {
 	if m.urls == nil {
 		m.urls = make(map[string]string)
 	}
+	if m.meta == nil {
+		m.meta = make(map[string]Meta)
+	}
+	if m.history == nil {
+		m.history = make(map[string][]Revision)
+	}
 	return m
 }
 
 type mapStore struct {
-	mu   sync.RWMutex
-	urls map[string]string
-	save func(string, string)
+	mu         sync.RWMutex
+	urls       map[string]string
+	meta       map[string]Meta
+	history    map[string][]Revision
+	save       func(string, string)
+	saveMeta   func(string, Meta)
+	saveDelete func(string)
+}
+
+type mapTx struct {
+	*mapStore
+}
+
+func (m mapTx) GetMeta(key string) (Meta, bool) {
+	meta, ok := m.meta[key]
+	return meta, ok
 }
 
 func (m *mapStore) Get(key string) (string, bool) {
@@ -91,8 +290,8 @@ func (m *mapStore) Get(key string) (string, bool) {
 
 func (m *mapStore) Tx(fn func(tx Tx)) {
 	m.mu.Lock()
-	fn(m)
-	m.mu.Unlock()
+	defer m.mu.Unlock()
+	fn(mapTx{m})
 }
 
 func (m *mapStore) Has(key string) bool {
@@ -101,6 +300,239 @@ func (m *mapStore) Has(key string) bool {
 }
 
 func (m *mapStore) Set(key, url string) {
+	if old, ok := m.urls[key]; ok {
+		history := append(m.history[key], Revision{URL: old, Meta: m.meta[key]})
+		if len(history) > maxHistory {
+			history = append(history[:0:0], history[len(history)-maxHistory:]...)
+		}
+		m.history[key] = history
+	}
 	m.urls[key] = url
+	delete(m.meta, key)
 	m.save(key, url)
 }
+
+func (m *mapStore) Delete(key string) {
+	delete(m.urls, key)
+	delete(m.meta, key)
+	delete(m.history, key)
+	m.saveDelete(key)
+}
+
+func (m *mapStore) History(key string) []Revision {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	url, ok := m.urls[key]
+	if !ok {
+		return nil
+	}
+	return append(append(make([]Revision, 0, len(m.history[key])+1), m.history[key]...), Revision{URL: url, Meta: m.meta[key]})
+}
+
+func (m *mapStore) GetMeta(key string) (Meta, bool) {
+	m.mu.RLock()
+	meta, ok := m.meta[key]
+	m.mu.RUnlock()
+	return meta, ok
+}
+
+func (m *mapStore) SetMeta(key string, meta Meta) {
+	m.meta[key] = meta
+	m.saveMeta(key, meta)
+}
+
+func (m *mapStore) Range(fn func(key, url string) bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for key, url := range m.urls {
+		if !fn(key, url) {
+			return
+		}
+	}
+}
+
+func (m *mapStore) RangeMeta(fn func(key, url string, meta Meta) bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for key, url := range m.urls {
+		if !fn(key, url, m.meta[key]) {
+			return
+		}
+	}
+}
+
+func (m *mapStore) Snapshot() Ranger {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.copy(newSnapshot(len(m.urls)))
+}
+
+func (m *mapStore) copy(s snapshot) snapshot {
+	for key, url := range m.urls {
+		s.urls[key] = url
+	}
+	for key, meta := range m.meta {
+		s.meta[key] = meta
+	}
+	return s
+}
+
+// NewShardedStore creates a map based implementation of the Store interface
+// that distributes keys between a number of independently locked maps,
+// reducing lock contention when under heavy load. The sharded store
+// implements the KeyTxStore, MetaStore, MetaRanger, HistoryStore, and
+// Snapshotter interfaces, and its Tx implements the MetaTx and DeleteTx
+// interfaces.
+//
+// The shards param determines the number of maps the keys are distributed
+// between; a value of zero will use the default of 32 shards.
+//
+// The StoreOptions are the same as those used with the NewStore function.
+//
+// NB: Calls to the function set with the Save StoreOption will not be made
+// concurrently.
+func NewShardedStore(shards uint, opts ...StoreOption) Store {
+	if shards == 0 {
+		shards = defaultShards
+	}
+
+	m := &mapStore{
+		save:       noSave,
+		saveMeta:   noSaveMeta,
+		saveDelete: noSaveDelete,
+	}
+	for _, o := range opts {
+		o(m)
+	}
+
+	s := &shardedStore{
+		seed:   maphash.MakeSeed(),
+		shards: make([]mapStore, shards),
+	}
+	save, saveMeta, saveDelete := m.save, m.saveMeta, m.saveDelete
+	for n := range s.shards {
+		s.shards[n].urls = make(map[string]string)
+		s.shards[n].meta = make(map[string]Meta)
+		s.shards[n].history = make(map[string][]Revision)
+		s.shards[n].save = func(key, url string) {
+			s.saveMu.Lock()
+			defer s.saveMu.Unlock()
+			save(key, url)
+		}
+		s.shards[n].saveMeta = func(key string, meta Meta) {
+			s.saveMu.Lock()
+			defer s.saveMu.Unlock()
+			saveMeta(key, meta)
+		}
+		s.shards[n].saveDelete = func(key string) {
+			s.saveMu.Lock()
+			defer s.saveMu.Unlock()
+			saveDelete(key)
+		}
+	}
+	for key, url := range m.urls {
+		s.shard(key).urls[key] = url
+	}
+	for key, meta := range m.meta {
+		s.shard(key).meta[key] = meta
+	}
+	for key, history := range m.history {
+		s.shard(key).history[key] = history
+	}
+	return s
+}
+
+type shardedStore struct {
+	seed   maphash.Seed
+	shards []mapStore
+	saveMu sync.Mutex
+}
+
+type shardedTx struct {
+	*shardedStore
+}
+
+func (s shardedTx) GetMeta(key string) (Meta, bool) {
+	return mapTx{s.shard(key)}.GetMeta(key)
+}
+
+func (s *shardedStore) shard(key string) *mapStore {
+	return &s.shards[maphash.String(s.seed, key)%uint64(len(s.shards))]
+}
+
+func (s *shardedStore) Get(key string) (string, bool) {
+	return s.shard(key).Get(key)
+}
+
+func (s *shardedStore) Tx(fn func(tx Tx)) {
+	for n := range s.shards {
+		s.shards[n].mu.Lock()
+	}
+	defer func() {
+		for n := range s.shards {
+			s.shards[n].mu.Unlock()
+		}
+	}()
+	fn(shardedTx{s})
+}
+
+func (s *shardedStore) KeyTx(key string, fn func(tx Tx)) {
+	s.shard(key).Tx(fn)
+}
+
+func (s *shardedStore) Has(key string) bool {
+	return s.shard(key).Has(key)
+}
+
+func (s *shardedStore) Set(key, url string) {
+	s.shard(key).Set(key, url)
+}
+
+func (s *shardedStore) Delete(key string) {
+	s.shard(key).Delete(key)
+}
+
+func (s *shardedStore) GetMeta(key string) (Meta, bool) {
+	return s.shard(key).GetMeta(key)
+}
+
+func (s *shardedStore) SetMeta(key string, meta Meta) {
+	s.shard(key).SetMeta(key, meta)
+}
+
+func (s *shardedStore) History(key string) []Revision {
+	return s.shard(key).History(key)
+}
+
+func (s *shardedStore) Range(fn func(key, url string) bool) {
+	s.RangeMeta(func(key, url string, _ Meta) bool {
+		return fn(key, url)
+	})
+}
+
+func (s *shardedStore) RangeMeta(fn func(key, url string, meta Meta) bool) {
+	for n := range s.shards {
+		cont := true
+		s.shards[n].RangeMeta(func(key, url string, meta Meta) bool {
+			cont = fn(key, url, meta)
+			return cont
+		})
+		if !cont {
+			return
+		}
+	}
+}
+
+func (s *shardedStore) Snapshot() Ranger {
+	var size int
+	for n := range s.shards {
+		s.shards[n].mu.RLock()
+		size += len(s.shards[n].urls)
+	}
+	snap := newSnapshot(size)
+	for n := range s.shards {
+		s.shards[n].copy(snap)
+		s.shards[n].mu.RUnlock()
+	}
+	return snap
+}
@@ -0,0 +1,109 @@
+package furl
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestShardedStore(t *testing.T) {
+	saved := make(map[string]string)
+	s := NewShardedStore(4, Data(map[string]string{
+		"AAA": "http://www.google.com",
+		"BBB": "http://www.example.com",
+	}), Save(func(key, url string) {
+		saved[key] = url
+	}))
+	if _, ok := s.(KeyTxStore); !ok {
+		t.Fatal("expecting sharded store to implement KeyTxStore")
+	}
+	for n, test := range [...]struct {
+		Key, URL string
+		Found    bool
+	}{
+		{Key: "AAA", URL: "http://www.google.com", Found: true},
+		{Key: "BBB", URL: "http://www.example.com", Found: true},
+		{Key: "CCC"},
+	} {
+		if url, ok := s.Get(test.Key); ok != test.Found {
+			t.Errorf("test %d: expecting found to be %v, got %v", n+1, test.Found, ok)
+		} else if url != test.URL {
+			t.Errorf("test %d: expecting url %q, got %q", n+1, test.URL, url)
+		}
+	}
+	f := New(SetStore(s))
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			r := httptest.NewRequest(http.MethodPost, "/key"+strconv.Itoa(i), strings.NewReader("http://www.example.com/"+strconv.Itoa(i)))
+			r.Header.Set("Content-Type", "text/plain")
+			f.ServeHTTP(httptest.NewRecorder(), r)
+			r = httptest.NewRequest(http.MethodPost, "/", strings.NewReader("http://www.example.com/generated"))
+			r.Header.Set("Content-Type", "text/plain")
+			f.ServeHTTP(httptest.NewRecorder(), r)
+		}(i)
+	}
+	wg.Wait()
+	if len(saved) != 200 {
+		t.Errorf("expecting 200 saved keys, got %d", len(saved))
+	}
+	for i := 0; i < 100; i++ {
+		key := "key" + strconv.Itoa(i)
+		if url, _ := s.Get(key); url != "http://www.example.com/"+strconv.Itoa(i) {
+			t.Errorf("expecting key %q to have url %q, got %q", key, "http://www.example.com/"+strconv.Itoa(i), url)
+		}
+	}
+	s.Tx(func(tx Tx) {
+		if !tx.Has("AAA") {
+			t.Error("expecting Tx to find key AAA")
+		}
+		tx.Set("DDD", "http://www.example.com/DDD")
+	})
+	if url, _ := s.Get("DDD"); url != "http://www.example.com/DDD" {
+		t.Errorf("expecting key %q to have url %q, got %q", "DDD", "http://www.example.com/DDD", url)
+	}
+}
+
+func slowKeyValidator(key string) bool {
+	for i := 0; i < 1000; i++ {
+		key = strings.ToLower(key)
+	}
+	return key != ""
+}
+
+func benchmarkStore(b *testing.B, s Store) {
+	f := New(SetStore(s), KeyValidator(slowKeyValidator))
+	for i := 0; i < 1000; i++ {
+		s.Tx(func(tx Tx) {
+			tx.Set("key"+strconv.Itoa(i), "http://www.example.com/")
+		})
+	}
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		var i int
+		for pb.Next() {
+			var r *http.Request
+			if i%10 == 0 {
+				r = httptest.NewRequest(http.MethodPost, "/", strings.NewReader("http://www.example.com/"))
+				r.Header.Set("Content-Type", "text/plain")
+			} else {
+				r = httptest.NewRequest(http.MethodGet, "/key"+strconv.Itoa(i%1000), nil)
+			}
+			f.ServeHTTP(httptest.NewRecorder(), r)
+			i++
+		}
+	})
+}
+
+func BenchmarkMapStore(b *testing.B) {
+	benchmarkStore(b, NewStore())
+}
+
+func BenchmarkShardedStore(b *testing.B) {
+	benchmarkStore(b, NewShardedStore(0))
+}
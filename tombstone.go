@@ -0,0 +1,144 @@
+package furl
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+const (
+	gone       = "410 gone"
+	notDeleted = "key not deleted"
+)
+
+func (f *Furl) gone(w http.ResponseWriter, r *http.Request, key string) bool {
+	if meta, _ := getMeta(f.store, key); meta.Deleted == nil {
+		return false
+	} else if f.index != nil {
+		f.index(w, r, http.StatusGone, gone)
+	} else {
+		http.Error(w, gone, http.StatusGone)
+	}
+
+	return true
+}
+
+// create sets the key to the URL if the key does not exist, or if it has been
+// deleted and its quarantine has passed, in which case the tombstone and its
+// history are first removed.
+func (f *Furl) create(tx Tx, key, url string) bool {
+	if create(tx, key, url) {
+		return true
+	} else if meta, _ := getMeta(tx, key); !f.reusable(meta) {
+		return false
+	}
+
+	deleteKey(tx, key)
+	tx.Set(key, url)
+
+	return true
+}
+
+func (f *Furl) reusable(meta Meta) bool {
+	return meta.Deleted != nil && f.quarantine > 0 && !f.now().Before(meta.Deleted.Add(f.quarantine))
+}
+
+// The Delete method marks a key as deleted, leaving a tombstone that causes
+// GET requests for the key to respond with 410 Gone.
+//
+// The key will not be reused, either as a generated key or a suggested key,
+// until the period set by the Quarantine Option has passed, or the tombstone
+// is removed with the Purge method. A deleted key can be reinstated with the
+// Restore method.
+//
+// The Store must implement the MetaStore interface, otherwise
+// ErrDeleteUnsupported will be returned.
+func (f *Furl) Delete(key string) error {
+	return f.tombstone(actor{source: SourceAdmin}, key)
+}
+
+func (f *Furl) tombstone(a actor, key string) error {
+	var err error
+
+	key = f.canonicalise(key)
+
+	f.keyTx(a, key, func(tx Tx) {
+		meta, _ := getMeta(tx, key)
+		if !tx.Has(key) || meta.Deleted != nil {
+			err = fmt.Errorf("key %s: %w", key, ErrMissingKey)
+
+			return
+		}
+
+		now := f.now().UTC()
+		meta.Deleted = &now
+
+		setMeta(tx, key, &meta)
+
+		if meta, _ = getMeta(tx, key); meta.Deleted == nil {
+			err = ErrDeleteUnsupported
+		}
+	})
+
+	return err
+}
+
+// The Restore method removes the tombstone from a deleted key, reinstating
+// its link.
+func (f *Furl) Restore(key string) error {
+	return f.restore(actor{source: SourceAdmin}, key)
+}
+
+func (f *Furl) restore(a actor, key string) error {
+	var err error
+
+	key = f.canonicalise(key)
+
+	f.keyTx(a, key, func(tx Tx) {
+		if meta, _ := getMeta(tx, key); !tx.Has(key) {
+			err = fmt.Errorf("key %s: %w", key, ErrMissingKey)
+		} else if meta.Deleted == nil {
+			err = fmt.Errorf("key %s: %w", key, ErrNotDeleted)
+		} else {
+			meta.Deleted = nil
+
+			setMeta(tx, key, &meta)
+		}
+	})
+
+	return err
+}
+
+// The Purge method removes a deleted key, along with its tombstone and any
+// history, making the key immediately available for reuse.
+//
+// The Tx of the Store must implement the DeleteTx interface, otherwise
+// ErrDeleteUnsupported will be returned.
+func (f *Furl) Purge(key string) error {
+	return f.purge(actor{source: SourceAdmin}, key)
+}
+
+func (f *Furl) purge(a actor, key string) error {
+	var err error
+
+	key = f.canonicalise(key)
+
+	f.keyTx(a, key, func(tx Tx) {
+		if meta, _ := getMeta(tx, key); !tx.Has(key) {
+			err = fmt.Errorf("key %s: %w", key, ErrMissingKey)
+		} else if meta.Deleted == nil {
+			err = fmt.Errorf("key %s: %w", key, ErrNotDeleted)
+		} else if !deleteKey(tx, key) || tx.Has(key) {
+			err = ErrDeleteUnsupported
+		}
+	})
+
+	return err
+}
+
+// Errors.
+var (
+	ErrDeleteUnsupported = errors.New("store does not support deletion")
+	ErrNotDeleted        = errors.New(notDeleted)
+	ErrDeleted           = errors.New("key deleted")
+)
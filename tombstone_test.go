@@ -0,0 +1,99 @@
+package furl
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTombstone(t *testing.T) {
+	btree, err := OpenBTreeStore(filepath.Join(t.TempDir(), "furl.btree"))
+	if err != nil {
+		t.Fatalf("unexpected error opening btree: %s", err)
+	}
+	defer btree.Close()
+	for n, s := range [...]Store{
+		NewStore(),
+		NewShardedStore(2),
+		btree,
+		testPrimary(t, NewStore()),
+	} {
+		now := testClock()
+		f := New(SetStore(s), Quarantine(time.Hour), Clock(func() time.Time { return now }))
+		get := func(key string) int {
+			w := httptest.NewRecorder()
+			f.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/"+key, nil))
+			return w.Code
+		}
+		if code := post(f, "AAA", "http://www.example.com/1"); code != http.StatusOK {
+			t.Fatalf("test %d: expecting response code 200, got %d", n+1, code)
+		}
+		if err := f.Delete("AAA"); err != nil {
+			t.Errorf("test %d: unexpected error deleting: %s", n+1, err)
+		} else if code := get("AAA"); code != http.StatusGone {
+			t.Errorf("test %d: expecting response code 410, got %d", n+1, code)
+		} else if code := post(f, "AAA", "http://www.example.com/2"); code != http.StatusMethodNotAllowed {
+			t.Errorf("test %d: expecting quarantined key to be refused, got %d", n+1, code)
+		} else if err := f.Delete("AAA"); !errors.Is(err, ErrMissingKey) {
+			t.Errorf("test %d: expecting error %v, got %v", n+1, ErrMissingKey, err)
+		}
+		if err := f.Restore("AAA"); err != nil {
+			t.Errorf("test %d: unexpected error restoring: %s", n+1, err)
+		} else if code := get("AAA"); code != http.StatusMovedPermanently {
+			t.Errorf("test %d: expecting response code 301, got %d", n+1, code)
+		} else if err := f.Restore("AAA"); !errors.Is(err, ErrNotDeleted) {
+			t.Errorf("test %d: expecting error %v, got %v", n+1, ErrNotDeleted, err)
+		} else if err := f.Purge("AAA"); !errors.Is(err, ErrNotDeleted) {
+			t.Errorf("test %d: expecting error %v, got %v", n+1, ErrNotDeleted, err)
+		}
+		f.Delete("AAA")
+		now = now.Add(time.Hour)
+		if code := post(f, "AAA", "http://www.example.com/2"); code != http.StatusOK {
+			t.Errorf("test %d: expecting key to be reused after quarantine, got %d", n+1, code)
+		} else if url, _ := s.Get("AAA"); url != "http://www.example.com/2" {
+			t.Errorf("test %d: expecting reused url, got %q", n+1, url)
+		} else if history, ok := getHistory(s, "AAA"); ok && len(history) != 1 {
+			t.Errorf("test %d: expecting reused key to have no previous history, got %v", n+1, history)
+		}
+		for m, test := range [...]struct {
+			Path, Body string
+			Code       int
+		}{
+			{ // 1
+				Path: "/purge",
+				Body: "key=AAA",
+				Code: http.StatusConflict,
+			},
+			{ // 2
+				Path: "/delete",
+				Body: "key=AAA",
+				Code: http.StatusNoContent,
+			},
+			{ // 3
+				Path: "/purge",
+				Body: "key=AAA",
+				Code: http.StatusNoContent,
+			},
+			{ // 4
+				Path: "/restore",
+				Body: "key=AAA",
+				Code: http.StatusNotFound,
+			},
+		} {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, test.Path, strings.NewReader(test.Body))
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			f.Admin().ServeHTTP(w, r)
+			if w.Code != test.Code {
+				t.Errorf("test %d.%d: expecting response code %d, got %d", n+1, m+1, test.Code, w.Code)
+			}
+		}
+		if code := get("AAA"); code != http.StatusNotFound {
+			t.Errorf("test %d: expecting purged key to respond with 404, got %d", n+1, code)
+		}
+	}
+}
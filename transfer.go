@@ -0,0 +1,361 @@
+package furl
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// The Format type represents a portable encoding for key:url data that can be
+// used with the Export function and the Import method.
+type Format uint8
+
+// The formats available for Export and Import.
+//
+// JSONLines: Each key:url pair is a JSON object on its own line, matching the
+// JSON POST body: {"key":"KEY HERE","url":"URL HERE"}
+//
+// CSV: A header line of "key,url", followed by a record per key:url pair.
+//
+// XML: Each key:url pair is encoded as per the XML POST body, and the list is
+// wrapped in a furls element:
+// <furls><furl><key>KEY HERE</key><url>URL HERE</url></furl></furls>
+//
+// The JSONLines and XML formats include any Meta for each link, as per the
+// POST responses; the CSV format does not.
+const (
+	JSONLines Format = iota
+	CSV
+	XML
+)
+
+// The Conflict type determines how the Import method treats keys that already
+// exist in the Store.
+type Conflict uint8
+
+// The conflict policies available for Import.
+//
+// ConflictSkip: Existing keys are left unchanged.
+//
+// ConflictOverwrite: Existing keys are set to the imported URL, except for
+// deleted keys that are still within their quarantine period, which are left
+// unchanged.
+//
+// ConflictFail: Nothing is imported if any of the imported keys exist. NB: A
+// key created by another writer during the import will stop the import at that
+// key, leaving the records before it imported.
+//
+// ConflictOverwriteDeleted: Existing keys are set to the imported URL,
+// including deleted keys that are still within their quarantine period, which
+// are reinstated.
+//
+// For all policies, deleted keys whose quarantine period has passed are treated
+// as not existing.
+const (
+	ConflictSkip Conflict = iota
+	ConflictOverwrite
+	ConflictFail
+	ConflictOverwriteDeleted
+)
+
+var (
+	xmlListStart = xml.StartElement{
+		Name: xml.Name{
+			Local: "furls",
+		},
+	}
+	csvHeader = []string{"key", "url"}
+)
+
+// Export writes all of the key:url pairs from the given Ranger to the Writer
+// in the given Format.
+//
+// If the Ranger implements the MetaRanger interface, the Meta for each link
+// will also be written, without any Password hash; the ExportWithPasswords
+// function can be used to include them. The Tagged function can be used to
+// export only those links with particular tags.
+func Export(w io.Writer, r Ranger, format Format) error {
+	return export(w, r, format, false)
+}
+
+// The ExportWithPasswords function writes the key:url pairs from the given
+// Ranger to the Writer, as with the Export function, but includes the Password
+// hash in the Meta of each password protected link, so that an Import will
+// keep the passwords.
+//
+// NB: The output should be kept as securely as the Store itself.
+func ExportWithPasswords(w io.Writer, r Ranger, format Format) error {
+	return export(w, r, format, true)
+}
+
+func export(w io.Writer, r Ranger, format Format, passwords bool) error {
+	var err error
+
+	if !passwords {
+		r = hiddenPasswords{r}
+	}
+
+	switch format {
+	case JSONLines:
+		e := json.NewEncoder(w)
+
+		rangeMeta(r, func(key, url string, meta Meta) bool {
+			err = e.Encode(newKeyURL(key, url, meta))
+
+			return err == nil
+		})
+	case CSV:
+		c := csv.NewWriter(w)
+
+		if err = c.Write(csvHeader); err != nil {
+			return err
+		}
+
+		r.Range(func(key, url string) bool {
+			err = c.Write([]string{key, url})
+
+			return err == nil
+		})
+
+		if err == nil {
+			c.Flush()
+
+			err = c.Error()
+		}
+	case XML:
+		e := xml.NewEncoder(w)
+
+		if err = e.EncodeToken(xmlListStart); err != nil {
+			return err
+		}
+
+		rangeMeta(r, func(key, url string, meta Meta) bool {
+			err = e.EncodeElement(newKeyURL(key, url, meta), xmlStart)
+
+			return err == nil
+		})
+
+		if err == nil {
+			if err = e.EncodeToken(xmlListStart.End()); err == nil {
+				err = e.Flush()
+			}
+		}
+	default:
+		return ErrUnknownFormat
+	}
+
+	return err
+}
+
+// The Import method reads key:url pairs in the given Format from the Reader
+// and adds them to the Store, using the given Conflict policy for keys that
+// already exist.
+//
+// All of the keys and URLs are checked with the configured KeyValidator and
+// URLValidator before any are added to the Store; an invalid key, URL, Meta,
+// Destination, or Rule, or a key in the list set with the Reserved Option, will
+// cause nothing to be imported, as will a key that appears more than once, after
+// canonicalisation, returning ErrDuplicateKey. If the Store does not implement
+// MetaStore, links with Meta that restricts how they are followed, such as a
+// Password, will also cause nothing to be imported, returning
+// ErrMetaUnsupported.
+//
+// Each record is then set in its own Store transaction.
+//
+// Imported links keep any Created time in their Meta, and are otherwise given
+// the current time. A Password in the Meta of an imported link is kept if it is
+// a password hash, as exported by the ExportWithPasswords function, otherwise
+// it is hashed. Links that overwrite an
+// existing key are given an Updated time of the current time, unless one was
+// imported.
+//
+// Returns the number of key:url pairs that were set in the Store.
+func (f *Furl) Import(r io.Reader, format Format, conflict Conflict) (int, error) {
+	var (
+		data []keyURL
+		err  error
+	)
+
+	switch format {
+	case JSONLines:
+		data, err = readJSONLines(r)
+	case CSV:
+		data, err = readCSV(r)
+	case XML:
+		data, err = readXML(r)
+	default:
+		return 0, ErrUnknownFormat
+	}
+
+	if err != nil {
+		return 0, err
+	}
+
+	keys := make(map[string]struct{}, len(data))
+
+	for n, d := range data {
+		if d.Key == "" || d.Key == "/" || d.Key == "." || d.Key == ".." || !f.validKey(d.Key) {
+			return 0, fmt.Errorf("record %d (%s): %w", n+1, d.Key, ErrInvalidKey)
+		} else if f.reservedKey(d.Key) {
+			return 0, fmt.Errorf("record %d (%s): %w", n+1, d.Key, ErrKeyReserved)
+		} else if !f.validURL(d.URL) {
+			return 0, fmt.Errorf("record %d (%s): %w", n+1, d.Key, ErrInvalidURL)
+		} else if d.Meta == nil {
+			data[n].Meta = new(Meta)
+		} else if !d.Meta.valid() {
+			return 0, fmt.Errorf("record %d (%s): %w", n+1, d.Key, ErrInvalidMeta)
+		} else if !f.validDestinations(d.Destinations) {
+			return 0, fmt.Errorf("record %d (%s): %w", n+1, d.Key, ErrInvalidDestinations)
+		} else if !f.validRules(d.Rules) {
+			return 0, fmt.Errorf("record %d (%s): %w", n+1, d.Key, ErrInvalidRules)
+		} else if d.Meta.restricted() && !storesMeta(f.store) {
+			return 0, fmt.Errorf("record %d (%s): %w", n+1, d.Key, ErrMetaUnsupported)
+		}
+
+		if data[n].Created.IsZero() {
+			data[n].Created = f.now().UTC()
+		}
+
+		if p := data[n].Password; p != "" && !validPasswordHash(p) {
+			if data[n].Password, err = hashPassword(p); err != nil {
+				return 0, fmt.Errorf("record %d (%s): %w", n+1, d.Key, err)
+			}
+		}
+
+		data[n].Key, data[n].Meta = f.canonical(d.Key, data[n].Meta)
+
+		if _, ok := keys[data[n].Key]; ok {
+			return 0, fmt.Errorf("record %d (%s): %w", n+1, d.Key, ErrDuplicateKey)
+		}
+
+		keys[data[n].Key] = struct{}{}
+	}
+
+	if conflict == ConflictFail {
+		for _, d := range data {
+			if _, ok := f.store.Get(d.Key); ok {
+				if meta, _ := getMeta(f.store, d.Key); !f.reusable(meta) {
+					return 0, fmt.Errorf("key %s: %w", d.Key, ErrKeyExists)
+				}
+			}
+		}
+	}
+
+	var count int
+
+	for _, d := range data {
+		var set bool
+
+		f.keyTx(actor{source: SourceImport}, d.Key, func(tx Tx) {
+			if meta, _ := getMeta(tx, d.Key); conflict == ConflictOverwriteDeleted || conflict == ConflictOverwrite && meta.Deleted == nil {
+				if d.Updated == nil && tx.Has(d.Key) {
+					now := f.now().UTC()
+					d.Updated = &now
+				}
+
+				tx.Set(d.Key, d.URL)
+			} else if !f.create(tx, d.Key, d.URL) {
+				return
+			}
+
+			setMeta(tx, d.Key, d.Meta)
+
+			set = true
+		})
+
+		if set {
+			count++
+		} else if conflict == ConflictFail {
+			return count, fmt.Errorf("key %s: %w", d.Key, ErrKeyExists)
+		}
+	}
+
+	return count, nil
+}
+
+type hiddenPasswords struct {
+	Ranger
+}
+
+func (h hiddenPasswords) RangeMeta(fn func(key, url string, meta Meta) bool) {
+	rangeMeta(h.Ranger, func(key, url string, meta Meta) bool {
+		hidePassword(&meta)
+
+		return fn(key, url, meta)
+	})
+}
+
+func readJSONLines(r io.Reader) ([]keyURL, error) {
+	var data []keyURL
+
+	d := json.NewDecoder(r)
+
+	for {
+		var ku keyURL
+
+		if err := d.Decode(&ku); errors.Is(err, io.EOF) {
+			return data, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("record %d: %w", len(data)+1, err)
+		}
+
+		data = append(data, ku)
+	}
+}
+
+func readCSV(r io.Reader) ([]keyURL, error) {
+	var data []keyURL
+
+	c := csv.NewReader(r)
+	c.FieldsPerRecord = len(csvHeader)
+
+	for first := true; ; first = false {
+		record, err := c.Read()
+		if errors.Is(err, io.EOF) {
+			return data, nil
+		} else if err != nil {
+			return nil, err
+		} else if first && record[0] == csvHeader[0] && record[1] == csvHeader[1] {
+			continue
+		}
+
+		data = append(data, keyURL{Key: record[0], URL: record[1]})
+	}
+}
+
+func readXML(r io.Reader) ([]keyURL, error) {
+	var data []keyURL
+
+	d := xml.NewDecoder(r)
+
+	for {
+		tk, err := d.Token()
+		if errors.Is(err, io.EOF) {
+			return data, nil
+		} else if err != nil {
+			return nil, err
+		}
+
+		if se, ok := tk.(xml.StartElement); ok && se.Name.Local == xmlStart.Name.Local {
+			var ku keyURL
+
+			if err := d.DecodeElement(&ku, &se); err != nil {
+				return nil, fmt.Errorf("record %d: %w", len(data)+1, err)
+			}
+
+			data = append(data, ku)
+		}
+	}
+}
+
+// Errors.
+var (
+	ErrUnknownFormat = errors.New("unknown format")
+	ErrInvalidKey    = errors.New(invalidKey)
+	ErrInvalidURL    = errors.New(invalidURL)
+	ErrKeyExists     = errors.New(keyExists)
+	ErrDuplicateKey  = errors.New("duplicate key")
+)
@@ -0,0 +1,247 @@
+package furl
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExportImport(t *testing.T) {
+	data := map[string]string{
+		"AAA": "http://www.google.com",
+		"BBB": "http://www.example.com/?a=1&b=2",
+		"C,C": "http://www.example.com/\"quoted\"",
+	}
+	for _, format := range [...]Format{JSONLines, CSV, XML} {
+		var sb strings.Builder
+		if err := Export(&sb, NewStore(Data(data)).(Ranger), format); err != nil {
+			t.Errorf("format %d: unexpected error exporting: %s", format, err)
+			continue
+		}
+		s := NewStore()
+		n, err := New(SetStore(s)).Import(strings.NewReader(sb.String()), format, ConflictFail)
+		if err != nil {
+			t.Errorf("format %d: unexpected error importing: %s", format, err)
+		} else if n != len(data) {
+			t.Errorf("format %d: expecting %d imported, got %d", format, len(data), n)
+		}
+		for key, url := range data {
+			if got, _ := s.Get(key); got != url {
+				t.Errorf("format %d: expecting key %q to have url %q, got %q", format, key, url, got)
+			}
+		}
+	}
+}
+
+func TestImport(t *testing.T) {
+	for n, test := range [...]struct {
+		Input    string
+		Format   Format
+		Conflict Conflict
+		Count    int
+		Err      error
+		Result   map[string]string
+	}{
+		{ // 1
+			Input:    "key,url\nAAA,http://www.example.com\nCCC,http://www.example.com/C\n",
+			Format:   CSV,
+			Conflict: ConflictSkip,
+			Count:    1,
+			Result: map[string]string{
+				"AAA": "http://www.google.com",
+				"BBB": "http://www.google.com/B",
+				"CCC": "http://www.example.com/C",
+			},
+		},
+		{ // 2
+			Input:    "AAA,http://www.example.com\nCCC,http://www.example.com/C\n",
+			Format:   CSV,
+			Conflict: ConflictOverwrite,
+			Count:    2,
+			Result: map[string]string{
+				"AAA": "http://www.example.com",
+				"BBB": "http://www.google.com/B",
+				"CCC": "http://www.example.com/C",
+			},
+		},
+		{ // 3
+			Input:    `{"key":"CCC","url":"http://www.example.com/C"}` + "\n" + `{"key":"AAA","url":"http://www.example.com"}`,
+			Format:   JSONLines,
+			Conflict: ConflictFail,
+			Err:      ErrKeyExists,
+			Result: map[string]string{
+				"AAA": "http://www.google.com",
+				"BBB": "http://www.google.com/B",
+			},
+		},
+		{ // 4
+			Input:    "<furls><furl><key>CCC</key><url>http://www.example.com/C</url></furl><furl><key>ABC</key><url>http://www.example.com</url></furl></furls>",
+			Format:   XML,
+			Conflict: ConflictSkip,
+			Err:      ErrInvalidKey,
+			Result: map[string]string{
+				"AAA": "http://www.google.com",
+				"BBB": "http://www.google.com/B",
+			},
+		},
+		{ // 5
+			Input:    "<furl><key>CCC</key><url>ftp://www.example.com/C</url></furl>",
+			Format:   XML,
+			Conflict: ConflictSkip,
+			Err:      ErrInvalidURL,
+			Result: map[string]string{
+				"AAA": "http://www.google.com",
+				"BBB": "http://www.google.com/B",
+			},
+		},
+		{ // 6
+			Input:    "<furl><key>CCC</key><url>http://www.example.com/C</url></furl>\n<furl><key>DDD</key><url>http://www.example.com/D</url></furl>",
+			Format:   XML,
+			Conflict: ConflictFail,
+			Count:    2,
+			Result: map[string]string{
+				"AAA": "http://www.google.com",
+				"BBB": "http://www.google.com/B",
+				"CCC": "http://www.example.com/C",
+				"DDD": "http://www.example.com/D",
+			},
+		},
+		{ // 7
+			Input:    "",
+			Format:   3,
+			Conflict: ConflictFail,
+			Err:      ErrUnknownFormat,
+			Result: map[string]string{
+				"AAA": "http://www.google.com",
+				"BBB": "http://www.google.com/B",
+			},
+		},
+		{ // 8
+			Input:    "CCC,http://www.example.com/C\nDDD,http://www.example.com/D\nCCC,http://www.example.com/C2\n",
+			Format:   CSV,
+			Conflict: ConflictOverwrite,
+			Err:      ErrDuplicateKey,
+			Result: map[string]string{
+				"AAA": "http://www.google.com",
+				"BBB": "http://www.google.com/B",
+			},
+		},
+	} {
+		s := NewStore(Data(map[string]string{
+			"AAA": "http://www.google.com",
+			"BBB": "http://www.google.com/B",
+		}))
+		count, err := New(SetStore(s), URLValidator(HTTPURL), KeyValidator(func(key string) bool {
+			return key != "ABC"
+		})).Import(strings.NewReader(test.Input), test.Format, test.Conflict)
+		if !errors.Is(err, test.Err) {
+			t.Errorf("test %d: expecting error %v, got %v", n+1, test.Err, err)
+		} else if count != test.Count {
+			t.Errorf("test %d: expecting %d imported, got %d", n+1, test.Count, count)
+		}
+		var found int
+		s.(Ranger).Range(func(key, url string) bool {
+			found++
+			if test.Result[key] != url {
+				t.Errorf("test %d: expecting key %q to have url %q, got %q", n+1, key, test.Result[key], url)
+			}
+			return true
+		})
+		if found != len(test.Result) {
+			t.Errorf("test %d: expecting %d keys, got %d", n+1, len(test.Result), found)
+		}
+	}
+}
+
+func TestImportDeleted(t *testing.T) {
+	now := testClock()
+	f := New(Quarantine(time.Hour), Clock(func() time.Time { return now }))
+	post(f, "AAA", "http://www.example.com/A")
+	post(f, "BBB", "http://www.example.com/B")
+	f.Delete("AAA")
+	f.Delete("BBB")
+	for n, test := range [...]struct {
+		Key      string
+		Conflict Conflict
+		Advance  time.Duration
+		Count    int
+		Err      error
+		Deleted  bool
+	}{
+		{ // 1
+			Key:      "AAA",
+			Conflict: ConflictOverwrite,
+			Deleted:  true,
+		},
+		{ // 2
+			Key:      "AAA",
+			Conflict: ConflictSkip,
+			Deleted:  true,
+		},
+		{ // 3
+			Key:      "AAA",
+			Conflict: ConflictFail,
+			Err:      ErrKeyExists,
+			Deleted:  true,
+		},
+		{ // 4
+			Key:      "AAA",
+			Conflict: ConflictOverwriteDeleted,
+			Count:    1,
+		},
+		{ // 5
+			Key:      "BBB",
+			Conflict: ConflictFail,
+			Advance:  time.Hour,
+			Count:    1,
+		},
+	} {
+		now = now.Add(test.Advance)
+		url := "http://www.example.com/" + strconv.Itoa(n+1)
+		count, err := f.Import(strings.NewReader(`{"key":"`+test.Key+`","url":"`+url+`"}`), JSONLines, test.Conflict)
+		meta, _ := getMeta(f.store, test.Key)
+		if !errors.Is(err, test.Err) {
+			t.Errorf("test %d: expecting error %v, got %v", n+1, test.Err, err)
+		} else if count != test.Count {
+			t.Errorf("test %d: expecting %d imported, got %d", n+1, test.Count, count)
+		} else if deleted := meta.Deleted != nil; deleted != test.Deleted {
+			t.Errorf("test %d: expecting deleted to be %v, got %v", n+1, test.Deleted, deleted)
+		} else if got, _ := f.store.Get(test.Key); test.Count == 1 && got != url {
+			t.Errorf("test %d: expecting url %q, got %q", n+1, url, got)
+		}
+	}
+}
+
+func TestExportPasswords(t *testing.T) {
+	f := New()
+	r := httptest.NewRequest(http.MethodPost, "/AAA", strings.NewReader(`{"url":"http://www.example.com/","password":"secret"}`))
+	r.Header.Set("Content-Type", "application/json")
+	f.ServeHTTP(httptest.NewRecorder(), r)
+	for n, format := range [...]Format{JSONLines, CSV, XML} {
+		var sb strings.Builder
+		if err := Export(&sb, f.store.(Ranger), format); err != nil {
+			t.Errorf("test %d: unexpected error: %s", n+1, err)
+		} else if strings.Contains(sb.String(), "pbkdf2") {
+			t.Errorf("test %d: expecting password hash not to be exported, got %s", n+1, sb.String())
+		}
+	}
+	w := httptest.NewRecorder()
+	f.Admin().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/links", nil))
+	if strings.Contains(w.Body.String(), "pbkdf2") {
+		t.Errorf("expecting password hash not to be listed, got %s", w.Body.String())
+	}
+	var sb strings.Builder
+	if err := ExportWithPasswords(&sb, f.store.(Ranger), JSONLines); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	g := New()
+	if _, err := g.Import(strings.NewReader(sb.String()), JSONLines, ConflictFail); err != nil {
+		t.Fatalf("unexpected error importing: %s", err)
+	} else if meta, _ := getMeta(g.store, "AAA"); !verifyPassword(meta.Password, "secret") {
+		t.Errorf("expecting password to be kept, got %q", meta.Password)
+	}
+}
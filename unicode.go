@@ -0,0 +1,222 @@
+package furl
+
+import (
+	"net/url"
+	"path"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+const (
+	zeroWidthJoiner = '\u200d'
+	maxUnicodeKey   = 64
+)
+
+var (
+	emojiModifiers = &unicode.RangeTable{
+		R32: []unicode.Range32{
+			{Lo: 0x1f3fb, Hi: 0x1f3ff, Stride: 1},
+		},
+	}
+	emojiTags = &unicode.RangeTable{
+		R32: []unicode.Range32{
+			{Lo: 0xe0020, Hi: 0xe007f, Stride: 1},
+		},
+	}
+	bidiControls = &unicode.RangeTable{
+		R16: []unicode.Range16{
+			{Lo: 0x061c, Hi: 0x061c, Stride: 1},
+			{Lo: 0x200e, Hi: 0x200f, Stride: 1},
+			{Lo: 0x202a, Hi: 0x202e, Stride: 1},
+			{Lo: 0x2066, Hi: 0x2069, Stride: 1},
+		},
+	}
+
+	// The script combinations allowed in a single key, as per the Highly
+	// Restrictive level of Unicode Technical Standard #39.
+	scriptSets = [...][]string{
+		{"Latin", "Han", "Hiragana", "Katakana"},
+		{"Latin", "Han", "Bopomofo"},
+		{"Latin", "Han", "Hangul"},
+	}
+
+	// The scripts that are checked before searching all scripts, being those
+	// that can be combined in a key.
+	commonScripts = [...]string{"Latin", "Han", "Hiragana", "Katakana", "Bopomofo", "Hangul"}
+)
+
+// The UnicodeKey function can be used with KeyValidator to allow keys made of
+// letters and digits from any script, along with emoji, while rejecting keys
+// that could be used to imitate other keys.
+//
+// A key is valid if, once converted to Unicode Normal Form C, it is no more
+// than 64 characters and consists only of the following:
+//
+//	Letters and digits, along with any combining marks.
+//	Emoji, including sequences joined with a zero width joiner, and those
+//	with skin tone modifiers, variation selectors, and tags.
+//	The punctuation characters - _ . and ~
+//
+// The letters, digits, and marks of a key must be from a single script, with
+// the exception of the combinations of Latin with Chinese, Japanese, and Korean
+// scripts that are commonly used together. This prevents keys that mix, for
+// example, Latin and Cyrillic letters to look like another key.
+//
+// Control characters, including those that change the direction of text, are
+// not allowed.
+//
+// Keys are not mapped as per IDNA (UTS #46), as that mapping is designed for
+// host names; it splits the name into labels at each full stop, and applies
+// rules, such as those for hyphens, that do not apply to keys. The parts of it
+// that matter for keys, that is case and compatibility variants such as full
+// width letters, are handled by the FoldUnicode function, and the characters
+// that IDNA disallows, such as most punctuation and controls, are rejected.
+//
+// NB: Keys are not stored in Normal Form C unless the NFC or FoldUnicode
+// function is set with the Canonicalise Option.
+func UnicodeKey(key string) bool {
+	if !utf8.ValidString(key) {
+		return false
+	}
+
+	key = norm.NFC.String(key)
+
+	if key == "" || utf8.RuneCountInString(key) > maxUnicodeKey {
+		return false
+	}
+
+	var (
+		scripts   []string
+		prev      rune
+		prevEmoji bool
+	)
+
+	for _, r := range key {
+		emoji := false
+
+		switch {
+		case unicode.Is(bidiControls, r):
+			return false
+		case r == '-' || r == '_' || r == '.' || r == '~':
+		case r == zeroWidthJoiner:
+			if !prevEmoji {
+				return false
+			}
+
+			emoji = true
+		case unicode.Is(emojiModifiers, r), unicode.Is(emojiTags, r):
+			if !prevEmoji {
+				return false
+			}
+
+			emoji = true
+		case unicode.Is(unicode.So, r):
+			emoji = true
+		case unicode.IsMark(r):
+			if prev == 0 || prev == '-' || prev == '_' || prev == '.' || prev == '~' || prev == zeroWidthJoiner {
+				return false
+			}
+
+			emoji = prevEmoji
+
+			if !emoji {
+				if scripts = addScript(scripts, r); !allowedScripts(scripts) {
+					return false
+				}
+			}
+		case unicode.IsLetter(r), unicode.IsDigit(r):
+			if scripts = addScript(scripts, r); !allowedScripts(scripts) {
+				return false
+			}
+		default:
+			return false
+		}
+
+		prev = r
+		prevEmoji = emoji
+	}
+
+	return prev != zeroWidthJoiner
+}
+
+// addScript adds the script of the rune to the list, if it is not already
+// there, checking the scripts already found and the common scripts before
+// searching all of them.
+func addScript(scripts []string, r rune) []string {
+	if unicode.In(r, unicode.Common, unicode.Inherited) {
+		return scripts
+	}
+
+	for _, name := range scripts {
+		if unicode.Is(unicode.Scripts[name], r) {
+			return scripts
+		}
+	}
+
+	for _, name := range commonScripts {
+		if unicode.Is(unicode.Scripts[name], r) {
+			return append(scripts, name)
+		}
+	}
+
+	for name, table := range unicode.Scripts {
+		if name != "Common" && name != "Inherited" && unicode.Is(table, r) {
+			return append(scripts, name)
+		}
+	}
+
+	return scripts
+}
+
+func allowedScripts(scripts []string) bool {
+	if len(scripts) < 2 {
+		return true
+	}
+
+Sets:
+	for _, set := range scriptSets {
+		for _, script := range scripts {
+			if !containsString(set, script) {
+				continue Sets
+			}
+		}
+
+		return true
+	}
+
+	return false
+}
+
+func containsString(list []string, str string) bool {
+	for _, s := range list {
+		if s == str {
+			return true
+		}
+	}
+
+	return false
+}
+
+// The NFC function is a key canonicalisation function, for use with the
+// Canonicalise Option, that converts keys to Unicode Normal Form C, so that
+// keys that are made of the same characters, but encoded differently, refer to
+// the same link.
+func NFC(key string) string {
+	return norm.NFC.String(key)
+}
+
+// pathKey splits the last element from an escaped URL path, decoding it so
+// that percent-encoded keys can contain characters, such as a slash, that
+// would otherwise be treated as part of the path. The remaining path is
+// returned in its escaped form.
+func pathKey(escaped string) (string, string) {
+	dir, base := path.Dir(escaped), path.Base(escaped)
+
+	if key, err := url.PathUnescape(base); err == nil {
+		base = key
+	}
+
+	return dir, base
+}
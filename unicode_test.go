@@ -0,0 +1,110 @@
+package furl
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestUnicodeKey(t *testing.T) {
+	for n, test := range [...]struct {
+		Key   string
+		Valid bool
+	}{
+		{ // 1
+			Key:   "abc-123_x.y~z",
+			Valid: true,
+		},
+		{ // 2
+			Key:   "caf\u00e9",
+			Valid: true,
+		},
+		{ // 3
+			Key:   "cafe\u0301",
+			Valid: true,
+		},
+		{ // 4
+			Key:   "привет",
+			Valid: true,
+		},
+		{ // 5
+			Key:   "東京tokyo",
+			Valid: true,
+		},
+		{ // 6
+			Key:   "\U0001f98a",
+			Valid: true,
+		},
+		{ // 7
+			Key:   "\U0001f469\U0001f3fd\u200d\U0001f4bb",
+			Valid: true,
+		},
+		{ // 8
+			Key:   "\U0001f3f4\U000e0067\U000e0062\U000e0073\U000e0063\U000e0074\U000e007f",
+			Valid: true,
+		},
+		{ // 9
+			Key: "p\u0430ypal",
+		},
+		{ // 10
+			Key: "abc\u202edef",
+		},
+		{ // 11
+			Key: "a b",
+		},
+		{ // 12
+			Key: "a/b",
+		},
+		{ // 13
+			Key: "\u200d\U0001f98a",
+		},
+		{ // 14
+			Key: "\u0301a",
+		},
+		{ // 15
+			Key: "",
+		},
+		{ // 16
+			Key: strings.Repeat("a", 65),
+		},
+		{ // 17
+			Key: "\xff",
+		},
+	} {
+		if valid := UnicodeKey(test.Key); valid != test.Valid {
+			t.Errorf("test %d: expecting valid to be %v, got %v", n+1, test.Valid, valid)
+		}
+	}
+}
+
+func TestPercentEncodedKey(t *testing.T) {
+	f := New(KeyValidator(UnicodeKey), Canonicalise(NFC))
+	if code := post(f, "caf%C3%A9", "http://www.example.com/"); code != http.StatusOK {
+		t.Fatalf("expecting response code 200, got %d", code)
+	} else if code := post(f, "a%2Fb", "http://www.example.com/"); code != http.StatusUnprocessableEntity {
+		t.Errorf("expecting response code 422, got %d", code)
+	}
+	for n, path := range [...]string{
+		"/caf%C3%A9",
+		"/cafe%CC%81",
+		"/café",
+	} {
+		w := httptest.NewRecorder()
+		f.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if w.Code != http.StatusMovedPermanently {
+			t.Errorf("test %d: expecting response code 301, got %d", n+1, w.Code)
+		}
+	}
+	f = New()
+	if code := post(f, "a%2Fb", "http://www.example.com/"); code != http.StatusOK {
+		t.Fatalf("expecting response code 200, got %d", code)
+	} else if url, _ := f.store.Get("a/b"); url != "http://www.example.com/" {
+		t.Errorf("expecting key to be decoded, got url %q", url)
+	}
+	w := httptest.NewRecorder()
+	f.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/a%2Fb/history", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("expecting response code 200, got %d", w.Code)
+	}
+}
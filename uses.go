@@ -0,0 +1,47 @@
+package furl
+
+import (
+	"errors"
+	"net/http"
+)
+
+const usedUp = "410 used up"
+
+// use records a successful use of the link for the key, returning false if the
+// link has a maximum number of uses that have all been used.
+//
+// The count is read and updated within a single Tx of the Store, so that
+// concurrent uses are counted correctly.
+func (f *Furl) use(key string) bool {
+	if meta, _ := getMeta(f.store, key); meta.MaxUses == 0 {
+		return true
+	}
+
+	ok := true
+
+	keyTx(f.store, key, func(tx Tx) {
+		meta, _ := getMeta(tx, key)
+		if meta.MaxUses == 0 {
+			return
+		} else if ok = meta.Uses < meta.MaxUses; ok {
+			meta.Uses++
+
+			setMeta(tx, key, &meta)
+		}
+	})
+
+	return ok
+}
+
+// exhausted writes the response for a link that has been used the maximum
+// number of times.
+func (f *Furl) exhausted(w http.ResponseWriter, r *http.Request) {
+	if f.index != nil {
+		f.index(w, r, http.StatusGone, usedUp)
+	} else {
+		http.Error(w, usedUp, http.StatusGone)
+	}
+}
+
+// Errors.
+var ErrUsedUp = errors.New("link used up")
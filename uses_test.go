@@ -0,0 +1,117 @@
+package furl
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestMaxUses(t *testing.T) {
+	f := New(Clock(testClock))
+	r := httptest.NewRequest(http.MethodPost, "/AAA", strings.NewReader("url=http://www.example.com/&maxUses=2"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	f.ServeHTTP(httptest.NewRecorder(), r)
+	for n, test := range [...]struct {
+		Method, Path string
+		Code         int
+		Response     string
+	}{
+		{ // 1
+			Method: http.MethodHead,
+			Path:   "/AAA",
+			Code:   http.StatusFound,
+		},
+		{ // 2
+			Method:   http.MethodGet,
+			Path:     "/AAA+",
+			Code:     http.StatusOK,
+			Response: `{"key":"AAA","url":"http://www.example.com/","created":"2020-01-02T03:04:05Z","maxUses":2}`,
+		},
+		{ // 3
+			Method: http.MethodGet,
+			Path:   "/AAA",
+			Code:   http.StatusFound,
+		},
+		{ // 4
+			Method:   http.MethodGet,
+			Path:     "/AAA+",
+			Code:     http.StatusOK,
+			Response: `{"key":"AAA","url":"http://www.example.com/","created":"2020-01-02T03:04:05Z","maxUses":2,"uses":1}`,
+		},
+		{ // 5
+			Method: http.MethodGet,
+			Path:   "/AAA",
+			Code:   http.StatusFound,
+		},
+		{ // 6
+			Method:   http.MethodGet,
+			Path:     "/AAA",
+			Code:     http.StatusGone,
+			Response: usedUp,
+		},
+		{ // 7
+			Method: http.MethodGet,
+			Path:   "/AAA.svg",
+			Code:   http.StatusOK,
+		},
+	} {
+		w := httptest.NewRecorder()
+		f.ServeHTTP(w, httptest.NewRequest(test.Method, test.Path, nil))
+		if w.Code != test.Code {
+			t.Errorf("test %d: expecting response code %d, got %d", n+1, test.Code, w.Code)
+		} else if cache := w.Header().Get("Cache-Control"); w.Code == http.StatusFound && cache != "no-store" {
+			t.Errorf("test %d: expecting Cache-Control no-store, got %q", n+1, cache)
+		} else if response := strings.TrimSpace(w.Body.String()); test.Response != "" && response != test.Response {
+			t.Errorf("test %d: expecting response %q, got %q", n+1, test.Response, response)
+		}
+	}
+	if e := f.Resolve("AAA"); e[0].Error != ErrUsedUp.Error() {
+		t.Errorf("expecting used up error, got %v", e[0])
+	}
+	r = httptest.NewRequest(http.MethodPost, "/BBB", strings.NewReader("url=http://www.example.com/&maxUses=many"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	f.ServeHTTP(w, r)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expecting response code 400 for invalid maxUses, got %d", w.Code)
+	}
+}
+
+func TestMaxUsesConcurrent(t *testing.T) {
+	const (
+		maxUses = 10
+		clicks  = 100
+	)
+	for n, store := range [...]Store{NewStore(), NewShardedStore(4)} {
+		f := New(SetStore(store))
+		r := httptest.NewRequest(http.MethodPost, "/AAA", strings.NewReader(`{"url":"http://www.example.com/","maxUses":10}`))
+		r.Header.Set("Content-Type", "application/json")
+		f.ServeHTTP(httptest.NewRecorder(), r)
+		var (
+			wg        sync.WaitGroup
+			mu        sync.Mutex
+			redirects int
+		)
+		for i := 0; i < clicks; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				w := httptest.NewRecorder()
+				f.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/AAA", nil))
+				if w.Code == http.StatusFound {
+					mu.Lock()
+					redirects++
+					mu.Unlock()
+				}
+			}()
+		}
+		wg.Wait()
+		if redirects != maxUses {
+			t.Errorf("test %d: expecting %d redirects, got %d", n+1, maxUses, redirects)
+		} else if meta, _ := getMeta(store, "AAA"); meta.Uses != maxUses {
+			t.Errorf("test %d: expecting %d uses, got %d", n+1, maxUses, meta.Uses)
+		}
+	}
+}
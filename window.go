@@ -0,0 +1,77 @@
+package furl
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const (
+	notYetActive = "not yet active"
+	expired      = "410 expired"
+
+	formTimeLayout = "2006-01-02T15:04"
+)
+
+// active checks that the link for the key is within its activation window,
+// writing a response if it is not.
+//
+// Before its NotBefore time, the response will be 403 Forbidden, and after its
+// NotAfter time, the response will be 410 Gone.
+func (f *Furl) active(w http.ResponseWriter, r *http.Request, key string) bool {
+	meta, _ := getMeta(f.store, key)
+
+	switch activeErr(meta, f.now()) {
+	case ErrNotYetActive:
+		if f.index != nil {
+			f.index(w, r, http.StatusForbidden, meta.NotBefore.UTC().Format(time.RFC3339))
+		} else {
+			http.Error(w, notYetActive, http.StatusForbidden)
+		}
+	case ErrExpired:
+		if f.index != nil {
+			f.index(w, r, http.StatusGone, expired)
+		} else {
+			http.Error(w, expired, http.StatusGone)
+		}
+	default:
+		return true
+	}
+
+	return false
+}
+
+func activeErr(meta Meta, now time.Time) error {
+	if meta.NotBefore != nil && now.Before(*meta.NotBefore) {
+		return ErrNotYetActive
+	} else if meta.NotAfter != nil && !now.Before(*meta.NotAfter) {
+		return ErrExpired
+	}
+
+	return nil
+}
+
+// formTime parses a time from a form value, either in RFC 3339 format, or in
+// the format of an HTML datetime-local input, which is taken to be in UTC.
+func formTime(form url.Values, name string) (*time.Time, error) {
+	value := form.Get(name)
+	if value == "" {
+		return nil, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		if t, err = time.Parse(formTimeLayout, value); err != nil {
+			return nil, err
+		}
+	}
+
+	return &t, nil
+}
+
+// Errors.
+var (
+	ErrNotYetActive = errors.New(notYetActive)
+	ErrExpired      = errors.New("link expired")
+)
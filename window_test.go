@@ -0,0 +1,107 @@
+package furl
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestActivationWindow(t *testing.T) {
+	now := testClock()
+	f := New(Clock(func() time.Time { return now }))
+	r := httptest.NewRequest(http.MethodPost, "/AAA", strings.NewReader(`{"url":"http://www.example.com/","notBefore":"2020-01-03T00:00:00Z","notAfter":"2020-01-04T00:00:00Z"}`))
+	r.Header.Set("Content-Type", "application/json")
+	f.ServeHTTP(httptest.NewRecorder(), r)
+	for n, test := range [...]struct {
+		Path     string
+		Time     time.Time
+		Code     int
+		Response string
+	}{
+		{ // 1
+			Path:     "/AAA",
+			Time:     testClock(),
+			Code:     http.StatusForbidden,
+			Response: notYetActive,
+		},
+		{ // 2
+			Path:     "/AAA+",
+			Time:     testClock(),
+			Code:     http.StatusOK,
+			Response: `{"key":"AAA","url":"http://www.example.com/","created":"2020-01-02T03:04:05Z","notBefore":"2020-01-03T00:00:00Z","notAfter":"2020-01-04T00:00:00Z"}`,
+		},
+		{ // 3
+			Path: "/AAA",
+			Time: time.Date(2020, 1, 3, 0, 0, 0, 0, time.UTC),
+			Code: http.StatusFound,
+		},
+		{ // 4
+			Path: "/AAA",
+			Time: time.Date(2020, 1, 3, 23, 59, 59, 0, time.UTC),
+			Code: http.StatusFound,
+		},
+		{ // 5
+			Path:     "/AAA",
+			Time:     time.Date(2020, 1, 4, 0, 0, 0, 0, time.UTC),
+			Code:     http.StatusGone,
+			Response: expired,
+		},
+		{ // 6
+			Path: "/AAA.png",
+			Time: time.Date(2020, 1, 4, 0, 0, 0, 0, time.UTC),
+			Code: http.StatusOK,
+		},
+	} {
+		now = test.Time
+		w := httptest.NewRecorder()
+		f.ServeHTTP(w, httptest.NewRequest(http.MethodGet, test.Path, nil))
+		if w.Code != test.Code {
+			t.Errorf("test %d: expecting response code %d, got %d", n+1, test.Code, w.Code)
+		} else if cache := w.Header().Get("Cache-Control"); w.Code == http.StatusFound && cache != "no-store" {
+			t.Errorf("test %d: expecting Cache-Control no-store, got %q", n+1, cache)
+		} else if response := strings.TrimSpace(w.Body.String()); test.Response != "" && response != test.Response {
+			t.Errorf("test %d: expecting response %q, got %q", n+1, test.Response, response)
+		}
+	}
+	now = testClock()
+	if e := f.Resolve("AAA"); e[0].Error != notYetActive {
+		t.Errorf("expecting not yet active error, got %v", e[0])
+	}
+	var output string
+	f.index = func(w http.ResponseWriter, _ *http.Request, code int, o string) {
+		w.WriteHeader(code)
+		output = o
+	}
+	w := httptest.NewRecorder()
+	f.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/AAA", nil))
+	if w.Code != http.StatusForbidden || output != "2020-01-03T00:00:00Z" {
+		t.Errorf("expecting index to be called with code 403 and activation time, got %d and %q", w.Code, output)
+	}
+	for n, test := range [...]struct {
+		Body string
+		Code int
+	}{
+		{ // 1
+			Body: "url=http://www.example.com/&notBefore=2020-01-03T10:00&notAfter=2020-01-04T00:00:00%2B01:00",
+			Code: http.StatusOK,
+		},
+		{ // 2
+			Body: "url=http://www.example.com/&notBefore=tomorrow",
+			Code: http.StatusBadRequest,
+		},
+		{ // 3
+			Body: "url=http://www.example.com/&notBefore=2020-01-04T00:00&notAfter=2020-01-03T00:00",
+			Code: http.StatusBadRequest,
+		},
+	} {
+		r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(test.Body))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		f.ServeHTTP(w, r)
+		if w.Code != test.Code {
+			t.Errorf("form test %d: expecting response code %d, got %d", n+1, test.Code, w.Code)
+		}
+	}
+}